@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/align"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var alignQuery string
+var alignReference string
+var alignFormat string
+var alignBand int
+var alignOutfile string
+var alignThreads int
+
+func init() {
+	rootCmd.AddCommand(alignCmd)
+
+	alignCmd.Flags().StringVarP(&alignQuery, "query", "q", "stdin", "Unaligned sequences to align, in fasta format")
+	alignCmd.Flags().StringVarP(&alignReference, "reference", "r", "", "Reference sequence to align to, in fasta format")
+	alignCmd.Flags().StringVarP(&alignFormat, "format", "f", "sam", "What to write: pairwise alignments in sam format (sam), or an alignment in reference coordinates (fasta)")
+	alignCmd.Flags().IntVarP(&alignBand, "band", "", 100, "How far (in bases) alignments can stray from the diagonals between seeds")
+	alignCmd.Flags().StringVarP(&alignOutfile, "outfile", "o", "stdout", "Output to write")
+	alignCmd.Flags().IntVarP(&alignThreads, "threads", "t", 1, "Number of threads to use")
+
+	alignCmd.Flags().SortFlags = false
+}
+
+var alignCmd = &cobra.Command{
+	Use:   "align",
+	Short: "Align assembled genomes to a reference",
+	Long: `Align assembled genomes to a reference
+
+Example usage:
+	gofasta align -r MN908947.fasta -q unaligned.fasta -o aligned.sam
+	gofasta align -r MN908947.fasta -q unaligned.fasta -f fasta -o aligned.fasta
+
+Each sequence in --query is aligned to the (first) sequence in --reference. Alignments are seeded with 15-mers that
+occur once in the reference, and the gaps between (and beyond) the seeds are filled in with banded dynamic
+programming, so this is meant for assembled genomes that are fairly similar to the reference, not for reads.
+
+By default the pairwise alignments are written in sam format, for gofasta sam toMultiAlign, variants, indels
+etc. Unaligned ends are soft clipped, and parts of a sequence that align elsewhere in the reference (e.g.
+because of a rearrangement) are written as supplementary alignments. With --format fasta the alignment is
+written in reference coordinates instead, in the same way as by gofasta sam toMultiAlign (so insertions
+relative to the reference are left out).
+
+If --query and --outfile are not specified, the behaviour is to read the sequences from stdin and write
+to stdout, e.g.:
+	cat unaligned.fasta | gofasta align -r MN908947.fasta | gofasta sam variants -a MN908947.gb`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var format string
+		switch strings.ToLower(alignFormat) {
+		case "sam":
+			format = "sam"
+		case "fasta":
+			format = "fasta"
+		default:
+			return errors.New("couldn't tell which --format to write (choose one of \"sam\" or \"fasta\")")
+		}
+
+		if alignReference == "" {
+			return errors.New("provide a --reference to align to")
+		}
+
+		ref, err := gfio.OpenIn(*cmd.Flag("reference"))
+		if err != nil {
+			return err
+		}
+		defer ref.Close()
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = align.Align(query, ref, format, alignBand, out, alignThreads)
+
+		return
+	},
+}
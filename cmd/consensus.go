@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/consensus"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var consensusQuery string
+var consensusMethod string
+var consensusThreshold float64
+var consensusGaps bool
+var consensusMinSupport int
+var consensusMetadata string
+var consensusIDColumn string
+var consensusGroupColumn string
+var consensusName string
+var consensusOutfile string
+var consensusThreads int
+
+func init() {
+	rootCmd.AddCommand(consensusCmd)
+
+	consensusCmd.Flags().StringVarP(&consensusQuery, "query", "q", "stdin", "Alignment of sequences to make a consensus from, in fasta format")
+	consensusCmd.Flags().StringVarP(&consensusMethod, "method", "m", "majority", "How to call each site (majority, iupac or strict)")
+	consensusCmd.Flags().Float64VarP(&consensusThreshold, "threshold", "", 0.75, "If --method iupac, the proportion of sequences that the called bases must account for")
+	consensusCmd.Flags().BoolVarP(&consensusGaps, "gaps", "", false, "Count alignment gaps, so that a site's consensus can be a gap (by default they are treated like Ns)")
+	consensusCmd.Flags().IntVarP(&consensusMinSupport, "min-support", "", 0, "Call N at sites where fewer than this many sequences have a base")
+	consensusCmd.Flags().StringVarP(&consensusMetadata, "metadata", "", "", "(Optional) CSV file of metadata with a header, to make a consensus for each group of sequences in it")
+	consensusCmd.Flags().StringVarP(&consensusIDColumn, "id-column", "", "", "The column of --metadata with the sequence IDs in it (default: the first column)")
+	consensusCmd.Flags().StringVarP(&consensusGroupColumn, "group-column", "", "", "The column of --metadata with the groups in it, e.g. lineage")
+	consensusCmd.Flags().StringVarP(&consensusName, "name", "", "consensus", "The name of the consensus sequence, if there are no groups")
+	consensusCmd.Flags().StringVarP(&consensusOutfile, "outfile", "o", "stdout", "Consensus sequence(s) to write, in fasta format")
+	consensusCmd.Flags().IntVarP(&consensusThreads, "threads", "t", 1, "Number of threads to use")
+
+	consensusCmd.Flags().Lookup("gaps").NoOptDefVal = "true"
+
+	consensusCmd.Flags().SortFlags = false
+}
+
+var consensusCmd = &cobra.Command{
+	Use:   "consensus",
+	Short: "Make consensus sequences from an alignment",
+	Long: `Make consensus sequences from an alignment
+
+Example usage:
+	gofasta consensus -q alignment.fasta -o consensus.fasta
+	gofasta consensus -q alignment.fasta -m iupac --threshold 0.9 --metadata metadata.csv --group-column lineage -o lineages.fasta
+
+--method majority calls the most common base at each site (or the IUPAC code for all the most common bases, if
+there is a tie). --method iupac calls the IUPAC code for the fewest bases that account for at least --threshold of
+the sequences. --method strict calls a base only if every sequence agrees, and N otherwise.
+
+Ambiguity codes count as an equal share of each of the bases they could be, and Ns are ignored. Gaps are ignored
+too, unless you use --gaps, in which case the consensus at a site can be a gap. Sites where fewer than --min-support
+sequences have a base (or a gap, with --gaps) are called as N.
+
+With --metadata and --group-column, a consensus is made for each group of sequences (e.g. each lineage), named by
+the group, and sequences that aren't in --metadata are left out.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var method string
+		switch strings.ToLower(consensusMethod) {
+		case "majority":
+			method = "majority"
+		case "iupac":
+			method = "iupac"
+		case "strict":
+			method = "strict"
+		default:
+			return errors.New("couldn't tell which --method to use (choose one of \"majority\", \"iupac\" or \"strict\")")
+		}
+
+		var groups map[string]string
+		if consensusMetadata != "" {
+			if consensusGroupColumn == "" {
+				return errors.New("--metadata needs a --group-column")
+			}
+			f, err := gfio.OpenIn(*cmd.Flag("metadata"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			groups, err = consensus.ReadGroups(f, consensusIDColumn, consensusGroupColumn)
+			if err != nil {
+				return err
+			}
+		}
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = consensus.Consensus(query, method, consensusThreshold, consensusGaps, consensusMinSupport, groups, consensusName, out, consensusThreads)
+
+		return
+	},
+}
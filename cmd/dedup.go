@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/dedup"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var dedupQuery string
+var dedupOutfile string
+var dedupTable string
+var dedupExact bool
+var dedupHardGaps bool
+var dedupThreads int
+
+func init() {
+	rootCmd.AddCommand(dedupCmd)
+
+	dedupCmd.Flags().StringVarP(&dedupQuery, "query", "q", "stdin", "Alignment of sequences to deduplicate, in fasta format")
+	dedupCmd.Flags().StringVarP(&dedupOutfile, "outfile", "o", "stdout", "Alignment of representative sequences to write, in fasta format")
+	dedupCmd.Flags().StringVarP(&dedupTable, "table", "", "", "(Optional) CSV file to write which representative each dropped sequence was collapsed into")
+	dedupCmd.Flags().BoolVarP(&dedupExact, "exact", "", false, "Only collapse sequences that are identical")
+	dedupCmd.Flags().BoolVarP(&dedupHardGaps, "hard-gaps", "", false, "Don't treat alignment gaps as missing data")
+	dedupCmd.Flags().IntVarP(&dedupThreads, "threads", "t", 1, "Number of threads to use")
+
+	dedupCmd.Flags().Lookup("exact").NoOptDefVal = "true"
+	dedupCmd.Flags().Lookup("hard-gaps").NoOptDefVal = "true"
+
+	dedupCmd.Flags().SortFlags = false
+}
+
+var dedupCmd = &cobra.Command{
+	Use:   "dedup",
+	Short: "Collapse duplicate sequences in an alignment",
+	Long: `Collapse duplicate sequences in an alignment
+
+Example usage:
+	gofasta dedup -q alignment.fasta -o unique.fasta --table membership.csv
+
+Two sequences are duplicates if there is no site at which they are certainly different, i.e. if they are identical
+apart from Ns, other ambiguity codes (IUPAC codes are treated as the set of bases that they represent) and alignment
+gaps (unless you use --hard-gaps). Use --exact to only collapse sequences that are identical.
+
+Representatives are chosen greedily from the most complete sequence to the least, and each sequence is collapsed
+into the most complete representative that it is a duplicate of. Representatives are written in the same order as
+the input. --table is a CSV file with the columns query and representative, with a line for each sequence that
+was dropped.
+
+The whole alignment is held in memory.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		var table io.WriteCloser
+		if dedupTable != "" {
+			table, err = gfio.OpenOut(*cmd.Flag("table"))
+			if err != nil {
+				return err
+			}
+			defer table.Close()
+		}
+
+		err = dedup.Dedup(query, dedupExact, dedupHardGaps, out, table, dedupThreads)
+
+		return
+	},
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/closest"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var distanceThreads int
+var distanceQuery string
+var distanceTarget string
+var distanceReference string
+var distanceMeasure string
+var distanceFormat string
+var distanceMaxDist string
+var distanceOutfile string
+
+func init() {
+	rootCmd.AddCommand(distanceCmd)
+
+	distanceCmd.Flags().IntVarP(&distanceThreads, "threads", "t", 0, "Number of CPUs to use (Default: all available CPUs)")
+	distanceCmd.Flags().StringVarP(&distanceQuery, "query", "q", "stdin", "Alignment of sequences for the rows of the matrix, in fasta format")
+	distanceCmd.Flags().StringVarP(&distanceTarget, "target", "", "", "(Optional) alignment of sequences for the columns of the matrix, in fasta format. If not given, the matrix is all-vs-all of --query")
+	distanceCmd.Flags().StringVarP(&distanceReference, "reference", "r", "", "(Optional) reference sequence, in fasta format. If given, distances are calculated from each sequence's differences from it")
+	distanceCmd.Flags().StringVarP(&distanceMeasure, "measure", "m", "raw", "Which distance measure to use (raw, snp or tn93)")
+	distanceCmd.Flags().StringVarP(&distanceFormat, "format", "f", "csv", "Output format (phylip, csv or tsv)")
+	distanceCmd.Flags().StringVarP(&distanceMaxDist, "max-dist", "d", "", "(Optional) with --format tsv, only write pairs less than or equal to this distance apart")
+	distanceCmd.Flags().StringVarP(&distanceOutfile, "outfile", "o", "stdout", "The output file to write")
+
+	distanceCmd.Flags().SortFlags = false
+}
+
+var distanceCmd = &cobra.Command{
+	Use:   "distance",
+	Short: "Calculate a matrix of pairwise genetic distances",
+	Long: `Calculate a matrix of pairwise genetic distances
+
+Example usage:
+
+	gofasta distance -t 4 -q alignment.fasta -o distances.csv
+	gofasta distance -q alignment.fasta --format phylip -o distances.phy
+	gofasta distance -q query.fasta --target target.fasta -m snp --format tsv -d 2 -o distances.tsv
+
+With only --query, the matrix is of every sequence in --query against every other. With --target too, the rows
+of the matrix are the sequences in --query and the columns are the sequences in --target.
+
+The distance measures are the same as for gofasta closest: raw number of nucleotide changes per site (the default, raw),
+raw number of nucleotide changes in total (snp), or Tamura and Nei's 1993 evolutionary distance (tn93).
+
+--format can be phylip (a square all-vs-all matrix in relaxed PHYLIP format, so only without --target), csv
+(a matrix with a header row of column names, and the row names in the first column) or tsv (long format, with
+the columns query, target and distance, and one line per pair). In an all-vs-all tsv, each pair is only written
+once. With --format tsv you can also set a --max-dist, and only pairs less than or equal to this distance apart
+are written.
+
+The sequences for the columns are held in memory, but the rows are streamed from --query (if there is a --target)
+and the matrix is written as it is calculated, so it never has to be held in memory. As with gofasta closest,
+giving a --reference makes the calculation much faster for closely related sequences.
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var measure string
+		switch strings.ToLower(distanceMeasure) {
+		case "raw":
+			measure = "raw"
+		case "snp":
+			measure = "snp"
+		case "tn93":
+			measure = "tn93"
+		default:
+			return errors.New("couldn't tell which distance --measure / -m to use (choose one of \"raw\", \"snp\" or \"tn93\")")
+		}
+
+		var format string
+		switch strings.ToLower(distanceFormat) {
+		case "phylip":
+			format = "phylip"
+		case "csv":
+			format = "csv"
+		case "tsv":
+			format = "tsv"
+		default:
+			return errors.New("couldn't tell which --format to write (choose one of \"phylip\", \"csv\" or \"tsv\")")
+		}
+
+		dist := -1.0
+		if distanceMaxDist != "" {
+			dist, err = strconv.ParseFloat(distanceMaxDist, 64)
+			if err != nil {
+				return err
+			}
+		}
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		var target io.ReadCloser
+		if distanceTarget != "" {
+			target, err = gfio.OpenIn(*cmd.Flag("target"))
+			if err != nil {
+				return err
+			}
+			defer target.Close()
+		}
+
+		var ref io.ReadCloser
+		if distanceReference != "" {
+			ref, err = gfio.OpenIn(*cmd.Flag("reference"))
+			if err != nil {
+				return err
+			}
+			defer ref.Close()
+		}
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = closest.Distance(query, target, ref, measure, format, dist, out, distanceThreads)
+
+		return
+	},
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/extract"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var extractMSA string
+var extractReference string
+var extractRanges string
+var extractBED string
+var extractAnnotation string
+var extractFeatures []string
+var extractConcatenate bool
+var extractOutfile string
+var extractOutdir string
+var extractPartitions string
+var extractThreads int
+
+func init() {
+	rootCmd.AddCommand(extractCmd)
+
+	extractCmd.Flags().StringVarP(&extractMSA, "msa", "", "stdin", "Multiple sequence alignment to extract regions from, in fasta format")
+	extractCmd.Flags().StringVarP(&extractReference, "reference", "r", "", "(Optional) the ID of the reference record in the msa, if the msa isn't in reference coordinates")
+	extractCmd.Flags().StringVarP(&extractRanges, "ranges", "", "", "Comma-separated list of 1-based, inclusive ranges to extract, e.g. 266-21555,21563-25384")
+	extractCmd.Flags().StringVarP(&extractBED, "bed", "b", "", "BED file of regions to extract")
+	extractCmd.Flags().StringVarP(&extractAnnotation, "annotation", "a", "", "Genbank or GFF3 format annotation file to find --features in. Must have suffix .gb or .gff")
+	extractCmd.Flags().StringSliceVarP(&extractFeatures, "features", "", []string{}, "Names of annotated features to extract. Can be given more than once, or as a comma-separated list")
+	extractCmd.Flags().BoolVarP(&extractConcatenate, "concatenate", "", false, "If there is more than one region, write one alignment with all the regions concatenated (to --outfile)")
+	extractCmd.Flags().StringVarP(&extractOutfile, "outfile", "o", "stdout", "If there is one region or --concatenate, the alignment to write")
+	extractCmd.Flags().StringVarP(&extractOutdir, "outdir", "", ".", "If there is more than one region and not --concatenate, directory to write one alignment per region to")
+	extractCmd.Flags().StringVarP(&extractPartitions, "partitions", "", "", "If --concatenate, (optional) nexus format file of the position of each region in the alignment to write")
+	extractCmd.Flags().IntVarP(&extractThreads, "threads", "t", 1, "Number of threads to use")
+
+	extractCmd.Flags().Lookup("concatenate").NoOptDefVal = "true"
+
+	extractCmd.Flags().SortFlags = false
+}
+
+var extractCmd = &cobra.Command{
+	Use:   "extract",
+	Short: "Extract regions from an alignment",
+	Long: `Extract regions from an alignment
+
+Example usage:
+	gofasta extract --msa aligned.fasta --ranges 21563-25384 -o spike.fasta
+	gofasta extract --msa aligned.fasta -a MN908947.gb --features S,N --outdir genes/
+	gofasta extract --msa aligned.fasta -b amplicons.bed --concatenate -o amplicons.fasta --partitions amplicons.nex
+
+Regions to extract can come from any combination of --ranges, --bed and --features (names of genes or other
+features in --annotation, e.g. gene, product or locus_tag qualifiers in a genbank file, or Name or ID attributes in
+a gff file), and are extracted in that order. All positions are in reference coordinates. A feature is extracted
+from its first to its last position, in the forward orientation.
+
+If --msa isn't in reference coordinates (e.g. it has insertions relative to the reference), provide the ID of a
+reference sequence in it with --reference, and positions will be converted to alignment columns using that
+sequence. Any insertions inside a region are kept.
+
+If there is one region, it is written to --outfile. If there is more than one, one alignment for each region is
+written to --outdir, called <name>.fasta (where ranges are named by their positions, e.g. 21563-25384.fasta), or
+with --concatenate all the regions for each sequence are joined together into one alignment, and --partitions
+writes where each region is in it.
+
+If --msa and --outfile are not specified, the behaviour is to read the alignment from stdin and write
+the extracted alignment to stdout.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if extractRanges == "" && extractBED == "" && len(extractFeatures) == 0 {
+			return errors.New("nothing to extract: provide at least one of --ranges, --bed or --features")
+		}
+		if len(extractFeatures) > 0 && extractAnnotation == "" {
+			return errors.New("--features needs an --annotation to find them in")
+		}
+
+		regions := make([]extract.Region, 0)
+
+		if extractRanges != "" {
+			r, err := extract.ParseRanges(extractRanges)
+			if err != nil {
+				return err
+			}
+			regions = append(regions, r...)
+		}
+
+		if extractBED != "" {
+			bed, err := gfio.OpenIn(*cmd.Flag("bed"))
+			if err != nil {
+				return err
+			}
+			defer bed.Close()
+			r, err := extract.ReadBED(bed)
+			if err != nil {
+				return err
+			}
+			regions = append(regions, r...)
+		}
+
+		if len(extractFeatures) > 0 {
+			var annoSuffix string
+			switch gfio.Ext(extractAnnotation) {
+			case ".gb":
+				annoSuffix = "gb"
+			case ".gff":
+				annoSuffix = "gff"
+			default:
+				return errors.New("couldn't tell if --annotation was a .gb or a .gff file")
+			}
+			anno, err := gfio.OpenIn(*cmd.Flag("annotation"))
+			if err != nil {
+				return err
+			}
+			defer anno.Close()
+			r, err := extract.Features(anno, annoSuffix, extractFeatures)
+			if err != nil {
+				return err
+			}
+			regions = append(regions, r...)
+		}
+
+		concatenate := extractConcatenate || len(regions) == 1
+		if extractPartitions != "" && !extractConcatenate {
+			return errors.New("--partitions only makes sense with --concatenate")
+		}
+
+		msa, err := gfio.OpenIn(*cmd.Flag("msa"))
+		if err != nil {
+			return err
+		}
+		defer msa.Close()
+
+		var out, partitions io.WriteCloser
+		if concatenate {
+			out, err = gfio.OpenOut(*cmd.Flag("outfile"))
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			if extractPartitions != "" {
+				partitions, err = gfio.OpenOut(*cmd.Flag("partitions"))
+				if err != nil {
+					return err
+				}
+				defer partitions.Close()
+			}
+		} else {
+			err = os.MkdirAll(extractOutdir, 0755)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = extract.Extract(msa, extractReference, regions, extractOutdir, out, partitions, extractThreads)
+
+		return
+	},
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/filter"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var filterQuery string
+var filterOutfile string
+var filterMinCompleteness float64
+var filterMaxNRun int
+var filterMinLength int
+var filterMaxLength int
+var filterInclude string
+var filterExclude string
+var filterRegex string
+var filterDescRegex string
+var filterMetadata string
+var filterMetadataID string
+var filterWhere []string
+var filterWrap int
+
+func init() {
+	rootCmd.AddCommand(filterCmd)
+
+	filterCmd.Flags().StringVarP(&filterQuery, "query", "q", "stdin", "Alignment of sequences to filter, in fasta format")
+	filterCmd.Flags().StringVarP(&filterOutfile, "outfile", "o", "stdout", "Alignment of the sequences that pass, in fasta format")
+	filterCmd.Flags().Float64VarP(&filterMinCompleteness, "min-completeness", "", -1, "Minimum completeness score, as a proportion of the maximum possible (0-1, or -1 for no limit)")
+	filterCmd.Flags().IntVarP(&filterMaxNRun, "max-n-run", "", -1, "Maximum length of any run of Ns (-1 for no limit)")
+	filterCmd.Flags().IntVarP(&filterMinLength, "min-length", "", -1, "Minimum sequence length, excluding alignment gaps (-1 for no limit)")
+	filterCmd.Flags().IntVarP(&filterMaxLength, "max-length", "", -1, "Maximum sequence length, excluding alignment gaps (-1 for no limit)")
+	filterCmd.Flags().StringVarP(&filterInclude, "include", "", "", "Plain text file of IDs to keep (everything else is dropped)")
+	filterCmd.Flags().StringVarP(&filterExclude, "exclude", "", "", "Plain text file of IDs to drop")
+	filterCmd.Flags().StringVarP(&filterRegex, "regex", "", "", "Only keep sequences whose ID matches this regular expression")
+	filterCmd.Flags().StringVarP(&filterDescRegex, "desc-regex", "", "", "Only keep sequences whose description (the whole header line) matches this regular expression")
+	filterCmd.Flags().StringVarP(&filterMetadata, "metadata", "", "", "CSV file of metadata with a header, for use with --where")
+	filterCmd.Flags().StringVarP(&filterMetadataID, "metadata-id", "", "", "The column of --metadata with the sequence IDs in it (default: the first column)")
+	filterCmd.Flags().StringArrayVarP(&filterWhere, "where", "", []string{}, "Only keep sequences whose metadata passes this test, e.g. date>=2021-01-01. Can be given more than once")
+	filterCmd.Flags().IntVarP(&filterWrap, "wrap", "", 0, "Wrap sequence lines to this many characters (0 for no wrapping)")
+
+	filterCmd.Flags().SortFlags = false
+}
+
+// readIDs reads a plain text file with one ID per line
+func readIDs(r io.Reader) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		id := strings.TrimSpace(s.Text())
+		if id != "" {
+			ids[id] = true
+		}
+	}
+	return ids, s.Err()
+}
+
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "Keep or drop sequences by quality, ID or metadata",
+	Long: `Keep or drop sequences by quality, ID or metadata
+
+Example usage:
+	gofasta filter -q alignment.fasta --min-completeness 0.9 --max-n-run 500 -o filtered.fasta
+	gofasta filter -q alignment.fasta --metadata metadata.csv --where "date>=2021-01-01" --where lineage=B.1.1.7 -o filtered.fasta
+
+Sequences are written in the same order as the input if they pass every test that you ask for.
+
+Completeness is the completeness score of a sequence (12 for each ATGC, 6 for each two-base ambiguity code, 4 for
+each three-base ambiguity code and 3 for anything else), as a proportion of the score of an all-ATGC sequence of the
+same width. Runs of Ns include ?s. Lengths don't include alignment gaps.
+
+--include and --exclude are plain text files with one ID per line. --regex is matched against each sequence's ID,
+and --desc-regex against its whole header line.
+
+--where tests a column of --metadata against a value, using one of the operators =, !=, <, <=, > or >=. Values are
+compared as numbers if they are both numbers, otherwise as text (which works for dates in YYYY-MM-DD format).
+Sequences that aren't in --metadata are dropped. Quote the test on the command line if it includes < or >.
+
+If query and outfile are not specified, the behaviour is to read the alignment from stdin and write
+the sequences that pass to stdout.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		o := filter.NewOptions()
+		o.MinCompleteness = filterMinCompleteness
+		o.MaxNRun = filterMaxNRun
+		o.MinLength = filterMinLength
+		o.MaxLength = filterMaxLength
+
+		if filterInclude != "" {
+			f, err := gfio.OpenIn(*cmd.Flag("include"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			o.Include, err = readIDs(f)
+			if err != nil {
+				return err
+			}
+		}
+
+		if filterExclude != "" {
+			f, err := gfio.OpenIn(*cmd.Flag("exclude"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			o.Exclude, err = readIDs(f)
+			if err != nil {
+				return err
+			}
+		}
+
+		if filterRegex != "" {
+			o.IDRegex, err = regexp.Compile(filterRegex)
+			if err != nil {
+				return err
+			}
+		}
+
+		if filterDescRegex != "" {
+			o.DescRegex, err = regexp.Compile(filterDescRegex)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(filterWhere) > 0 && filterMetadata == "" {
+			return errors.New("--where needs --metadata")
+		}
+
+		if filterMetadata != "" {
+			f, err := gfio.OpenIn(*cmd.Flag("metadata"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			o.Metadata, err = filter.ReadMetadata(f, filterMetadataID)
+			if err != nil {
+				return err
+			}
+			for _, w := range filterWhere {
+				p, err := filter.ParsePredicate(w)
+				if err != nil {
+					return err
+				}
+				o.Where = append(o.Where, p)
+			}
+		}
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = filter.Filter(query, o, out, filterWrap)
+
+		return
+	},
+}
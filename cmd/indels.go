@@ -43,7 +43,7 @@ Example usage:
 
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
-		samIn, err := gfio.OpenIn(*cmd.Flag("samfile"))
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/mask"
+)
+
+var maskMSA string
+var maskReference string
+var maskBED string
+var maskVCF string
+var maskVCFFilter []string
+var maskRanges string
+var maskTable string
+var maskWith string
+var maskOutfile string
+var maskThreads int
+
+func init() {
+	rootCmd.AddCommand(maskCmd)
+
+	maskCmd.Flags().StringVarP(&maskMSA, "msa", "", "stdin", "Multiple sequence alignment to mask, in fasta format")
+	maskCmd.Flags().StringVarP(&maskReference, "reference", "r", "", "(Optional) the ID of the reference record in the msa, if the msa isn't in reference coordinates")
+	maskCmd.Flags().StringVarP(&maskBED, "bed", "b", "", "BED file of regions to mask")
+	maskCmd.Flags().StringVarP(&maskVCF, "vcf", "", "", "VCF file of sites to mask (e.g. the SARS-CoV-2 problematic sites list)")
+	maskCmd.Flags().StringSliceVarP(&maskVCFFilter, "vcf-filter", "", []string{}, "(Optional) only mask --vcf records with these values in the FILTER column, e.g. mask")
+	maskCmd.Flags().StringVarP(&maskRanges, "ranges", "", "", "Comma-separated list of 1-based, inclusive ranges to mask, e.g. 1-55,29804-29903")
+	maskCmd.Flags().StringVarP(&maskTable, "table", "", "", "CSV file of regions to mask in individual sequences, with columns query and regions")
+	maskCmd.Flags().StringVarP(&maskWith, "with", "", "N", "What to mask sites with (N or gap)")
+	maskCmd.Flags().StringVarP(&maskOutfile, "outfile", "o", "stdout", "Masked alignment to write, in fasta format")
+	maskCmd.Flags().IntVarP(&maskThreads, "threads", "t", 1, "Number of threads to use")
+
+	maskCmd.Flags().SortFlags = false
+}
+
+var maskCmd = &cobra.Command{
+	Use:   "mask",
+	Short: "Mask sites in an alignment",
+	Long: `Mask sites in an alignment
+
+Example usage:
+	gofasta mask --msa aligned.fasta --vcf problematic_sites_sarsCov2.vcf --vcf-filter mask -o masked.fasta
+	gofasta mask --msa aligned.fasta --bed primers.bed --ranges 1-55,29804-29903 -o masked.fasta
+
+Sites to mask can come from any combination of --bed, --vcf and --ranges, and are replaced with N (or with
+alignment gaps if you use --with gap) in every sequence in --msa. All positions are in reference coordinates.
+
+If --msa isn't in reference coordinates (e.g. it has insertions relative to the reference), provide the ID of a
+reference sequence in it with --reference, and positions will be converted to alignment columns using that
+sequence. Any insertions inside a region are masked too. The reference sequence itself is not masked.
+
+You can also mask regions in individual sequences with --table, a CSV file with a header and (at least) the
+columns query and regions, where regions is a "|"-delimited list of ranges, e.g.:
+
+	query,regions
+	seq1,1-200|21765-21770
+	seq2,28881-28883
+
+If --msa and --outfile are not specified, the behaviour is to read the alignment from stdin and write
+the masked alignment to stdout.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var char byte
+		switch strings.ToLower(maskWith) {
+		case "n":
+			char = 'N'
+		case "gap", "-":
+			char = '-'
+		default:
+			return errors.New("couldn't tell what to mask --with (choose one of \"N\" or \"gap\")")
+		}
+
+		if maskBED == "" && maskVCF == "" && maskRanges == "" && maskTable == "" {
+			return errors.New("nothing to mask: provide at least one of --bed, --vcf, --ranges or --table")
+		}
+
+		regions := make([]mask.Region, 0)
+
+		if maskBED != "" {
+			bed, err := gfio.OpenIn(*cmd.Flag("bed"))
+			if err != nil {
+				return err
+			}
+			defer bed.Close()
+			r, err := mask.ReadBED(bed)
+			if err != nil {
+				return err
+			}
+			regions = append(regions, r...)
+		}
+
+		if maskVCF != "" {
+			vcf, err := gfio.OpenIn(*cmd.Flag("vcf"))
+			if err != nil {
+				return err
+			}
+			defer vcf.Close()
+			r, err := mask.ReadVCF(vcf, maskVCFFilter)
+			if err != nil {
+				return err
+			}
+			regions = append(regions, r...)
+		}
+
+		if maskRanges != "" {
+			r, err := mask.ParseRanges(maskRanges, ",")
+			if err != nil {
+				return err
+			}
+			regions = append(regions, r...)
+		}
+
+		var table map[string][]mask.Region
+		if maskTable != "" {
+			f, err := gfio.OpenIn(*cmd.Flag("table"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			table, err = mask.ReadTable(f)
+			if err != nil {
+				return err
+			}
+		}
+
+		msa, err := gfio.OpenIn(*cmd.Flag("msa"))
+		if err != nil {
+			return err
+		}
+		defer msa.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = mask.Mask(msa, maskReference, regions, table, char, out, maskThreads)
+
+		return
+	},
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+var packInfile string
+var packOutfile string
+
+var unpackInfile string
+var unpackOutfile string
+var unpackIDs []string
+
+func init() {
+	rootCmd.AddCommand(packCmd)
+	rootCmd.AddCommand(unpackCmd)
+
+	packCmd.Flags().StringVarP(&packInfile, "infile", "i", "stdin", "Alignment to pack, in fasta format")
+	packCmd.Flags().StringVarP(&packOutfile, "outfile", "o", "stdout", "Pack file to write")
+
+	packCmd.Flags().SortFlags = false
+
+	unpackCmd.Flags().StringVarP(&unpackInfile, "infile", "i", "stdin", "Pack file to unpack")
+	unpackCmd.Flags().StringVarP(&unpackOutfile, "outfile", "o", "stdout", "Alignment to write, in fasta format")
+	unpackCmd.Flags().StringSliceVarP(&unpackIDs, "id", "", []string{}, "(Optional) only write the records with these IDs. Can be given more than once, or as a comma-separated list")
+
+	unpackCmd.Flags().SortFlags = false
+}
+
+var packCmd = &cobra.Command{
+	Use:   "pack",
+	Short: "Store an alignment in gofasta's binary pack format",
+	Long: `Store an alignment in gofasta's binary pack format
+
+Example usage:
+
+	gofasta pack -i alignment.fasta -o alignment.pack
+
+A pack holds the alignment already encoded the way gofasta uses it internally, together with each
+sequence's completeness score and base content, so it doesn't need to be parsed again every time you use it.
+It can be given in place of a fasta format alignment to any command that reads alignments with
+gofasta's encoding (closest, snps, updown, variants), which is much faster for large alignments.
+
+Packs have an index, so single records can be read from them by ID (see gofasta unpack).
+`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		in, err := gfio.OpenIn(*cmd.Flag("infile"))
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = fasta.PackAlignment(in, out)
+
+		return
+	},
+}
+
+var unpackCmd = &cobra.Command{
+	Use:   "unpack",
+	Short: "Convert a pack file back to fasta format",
+	Long: `Convert a pack file back to fasta format
+
+Example usage:
+
+	gofasta unpack -i alignment.pack -o alignment.fasta
+	gofasta unpack -i alignment.pack --id seq1,seq2 -o twoseqs.fasta
+
+With --id, only the named records are written (in the order they are given), and they are read directly
+from the pack's index rather than from the whole file. --infile must be an (uncompressed) file on disk in
+this case.
+`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if len(unpackIDs) > 0 {
+			if unpackInfile == "stdin" {
+				return errors.New("--id needs --infile to be a pack file, not stdin")
+			}
+			p, err := fasta.OpenPack(unpackInfile)
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			return fasta.UnpackIDs(p, unpackIDs, out)
+		}
+
+		in, err := gfio.OpenIn(*cmd.Flag("infile"))
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		err = fasta.UnpackAlignment(in, out)
+
+		return
+	},
+}
@@ -12,15 +12,18 @@ func init() {
 	rootCmd.AddCommand(samCmd)
 
 	samCmd.PersistentFlags().IntVarP(&samThreads, "threads", "t", 1, "Number of threads to use")
-	samCmd.PersistentFlags().StringVarP(&samFile, "samfile", "s", "stdin", "Samfile to read. If none is specified, will read from stdin")
+	samCmd.PersistentFlags().StringVarP(&samFile, "samfile", "s", "stdin", "Sam or bam file to read. If none is specified, will read from stdin")
 	samCmd.PersistentFlags().StringVarP(&samReference, "reference", "r", "", "Reference fasta file used to generate the sam file")
 }
 
 var samCmd = &cobra.Command{
 	Use:   "sam",
 	Short: "Do things with sam files",
-	Long:  `Do things with sam files`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Do things with sam files
+
+--samfile can be in sam or bam format (the format is detected automatically). Cram files
+are not supported directly; convert them to bam first with samtools view -b.`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		return nil
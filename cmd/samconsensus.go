@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/sam"
+)
+
+var samConsensusName string
+var samConsensusMinDepth int
+var samConsensusMinBaseQual int
+var samConsensusMinMapQ int
+var samConsensusMinFreq float64
+var samConsensusOutfile string
+
+func init() {
+	samCmd.AddCommand(samConsensusCmd)
+
+	samConsensusCmd.Flags().StringVarP(&samConsensusName, "name", "", "consensus", "The name of the consensus sequence")
+	samConsensusCmd.Flags().IntVarP(&samConsensusMinDepth, "min-depth", "", 10, "Call N at sites covered by fewer than this many reads")
+	samConsensusCmd.Flags().IntVarP(&samConsensusMinBaseQual, "min-base-qual", "", 20, "Ignore bases with a base quality below this")
+	samConsensusCmd.Flags().IntVarP(&samConsensusMinMapQ, "min-mapq", "", 0, "Ignore reads with a mapping quality below this")
+	samConsensusCmd.Flags().Float64VarP(&samConsensusMinFreq, "min-freq", "", 0.25, "The lowest frequency for a base to be part of the call at a site (more than one base is called with an IUPAC code)")
+	samConsensusCmd.Flags().StringVarP(&samConsensusOutfile, "outfile", "o", "stdout", "Consensus sequence to write, in fasta format")
+
+	samConsensusCmd.Flags().SortFlags = false
+}
+
+var samConsensusCmd = &cobra.Command{
+	Use:   "consensus",
+	Short: "Call a consensus sequence from reads in a sam file",
+	Long: `Call a consensus sequence from reads in a sam file
+
+Example usage:
+	gofasta sam consensus -s reads.bam --name sample1 -o sample1.fasta
+	minimap2 -a -x sr MN908947.fa reads_1.fq reads_2.fq | gofasta sam consensus --min-depth 20 --min-freq 0.75 > consensus.fasta
+
+The consensus is in reference coordinates (the same length as the reference, with insertions relative to it left out),
+and only the first reference in the header is used. Unmapped and secondary reads, duplicates and reads that fail QC
+are ignored, as are reads with a mapping quality below --min-mapq and bases with a base quality below --min-base-qual.
+At each site:
+
+	fewer than --min-depth reads (counting deletions)     N
+	one base with a frequency of at least --min-freq      that base
+	more than one base that passes --min-freq             the IUPAC code for those bases
+	a deletion that passes --min-freq and is at least
+	as common as any base                                 -
+
+Use a --min-freq above 0.5 to get a majority consensus without any ambiguity codes.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
+		if err != nil {
+			return err
+		}
+		defer samIn.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = sam.Consensus(samIn, samConsensusName, samConsensusMinDepth, samConsensusMinBaseQual, samConsensusMinMapQ, samConsensusMinFreq, out, samThreads)
+
+		return
+	},
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/sam"
+)
+
+var samSearchAnnotation string
+var samSearchQuery string
+var samSearchOutfile string
+var samSearchAll bool
+
+func init() {
+	samCmd.AddCommand(samSearchCmd)
+
+	samSearchCmd.Flags().StringVarP(&samSearchAnnotation, "annotation", "a", "", "Genbank or GFF3 format annotation file. Must have suffix .gb or .gff")
+	samSearchCmd.Flags().StringVarP(&samSearchQuery, "query", "q", "", "The mutations to search for, as a list or a boolean expression (see gofasta search --help)")
+	samSearchCmd.Flags().StringVarP(&samSearchOutfile, "outfile", "o", "stdout", "Where to write the matching queries")
+	samSearchCmd.Flags().BoolVarP(&samSearchAll, "all", "", false, "Write every query, not just the ones that match")
+
+	samSearchCmd.Flags().Lookup("all").NoOptDefVal = "true"
+
+	samSearchCmd.Flags().SortFlags = false
+}
+
+var samSearchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Find the queries in an alignment in sam format that carry given mutations",
+	Long: `Find the queries in an alignment in sam format that carry given mutations
+
+Example usage:
+	gofasta sam search -s aligned.sam -r reference.fasta -a annotation.gb -q 'aa:S:E484K,del:21765:6' -o matches.csv
+
+--query, and the output, are as for gofasta search. Parts of the reference that aren't covered by a query's records
+count as missing data, so mutations there are unknown.
+
+--reference should be the same sequence that was used to generate the sam file, and should be in the same coordinates
+as the --annotation. You don't have to provide a file to --reference if your annotation has the fasta record in it.
+There must be only one reference sequence in the sam header.
+`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if samSearchQuery == "" {
+			return errors.New("no --query to search for")
+		}
+
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
+		if err != nil {
+			return err
+		}
+		defer samIn.Close()
+
+		refFromFile := false
+		var ref io.ReadCloser
+		if samReference != "" {
+			ref, err = gfio.OpenIn(*cmd.Flag("reference"))
+			if err != nil {
+				return err
+			}
+			defer ref.Close()
+			refFromFile = true
+		}
+
+		var anno io.ReadCloser
+		anno, err = gfio.OpenIn(*cmd.Flag("annotation"))
+		if err != nil {
+			return err
+		}
+		defer anno.Close()
+
+		var annoSuffix string
+		switch gfio.Ext(samSearchAnnotation) {
+		case ".gb":
+			annoSuffix = "gb"
+		case ".gff":
+			annoSuffix = "gff"
+		default:
+			return errors.New("couldn't tell if --annotation was a .gb or a .gff file")
+		}
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = sam.Search(samIn, ref, refFromFile, anno, annoSuffix, samSearchQuery, out, samSearchAll, samThreads)
+
+		return
+	},
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/sam"
+)
+
+var samStatsOutfile string
+var samStatsFormat string
+
+func init() {
+	samCmd.AddCommand(samStatsCmd)
+
+	samStatsCmd.Flags().StringVarP(&samStatsFormat, "format", "f", "csv", "Output format (csv or json)")
+	samStatsCmd.Flags().StringVarP(&samStatsOutfile, "outfile", "o", "stdout", "Where to write the summary")
+
+	samStatsCmd.Flags().SortFlags = false
+}
+
+var samStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarise how each query in a sam file is mapped",
+	Long: `Summarise how each query in a sam file is mapped
+
+Example usage:
+	gofasta sam stats -s aligned.sam -o mapping.csv
+	minimap2 -a -x asm20 --score-N=0 MN908947.fa unaligned.fasta | gofasta sam stats -f json > mapping.json
+
+There is one row for each query, in the same order as --samfile (the records for each query must be next to each
+other, as they are in minimap2's output). Unlike the other sam commands, unmapped queries and secondary mappings are
+reported rather than skipped. The columns are:
+
+	query, length                    the query's name and length (including any hard-clipped bases)
+	mapped                           whether the query has a primary or supplementary mapping
+	primary, supplementary,
+	secondary                        how many of each kind of record the query has
+	strand, mapq                     the strand and mapping quality of the primary record
+	ref_start, ref_end               the span of the reference (1-based, inclusive) covered by the primary and
+	                                 supplementary records
+	clipped_start, clipped_end       how many bases at the start and the end of the query (in its own orientation)
+	                                 aren't aligned by any record
+	overlapping_segments             how many supplementary records overlap another record in the reference (these
+	                                 sites are ambiguous in toMultiAlign's output)
+	insertions, inserted_bases,
+	deletions, deleted_bases         the number and total length of insertions and deletions
+	ref_coverage                     the proportion of the reference that has a query base aligned to it
+
+Chimeric sequences typically have supplementary records and large clipped_start or clipped_end values in the
+primary record, and poorly mapped sequences have low ref_coverage.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var format string
+		switch strings.ToLower(samStatsFormat) {
+		case "csv":
+			format = "csv"
+		case "json":
+			format = "json"
+		default:
+			return errors.New("couldn't tell which --format to write (choose one of \"csv\" or \"json\")")
+		}
+
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
+		if err != nil {
+			return err
+		}
+		defer samIn.Close()
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = sam.Stats(samIn, format, out)
+
+		return
+	},
+}
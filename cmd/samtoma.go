@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"errors"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -14,6 +17,7 @@ var toMultiAlignStart int
 var toMultiAlignEnd int
 var toMultiAlignPad bool
 var toMultiAlignWrap int
+var toMultiAlignInsertions bool
 
 // junk:
 var toMultiAlignTrim bool
@@ -26,6 +30,7 @@ func init() {
 	toMultiAlignCmd.Flags().IntVarP(&toMultiAlignStart, "start", "", -1, "1-based first nucleotide position to retain in the output. Bases before this position are omitted, or are replaced with N if --pad")
 	toMultiAlignCmd.Flags().IntVarP(&toMultiAlignEnd, "end", "", -1, "1-based last nucleotide position to retain the in output. Bases after this position are omitted, or are replaced with N if --pad")
 	toMultiAlignCmd.Flags().BoolVarP(&toMultiAlignPad, "pad", "", false, "If --start and/or --end, replace the trimmed-out regions with Ns, else replace external deletions with Ns")
+	toMultiAlignCmd.Flags().BoolVarP(&toMultiAlignInsertions, "insertions", "", false, "Keep insertions relative to the reference, padding the other sequences with gaps")
 	toMultiAlignCmd.Flags().StringVarP(&toMultiAlignOutfile, "fasta-out", "o", "stdout", "Where to write the alignment")
 	toMultiAlignCmd.Flags().IntVarP(&toMultiAlignWrap, "wrap", "w", -1, "Wrap the output alignment to this number of nucleotides wide. Omit this option not to wrap the output.")
 
@@ -36,6 +41,8 @@ func init() {
 	toMultiAlignCmd.Flags().MarkHidden("trimstart")
 	toMultiAlignCmd.Flags().MarkHidden("trimend")
 
+	toMultiAlignCmd.Flags().Lookup("insertions").NoOptDefVal = "true"
+
 	toMultiAlignCmd.Flags().SortFlags = false
 }
 
@@ -46,6 +53,8 @@ var toMultiAlignCmd = &cobra.Command{
 	Long: `Convert a SAM file to a multiple alignment in fasta format
 
 Insertions relative to the reference are omitted, so all sequences in the output are the same ( = reference) length.
+With --insertions they are kept instead: the alignment is widened by the longest insertion at each position, and the
+other sequences are padded with gaps there (this holds the whole alignment in memory).
 
 Example usage:
 	gofasta sam toMultiAlign -s aligned.sam -o aligned.fasta
@@ -53,9 +62,16 @@ Example usage:
 If you want, you can trim (and optionally pad) the output alignment to coordinates of your choosing:
 	gofasta sam toMultiAlign -s aligned.sam --start 266 --end 29674 --pad -o aligned.fasta
 
+With --start and --end, only insertions between two of the positions that are kept are kept.
+
 If input and output files are not specified, the behaviour is to read the sam file from stdin and write
 the fasta file to stdout, e.g.:
-	minimap2 -a -x asm20 --score-N=0 reference.fasta unaligned.fasta | gofasta sam toMultiAlign > aligned.fasta`,
+	minimap2 -a -x asm20 --score-N=0 reference.fasta unaligned.fasta | gofasta sam toMultiAlign > aligned.fasta
+
+If there is more than one reference sequence (@SQ line) in the sam header, such as the segments of a segmented genome,
+there is one alignment per reference, made from the records mapped to it. Each one is written to its own file, named
+after --fasta-out with the reference's name added (e.g. aligned.PB2.fasta), or to stdout one after another. --start
+and --end can only be used with one reference.`,
 
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
@@ -83,19 +99,44 @@ Note the change of coordinate system if moving from old to new flags.
 			End of trimming argument reconciliation to maintain backwards compatibility
 		*/
 
-		samIn, err := gfio.OpenIn(*cmd.Flag("samfile"))
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
 		if err != nil {
 			return err
 		}
 		defer samIn.Close()
 
-		out, err := gfio.OpenOut(*cmd.Flag("fasta-out"))
-		if err != nil {
-			return err
+		if toMultiAlignOutfile == "stdout" {
+			err = sam.ToMultiAlign(samIn, os.Stdout, toMultiAlignWrap, toMultiAlignStart, toMultiAlignEnd, toMultiAlignPad, toMultiAlignInsertions, samThreads)
+			return
+		}
+
+		// one file per reference sequence, if there is more than one
+		outs := make([]io.WriteCloser, 0)
+		defer func() {
+			for _, out := range outs {
+				if e := out.Close(); e != nil && err == nil {
+					err = e
+				}
+			}
+		}()
+		segmentOutputs := func(refNames []string) ([]io.Writer, error) {
+			ws := make([]io.Writer, len(refNames))
+			for i, name := range refNames {
+				path := toMultiAlignOutfile
+				if len(refNames) > 1 {
+					path = gfio.AddToName(toMultiAlignOutfile, strings.ReplaceAll(name, "/", "_"))
+				}
+				out, err := gfio.Create(path)
+				if err != nil {
+					return nil, err
+				}
+				outs = append(outs, out)
+				ws[i] = out
+			}
+			return ws, nil
 		}
-		defer out.Close()
 
-		err = sam.ToMultiAlign(samIn, out, toMultiAlignWrap, toMultiAlignStart, toMultiAlignEnd, toMultiAlignPad, samThreads)
+		err = sam.ToMultiAlignSegments(samIn, segmentOutputs, toMultiAlignWrap, toMultiAlignStart, toMultiAlignEnd, toMultiAlignPad, toMultiAlignInsertions, samThreads)
 
 		return
 	},
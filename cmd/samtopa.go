@@ -34,11 +34,15 @@ var toPairAlignCmd = &cobra.Command{
 	Use:     "toPairAlign",
 	Aliases: []string{"topairalign", "topa"},
 	Short:   "convert a SAM file to pairwise alignments in fasta format",
-	Long:    `convert a SAM file to pairwise alignments in fasta format`,
+	Long: `convert a SAM file to pairwise alignments in fasta format
+
+If there is more than one reference sequence (@SQ line) in the sam header, such as the segments of a segmented genome,
+--reference must have a record with the same name for each one, and each reference's alignments are written to a
+subdirectory of --outpath named after it. --start and --end can only be used with one reference.`,
 
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
-		samIn, err := gfio.OpenIn(*cmd.Flag("samfile"))
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
 		if err != nil {
 			return err
 		}
@@ -2,13 +2,14 @@ package cmd
 
 import (
 	"errors"
-	"os"
-	"path/filepath"
+	"io"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/virus-evolution/gofasta/pkg/gfio"
 	"github.com/virus-evolution/gofasta/pkg/sam"
+	"github.com/virus-evolution/gofasta/pkg/variants"
 )
 
 var samVariantsAnnotation string
@@ -17,8 +18,15 @@ var samVariantsAggregate bool
 var samVariantsThreshold float64
 var samVariantsAppendSNP bool
 var samVariantsAppendCodons bool
+var samVariantsAppendConsequence bool
 var samVariantsStart int
 var samVariantsEnd int
+var samVariantsFormat string
+var samVariantsReads bool
+var samVariantsMinDepth int
+var samVariantsMinFreq float64
+var samVariantsMinBaseQual int
+var samVariantsMinMapQ int
 
 // for backwards compatibility:
 var samVariantsGenbank string
@@ -34,10 +42,21 @@ func init() {
 	samVariantsCmd.Flags().Float64VarP(&samVariantsThreshold, "threshold", "", 0.0, "If --aggregate, only report changes with a freq greater than or equal to this value")
 	samVariantsCmd.Flags().BoolVarP(&samVariantsAppendSNP, "append-snps", "", false, "Report the codon's SNPs in parenthesis after each amino acid mutation")
 	samVariantsCmd.Flags().BoolVarP(&samVariantsAppendCodons, "append-codons", "", false, "Report the codon's sequence in parenthesis after each amino acid mutation")
+	samVariantsCmd.Flags().BoolVarP(&samVariantsAppendConsequence, "append-consequence", "", false, "Report the functional consequence of each mutation in parenthesis after it")
+
+	samVariantsCmd.Flags().StringVarP(&samVariantsFormat, "format", "", "csv", "Output format (csv, vcf, long or json)")
+
+	samVariantsCmd.Flags().BoolVarP(&samVariantsReads, "reads", "", false, "The sam file is reads from one sample: report the frequency of every allele in them")
+	samVariantsCmd.Flags().IntVarP(&samVariantsMinDepth, "min-depth", "", 10, "If --reads, only report alleles at sites covered by at least this many reads")
+	samVariantsCmd.Flags().Float64VarP(&samVariantsMinFreq, "min-freq", "", 0.03, "If --reads, only report alleles with a frequency greater than or equal to this value")
+	samVariantsCmd.Flags().IntVarP(&samVariantsMinBaseQual, "min-base-qual", "", 20, "If --reads, ignore bases with a base quality below this")
+	samVariantsCmd.Flags().IntVarP(&samVariantsMinMapQ, "min-mapq", "", 0, "If --reads, ignore reads with a mapping quality below this")
 
 	samVariantsCmd.Flags().Lookup("aggregate").NoOptDefVal = "true"
+	samVariantsCmd.Flags().Lookup("reads").NoOptDefVal = "true"
 	samVariantsCmd.Flags().Lookup("append-snps").NoOptDefVal = "true"
 	samVariantsCmd.Flags().Lookup("append-codons").NoOptDefVal = "true"
+	samVariantsCmd.Flags().Lookup("append-consequence").NoOptDefVal = "true"
 
 	samVariantsCmd.Flags().SortFlags = false
 
@@ -70,31 +89,88 @@ isn't in a codon that is represented by an amino acid change). The formats are:
 	del:11288:9 - a 9-base deletion whose first missing nucleotide is at (1-based) position 11288 in reference coordinates
 	aa:s:D614G - the amino acid at (1-based) residue 614 in the S gene is a D in the reference and a G in this sequence
 	nuc:C3037T - the nucleotide at (1-based) position 3037 is a C in the reference and a T in this sequence
+	aa:S:del69-70 - residues 69 to 70 of the S gene are deleted in this sequence
+	aa:S:ins214EPE - the residues EPE are inserted after (1-based) residue 214 of the S gene in this sequence
+
+In-frame insertions and deletions in coding sequence are reported both as nucleotide indels and as amino acid
+insertions and deletions. When an indel splits a codon, the residue that the codon which is left codes for is compared
+to the reference residues on either side of the indel, so that it is reported as an amino acid change only if it
+matches neither. Amino acids downstream of an in-frame indel are annotated as usual.
 
 Frame-shifting mutations in coding sequence are reported as indels but are ignored for subsequent amino-acids in the alignment.
+
+Use --append-consequence to report the functional consequence of each mutation (as a Sequence Ontology term, such as
+missense_variant, frameshift_variant or 5_prime_UTR_variant) in parenthesis after it. See gofasta variants --help for
+the full list, and for the naming of non-coding features and mature peptides.
+
+If there is more than one reference sequence (@SQ line) in the sam header, such as the segments of a segmented genome,
+each one is matched by name to a record in --reference and to a record in the --annotation (by LOCUS name, ACCESSION or
+VERSION for genbank files, which can have one record per segment, or by seqid for gff files). In csv format, each
+reference's variants are written as a section of the output, after a line "# name". A VCF has one header, with a contig
+line for each reference, followed by the records for all of them.
+
+Use --format vcf to write VCF (version 4.3) instead of csv. By default there is one haploid genotype column per query
+sequence; with --aggregate a sites-only file is written whose INFO fields carry the count (AC) and frequency (AF) of each
+allele. Indels are anchored on the preceding reference base and amino acid changes are given in the AA INFO field. A
+query whose base at a site is N or an ambiguity code, or that isn't aligned there (or to that reference at all), has the
+genotype ".", and isn't counted in AN or AF.
+
+Use --format long to write one csv row per mutation per query, or --format json to write one json object per query per
+line (see gofasta variants --help). With more than one reference sequence, each row or object names its reference
+instead of being in a section of the output.
+
+Use --reads if the sam file is reads from one sample (for example short reads from an amplicon protocol), rather than
+one record per genome, to report within-host variants (iSNVs). Every allele that differs from the reference is
+reported with the number of reads covering its site (depth), the number that have it (count) and its frequency, if
+the site has at least --min-depth reads and the allele's frequency is at least --min-freq. Each nucleotide change is
+annotated on its own (reads aren't phased, so two changes in the same codon are reported as two amino acid changes).
+With --format vcf, the depth, count and frequency are in the DP, AC and AF INFO fields. Unmapped and secondary reads,
+duplicates and reads that fail QC are ignored, as are reads and bases below --min-mapq and --min-base-qual.
 `,
 
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
-		samIn, err := gfio.OpenIn(*cmd.Flag("samfile"))
+		var format string
+		switch strings.ToLower(samVariantsFormat) {
+		case "csv":
+			format = "csv"
+		case "vcf":
+			format = "vcf"
+		case "long":
+			format = "long"
+		case "json":
+			format = "json"
+		default:
+			return errors.New("couldn't tell which --format to write (choose one of \"csv\", \"vcf\", \"long\" or \"json\")")
+		}
+
+		if samVariantsReads && samVariantsAggregate {
+			return errors.New("--aggregate doesn't apply to --reads")
+		}
+
+		if samVariantsReads && format != "csv" && format != "vcf" {
+			return errors.New("--reads can only be written in csv or vcf --format")
+		}
+
+		samIn, err := gfio.OpenInRaw(*cmd.Flag("samfile"))
 		if err != nil {
 			return err
 		}
 		defer samIn.Close()
 
 		refFromFile := false
-		var ref *os.File
+		var ref io.ReadCloser
 		if samReference != "" {
 			ref, err = gfio.OpenIn(*cmd.Flag("reference"))
 			if err != nil {
 				return err
 			}
+			defer ref.Close()
 			refFromFile = true
 		}
-		defer ref.Close()
 
 		// some backwards compatibility wrangling of --genbank vs --annotation
-		var anno *os.File
+		var anno io.ReadCloser
 		var annoSuffix string
 		if samVariantsGenbank != "" {
 			if samVariantsAnnotation != "" {
@@ -110,7 +186,7 @@ Frame-shifting mutations in coding sequence are reported as indels but are ignor
 			if err != nil {
 				return err
 			}
-			switch filepath.Ext(samVariantsAnnotation) {
+			switch gfio.Ext(samVariantsAnnotation) {
 			case ".gb":
 				annoSuffix = "gb"
 			case ".gff":
@@ -127,7 +203,23 @@ Frame-shifting mutations in coding sequence are reported as indels but are ignor
 		}
 		defer out.Close()
 
-		err = sam.Variants(samIn, ref, refFromFile, anno, annoSuffix, out, samVariantsStart, samVariantsEnd, samVariantsAggregate, samVariantsThreshold, samVariantsAppendSNP, samVariantsAppendCodons, samThreads)
+		o := variants.Options{
+			Start:             samVariantsStart,
+			End:               samVariantsEnd,
+			Aggregate:         samVariantsAggregate,
+			Threshold:         samVariantsThreshold,
+			AppendSNP:         samVariantsAppendSNP,
+			AppendCodons:      samVariantsAppendCodons,
+			AppendConsequence: samVariantsAppendConsequence,
+			Format:            format,
+		}
+
+		if samVariantsReads {
+			err = sam.ReadVariants(samIn, ref, refFromFile, anno, annoSuffix, out, samVariantsMinDepth, samVariantsMinBaseQual, samVariantsMinMapQ, samVariantsMinFreq, o, samThreads)
+			return err
+		}
+
+		err = sam.Variants(samIn, ref, refFromFile, anno, annoSuffix, out, o, samThreads)
 
 		return err
 	},
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/search"
+)
+
+var searchMSA string
+var searchReference string
+var searchAnnotation string
+var searchQuery string
+var searchOutfile string
+var searchAll bool
+var searchThreads int
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringVarP(&searchMSA, "msa", "", "stdin", "Multiple sequence alignment in fasta format")
+	searchCmd.Flags().StringVarP(&searchReference, "reference", "r", "", "The ID of the reference record in the msa")
+	searchCmd.Flags().StringVarP(&searchAnnotation, "annotation", "a", "", "Genbank or GFF3 format annotation file. Must have suffix .gb or .gff")
+	searchCmd.Flags().StringVarP(&searchQuery, "query", "q", "", "The mutations to search for, as a list or a boolean expression (see below)")
+	searchCmd.Flags().StringVarP(&searchOutfile, "outfile", "o", "stdout", "Where to write the matching sequences")
+	searchCmd.Flags().BoolVarP(&searchAll, "all", "", false, "Write every sequence, not just the ones that match")
+	searchCmd.Flags().IntVarP(&searchThreads, "threads", "t", 1, "Number of threads to use")
+
+	searchCmd.Flags().Lookup("all").NoOptDefVal = "true"
+
+	searchCmd.Flags().SortFlags = false
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Find the sequences in a multiple sequence alignment in fasta format that carry given mutations",
+	Long: `Find the sequences in a multiple sequence alignment in fasta format that carry given mutations
+
+Example usage:
+
+	./gofasta search --msa alignment.fasta --annotation MN908947.gb --reference MN908947.3 -q 'aa:S:E484K,del:21765:6' > matches.csv
+	./gofasta search --msa alignment.fasta --annotation MN908947.gb --reference MN908947.3 -q '(aa:S:E484K | aa:S:E484Q) & !aa:S:N501Y' > matches.csv
+
+Mutations are written as gofasta variants writes them (without anything appended): nuc:C241T, aa:S:E484K,
+aa:S:del69-70, aa:S:ins214EPE, ins:22204:9 or del:21765:6. A nucleotide change or indel is also found if it underlies
+an amino acid change. --query can be a comma-separated list of mutations, which must all be present, or a boolean
+expression of them using & (or "and"), | (or "or"), ! (or "not") and parentheses.
+
+--reference and --annotation are as for gofasta variants: --reference is the name of the reference record in --msa
+(which must be the first sequence if the --msa is read from stdin), and if you don't provide one the fasta record in
+the annotation file is used.
+
+The output is a csv file with one row per matching sequence: its name, whether it matches (true, false or unknown)
+and the status of each mutation in --query (present, absent, or unknown if it isn't present and the sequence has
+missing data, such as an N or gaps at its ends, where it would be). An expression is unknown if it depends on an
+unknown mutation, and only sequences that match are written unless you use --all.
+
+To search an alignment in sam format, use gofasta sam search.
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if searchQuery == "" {
+			return errors.New("no --query to search for")
+		}
+
+		msa, err := gfio.OpenIn(*cmd.Flag("msa"))
+		if err != nil {
+			return err
+		}
+		defer msa.Close()
+
+		stdin := false
+		if searchMSA == "stdin" {
+			stdin = true
+		}
+
+		var anno io.ReadCloser
+		anno, err = gfio.OpenIn(*cmd.Flag("annotation"))
+		if err != nil {
+			return err
+		}
+		defer anno.Close()
+
+		var annoSuffix string
+		switch gfio.Ext(searchAnnotation) {
+		case ".gb":
+			annoSuffix = "gb"
+		case ".gff":
+			annoSuffix = "gff"
+		default:
+			return errors.New("couldn't tell if --annotation was a .gb or a .gff file")
+		}
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = search.Search(msa, stdin, searchReference, anno, annoSuffix, searchQuery, out, searchAll, searchThreads)
+
+		return
+	},
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/stats"
+)
+
+var statsQuery string
+var statsReference string
+var statsFormat string
+var statsOutfile string
+var statsColumns string
+var statsThreads int
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringVarP(&statsQuery, "query", "q", "stdin", "Alignment of sequences to summarise, in fasta format")
+	statsCmd.Flags().StringVarP(&statsReference, "reference", "r", "", "(Optional) reference sequence, in fasta format, to count SNPs and indels relative to")
+	statsCmd.Flags().StringVarP(&statsFormat, "format", "f", "csv", "Output format (csv or json)")
+	statsCmd.Flags().StringVarP(&statsOutfile, "outfile", "o", "stdout", "Per-sequence summary to write")
+	statsCmd.Flags().StringVarP(&statsColumns, "columns", "", "", "(Optional) per-column summary of the whole alignment to write")
+	statsCmd.Flags().IntVarP(&statsThreads, "threads", "t", 1, "Number of threads to use")
+
+	statsCmd.Flags().SortFlags = false
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarise the sequences in an alignment",
+	Long: `Summarise the sequences in an alignment
+
+Example usage:
+	gofasta stats -q alignment.fasta -r reference.fasta -o stats.csv --columns columns.csv
+
+For each sequence in --query, the output has: its length (excluding alignment gaps), the number of
+each of A, C, G and T, the number of Ns (including ?), gaps, and other ambiguity codes (of which the
+two-base ones, RYSWKM, are also counted as het), the length of the longest run of Ns, and its completeness
+score (12 for each ATGC, 6 for each two-base ambiguity code, 4 for each three-base ambiguity code and 3 for
+anything else).
+
+If you provide --reference, which must be the same width as --query, the number of SNPs (counted in the same
+way as by gofasta snps), insertions and deletions relative to it are reported too. Gaps at the start or end of
+a sequence are not counted as deletions.
+
+--columns writes the number of each kind of character in each column of the alignment.
+
+The output is csv by default, or json with --format json.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var format string
+		switch strings.ToLower(statsFormat) {
+		case "csv":
+			format = "csv"
+		case "json":
+			format = "json"
+		default:
+			return errors.New("couldn't tell which --format to write (choose one of \"csv\" or \"json\")")
+		}
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		var ref io.ReadCloser
+		if statsReference != "" {
+			ref, err = gfio.OpenIn(*cmd.Flag("reference"))
+			if err != nil {
+				return err
+			}
+			defer ref.Close()
+		}
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		var columns io.WriteCloser
+		if statsColumns != "" {
+			columns, err = gfio.OpenOut(*cmd.Flag("columns"))
+			if err != nil {
+				return err
+			}
+			defer columns.Close()
+		}
+
+		err = stats.Stats(query, ref, format, out, columns, statsThreads)
+
+		return
+	},
+}
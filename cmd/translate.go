@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/translate"
+)
+
+var translateMSA string
+var translateReference string
+var translateAnnotation string
+var translateGenes []string
+var translateOutdir string
+var translateConcatenate bool
+var translateOutfile string
+var translatePartitions string
+var translateThreads int
+
+func init() {
+	rootCmd.AddCommand(translateCmd)
+
+	translateCmd.Flags().StringVarP(&translateMSA, "msa", "", "stdin", "Multiple sequence alignment in fasta format")
+	translateCmd.Flags().StringVarP(&translateReference, "reference", "r", "", "The ID of the reference record in the msa")
+	translateCmd.Flags().StringVarP(&translateAnnotation, "annotation", "a", "", "Genbank or GFF3 format annotation file. Must have suffix .gb or .gff")
+	translateCmd.Flags().StringSliceVarP(&translateGenes, "genes", "", []string{}, "(Optional) only translate these protein-coding regions, in this order. Can be given more than once, or as a comma-separated list")
+	translateCmd.Flags().StringVarP(&translateOutdir, "outdir", "", ".", "Directory to write one protein alignment per region to")
+	translateCmd.Flags().BoolVarP(&translateConcatenate, "concatenate", "", false, "Write one alignment with all the regions concatenated (to --outfile) instead")
+	translateCmd.Flags().StringVarP(&translateOutfile, "outfile", "o", "stdout", "If --concatenate, the concatenated protein alignment to write")
+	translateCmd.Flags().StringVarP(&translatePartitions, "partitions", "", "", "If --concatenate, (optional) nexus format file of the position of each region in the alignment to write")
+	translateCmd.Flags().IntVarP(&translateThreads, "threads", "t", 1, "Number of threads to use")
+
+	translateCmd.Flags().Lookup("concatenate").NoOptDefVal = "true"
+
+	translateCmd.Flags().SortFlags = false
+}
+
+var translateCmd = &cobra.Command{
+	Use:   "translate",
+	Short: "Make protein alignments from a nucleotide alignment",
+	Long: `Make protein alignments from a nucleotide alignment
+
+Example usage:
+	gofasta translate --msa alignment.fasta -a MN908947.gb --outdir proteins/
+	gofasta translate --msa alignment.fasta -a MN908947.gb --genes S,N --concatenate -o proteins.fasta --partitions proteins.nex
+
+The protein-coding regions are found in the annotation in the same way as by gofasta variants, and --reference
+works in the same way too. By default one protein alignment is written for each region, called <name>.fasta, to
+--outdir. With --concatenate, all the regions for each sequence are joined together into one alignment, and
+--partitions writes where each region is in it.
+
+Codons are read in the reading frame of the reference, and insertions relative to the reference are left out
+(so all the sequences are the same length). Codons that are entirely deleted are translated as -, and codons that
+can't be translated to one amino acid (e.g. because they have ambiguous bases or are only partly deleted) as X.`,
+
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		if translatePartitions != "" && !translateConcatenate {
+			return errors.New("--partitions only makes sense with --concatenate")
+		}
+
+		msa, err := gfio.OpenIn(*cmd.Flag("msa"))
+		if err != nil {
+			return err
+		}
+		defer msa.Close()
+
+		stdin := false
+		if translateMSA == "stdin" {
+			stdin = true
+		}
+
+		anno, err := gfio.OpenIn(*cmd.Flag("annotation"))
+		if err != nil {
+			return err
+		}
+		defer anno.Close()
+
+		var annoSuffix string
+		switch gfio.Ext(translateAnnotation) {
+		case ".gb":
+			annoSuffix = "gb"
+		case ".gff":
+			annoSuffix = "gff"
+		default:
+			return errors.New("couldn't tell if --annotation was a .gb or a .gff file")
+		}
+
+		var out, partitions io.WriteCloser
+		if translateConcatenate {
+			out, err = gfio.OpenOut(*cmd.Flag("outfile"))
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+
+			if translatePartitions != "" {
+				partitions, err = gfio.OpenOut(*cmd.Flag("partitions"))
+				if err != nil {
+					return err
+				}
+				defer partitions.Close()
+			}
+		} else {
+			err = os.MkdirAll(translateOutdir, 0755)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = translate.Translate(msa, stdin, translateReference, anno, annoSuffix, translateGenes, translateOutdir, out, partitions, translateThreads)
+
+		return
+	},
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/tree"
+)
+
+var treeThreads int
+var treeQuery string
+var treeReference string
+var treeMeasure string
+var treeOutfile string
+
+func init() {
+	rootCmd.AddCommand(treeCmd)
+
+	treeCmd.Flags().IntVarP(&treeThreads, "threads", "t", 0, "Number of CPUs to use (Default: all available CPUs)")
+	treeCmd.Flags().StringVarP(&treeQuery, "query", "q", "stdin", "Alignment of sequences to build a tree from, in fasta format")
+	treeCmd.Flags().StringVarP(&treeReference, "reference", "r", "", "(Optional) reference sequence, in fasta format, to root the tree on")
+	treeCmd.Flags().StringVarP(&treeMeasure, "measure", "m", "raw", "Which distance measure to use (raw, snp or tn93)")
+	treeCmd.Flags().StringVarP(&treeOutfile, "outfile", "o", "stdout", "Tree to write, in Newick format")
+
+	treeCmd.Flags().SortFlags = false
+}
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Build a neighbour-joining tree",
+	Long: `Build a neighbour-joining tree
+
+Example usage:
+
+	gofasta tree -t 4 -q alignment.fasta -o tree.nwk
+	gofasta tree -q alignment.fasta -r reference.fasta -m tn93 -o tree.nwk
+
+The tree is built by neighbour-joining (Saitou and Nei, 1987) from the pairwise distances between the sequences
+in --query, which can be any of the measures that gofasta closest uses: raw number of nucleotide changes per site
+(the default, raw), raw number of nucleotide changes in total (snp), or Tamura and Nei's 1993 evolutionary
+distance (tn93). Negative branch lengths are set to zero.
+
+Without a --reference the tree is written unrooted. With a --reference (which must be aligned to the same thing
+as --query, as for gofasta updown), it is added to the tree if there isn't a sequence with the same name in --query
+already, and the tree is rooted on the branch leading to it. The reference is also used to speed up the distance
+calculations in the same way as gofasta closest --reference.
+
+The full distance matrix is held in memory, and building the tree takes time proportional to the cube of the number
+of sequences, so this is meant for quick draft trees of up to a few thousand sequences.
+`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+
+		var measure string
+		switch strings.ToLower(treeMeasure) {
+		case "raw":
+			measure = "raw"
+		case "snp":
+			measure = "snp"
+		case "tn93":
+			measure = "tn93"
+		default:
+			return errors.New("couldn't tell which distance --measure / -m to use (choose one of \"raw\", \"snp\" or \"tn93\")")
+		}
+
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
+		}
+		defer query.Close()
+
+		var ref io.ReadCloser
+		if treeReference != "" {
+			ref, err = gfio.OpenIn(*cmd.Flag("reference"))
+			if err != nil {
+				return err
+			}
+			defer ref.Close()
+		}
+
+		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		err = tree.Tree(query, ref, measure, out, treeThreads)
+
+		return
+	},
+}
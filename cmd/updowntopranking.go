@@ -3,11 +3,12 @@ package cmd
 import (
 	"bufio"
 	"errors"
+	"io"
 	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 
+	"github.com/virus-evolution/gofasta/pkg/fasta"
 	"github.com/virus-evolution/gofasta/pkg/gfio"
 	"github.com/virus-evolution/gofasta/pkg/updown"
 )
@@ -103,29 +104,28 @@ you haven't also invoked --dist-push).
 `,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
-		var qtype string
-		var ttype string
-
-		switch filepath.Ext(TRquery) {
-		case ".csv":
-			qtype = "csv"
-		case ".fasta":
-			qtype = "fasta"
-		case ".fa":
-			qtype = "fasta"
-		default:
-			return errors.New("couldn't tell if --query was a .csv or a .fasta file")
+		query, err := gfio.OpenIn(*cmd.Flag("query"))
+		if err != nil {
+			return err
 		}
+		defer query.Close()
+		queryReader := bufio.NewReader(query)
 
-		switch filepath.Ext(TRtarget) {
-		case ".csv":
-			ttype = "csv"
-		case ".fasta":
-			ttype = "fasta"
-		case ".fa":
-			ttype = "fasta"
-		default:
-			return errors.New("couldn't tell if --target was a .csv or a .fasta file")
+		target, err := gfio.OpenIn(*cmd.Flag("target"))
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		targetReader := bufio.NewReader(target)
+
+		qtype, err := topRankingType(queryReader, TRquery, "--query")
+		if err != nil {
+			return err
+		}
+
+		ttype, err := topRankingType(targetReader, TRtarget, "--target")
+		if err != nil {
+			return err
 		}
 
 		if (qtype == "fasta" || ttype == "fasta") && len(udReference) == 0 {
@@ -150,26 +150,14 @@ you haven't also invoked --dist-push).
 			}
 		}
 
-		query, err := gfio.OpenIn(*cmd.Flag("query"))
-		if err != nil {
-			return err
-		}
-		defer query.Close()
-
-		target, err := gfio.OpenIn(*cmd.Flag("target"))
-		if err != nil {
-			return err
-		}
-		defer target.Close()
-
-		var ref *os.File
+		var ref io.ReadCloser
 		if qtype == "fasta" || ttype == "fasta" {
 			ref, err = gfio.OpenIn(*cmd.Flag("reference"))
 			if err != nil {
 				return err
 			}
+			defer ref.Close()
 		}
-		defer ref.Close()
 
 		out, err := gfio.OpenOut(*cmd.Flag("outfile"))
 		if err != nil {
@@ -177,7 +165,7 @@ you haven't also invoked --dist-push).
 		}
 		defer out.Close()
 
-		err = updown.TopRanking(query, target, ref, out, TRtable,
+		err = updown.TopRanking(queryReader, targetReader, ref, out, TRtable,
 			qtype, ttype, ignoreArray,
 			TRsizetotal, TRsizeup, TRsizedown, TRsizeside, TRsizesame,
 			TRdistall, TRdistup, TRdistdown, TRdistside,
@@ -186,3 +174,19 @@ you haven't also invoked --dist-push).
 		return
 	},
 }
+
+// topRankingType returns whether an input to updown topranking is csv or fasta. Pack files are recognised from
+// their contents, whatever they are called, and read like fasta alignments; otherwise the type comes from the
+// file's extension
+func topRankingType(r *bufio.Reader, path string, flag string) (string, error) {
+	if fasta.IsPack(r) {
+		return "fasta", nil
+	}
+	switch gfio.Ext(path) {
+	case ".csv":
+		return "csv", nil
+	case ".fasta", ".fa":
+		return "fasta", nil
+	}
+	return "", errors.New("couldn't tell if " + flag + " was a .csv or a .fasta file")
+}
@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"errors"
-	"os"
-	"path/filepath"
+	"io"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -20,8 +20,10 @@ var variantsAggregate bool
 var variantsThreshold float64
 var variantsAppendSNP bool
 var variantsAppendCodons bool // Add new flag variable
+var variantsAppendConsequence bool
 var variantsStart int
 var variantsEnd int
+var variantsFormat string
 
 // for backwards compatibility:
 var variantsGenbank string
@@ -39,11 +41,14 @@ func init() {
 	variantsCmd.Flags().Float64VarP(&variantsThreshold, "threshold", "", 0.0, "If --aggregate, only report changes with a freq greater than or equal to this value")
 	variantsCmd.Flags().BoolVarP(&variantsAppendSNP, "append-snps", "", false, "Report the codon's SNPs in parenthesis after each amino acid mutation")
 	variantsCmd.Flags().BoolVarP(&variantsAppendCodons, "append-codons", "", false, "Report the reference and alternate codons after each amino acid mutation") // Add new flag definition
+	variantsCmd.Flags().BoolVarP(&variantsAppendConsequence, "append-consequence", "", false, "Report the functional consequence of each mutation in parenthesis after it")
+	variantsCmd.Flags().StringVarP(&variantsFormat, "format", "", "csv", "Output format (csv, vcf, long or json)")
 	variantsCmd.Flags().IntVarP(&variantsThreads, "threads", "t", 1, "Number of threads to use")
 
 	variantsCmd.Flags().Lookup("aggregate").NoOptDefVal = "true"
 	variantsCmd.Flags().Lookup("append-snps").NoOptDefVal = "true"
 	variantsCmd.Flags().Lookup("append-codons").NoOptDefVal = "true" // Add NoOptDefVal for the new flag
+	variantsCmd.Flags().Lookup("append-consequence").NoOptDefVal = "true"
 
 	variantsCmd.Flags().StringVarP(&variantsGenbank, "genbank", "", "", "Genbank format annotation")
 	variantsCmd.Flags().MarkHidden("genbank")
@@ -81,8 +86,39 @@ isn't in a codon that is represented by an amino acid change). The formats are:
 	del:11288:9 - a 9-base deletion whose first missing nucleotide is at (1-based) position 11288 in reference coordinates
 	aa:s:D614G - the amino acid at (1-based) residue 614 in the S gene is a D in the reference and a G in this sequence
 	nuc:C3037T - the nucleotide at (1-based) position 3037 in reference coordinates is a C in the reference and a T in this sequence
+	aa:S:del69-70 - residues 69 to 70 of the S gene are deleted in this sequence
+	aa:S:ins214EPE - the residues EPE are inserted after (1-based) residue 214 of the S gene in this sequence
+
+In-frame insertions and deletions in coding sequence are reported both as nucleotide indels and as amino acid
+insertions and deletions. When an indel splits a codon, the residue that the codon which is left codes for is compared
+to the reference residues on either side of the indel, so that it is reported as an amino acid change only if it
+matches neither. Amino acids downstream of an in-frame indel are annotated as usual.
 
 Frame-shifting mutations in coding sequence are reported as indels but are ignored for subsequent amino-acids in the alignment.	
+
+Use --append-consequence to report the functional consequence of each mutation (as a Sequence Ontology term) in
+parenthesis after it, e.g. aa:S:D614G(missense_variant). The consequences are synonymous_variant, missense_variant,
+stop_gained, stop_lost, start_lost, inframe_insertion, inframe_deletion, frameshift_variant, 5_prime_UTR_variant,
+3_prime_UTR_variant and intergenic_variant (and coding_sequence_variant for a change to a codon that can't be
+translated, e.g. to an ambiguous base). Non-coding changes before the first or after the last coding sequence in the
+annotation are UTR variants (5' or 3' of that coding sequence, given its strand), and those between coding sequences
+are intergenic. If a non-coding change is inside a non-coding feature of the annotation (such as a 5'UTR or a gene),
+the name of the smallest one is given after its consequence, e.g. nuc:C241T(5_prime_UTR_variant:5'UTR).
+
+Mature peptides in the annotation (mat_peptide features in genbank files, or mature_protein_region_of_CDS features in
+gff files) are annotated as well as the CDSs they are in, with residues numbered from the start of the peptide. A
+mat_peptide is named by its standard_name, a one-word note, its product or its gene, in that order.
+
+Use --format vcf to write VCF (version 4.3) instead of csv. By default there is one haploid genotype column per sequence
+in --msa; with --aggregate a sites-only file is written whose INFO fields carry the count (AC) and frequency (AF) of each
+allele. Indels are anchored on the preceding reference base and amino acid changes are given in the AA INFO field. A
+sequence whose base at a site is N, an ambiguity code or missing from the ends of the alignment has the genotype ".",
+and isn't counted in AN or AF.
+
+Use --format long to write one csv row per mutation per sequence, with the parts of each mutation in their own columns
+(query, reference, type, feature, position, residue, ref_allele, alt_allele, length, ref_codon, alt_codon, snps and
+consequence), or --format json to write one json object per sequence per line, with its mutations in an array. Neither
+can be used with --aggregate. Sequences with no mutations have no rows in long format.
 `,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 
@@ -97,8 +133,22 @@ Frame-shifting mutations in coding sequence are reported as indels but are ignor
 			stdin = true
 		}
 
+		var format string
+		switch strings.ToLower(variantsFormat) {
+		case "csv":
+			format = "csv"
+		case "vcf":
+			format = "vcf"
+		case "long":
+			format = "long"
+		case "json":
+			format = "json"
+		default:
+			return errors.New("couldn't tell which --format to write (choose one of \"csv\", \"vcf\", \"long\" or \"json\")")
+		}
+
 		// some backwards compatibility wrangling of --genbank vs --annotation
-		var anno *os.File
+		var anno io.ReadCloser
 		var annoSuffix string
 		if variantsGenbank != "" {
 			if variantsAnnotation != "" {
@@ -114,7 +164,7 @@ Frame-shifting mutations in coding sequence are reported as indels but are ignor
 			if err != nil {
 				return err
 			}
-			switch filepath.Ext(variantsAnnotation) {
+			switch gfio.Ext(variantsAnnotation) {
 			case ".gb":
 				annoSuffix = "gb"
 			case ".gff":
@@ -131,7 +181,18 @@ Frame-shifting mutations in coding sequence are reported as indels but are ignor
 		}
 		defer out.Close()
 
-		err = variants.Variants(msa, stdin, variantsReference, anno, annoSuffix, out, variantsStart, variantsEnd, variantsAggregate, variantsThreshold, variantsAppendSNP, variantsAppendCodons, variantsThreads) // Pass new flag
+		o := variants.Options{
+			Start:             variantsStart,
+			End:               variantsEnd,
+			Aggregate:         variantsAggregate,
+			Threshold:         variantsThreshold,
+			AppendSNP:         variantsAppendSNP,
+			AppendCodons:      variantsAppendCodons,
+			AppendConsequence: variantsAppendConsequence,
+			Format:            format,
+		}
+
+		err = variants.Variants(msa, stdin, variantsReference, anno, annoSuffix, out, o, variantsThreads)
 
 		return
 	},
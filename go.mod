@@ -4,8 +4,10 @@ go 1.23
 
 require (
 	github.com/biogo/hts v1.2.1
+	github.com/klauspost/compress v1.17.11
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/pflag v1.0.5
+	github.com/ulikunitz/xz v0.5.17
 	golang.org/x/exp v0.0.0-20230116083435-1de6713980de
 )
 
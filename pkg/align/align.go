@@ -0,0 +1,431 @@
+/*
+Package align implements a reference aligner for assembled genomes, which writes pairwise alignments in
+sam format (for the gofasta sam commands) or a multiple sequence alignment in reference coordinates.
+
+Alignments are seeded with k-mers which occur once in the reference, chained, and the gaps between (and
+beyond) the seeds are filled in with banded affine-gap dynamic programming.
+*/
+package align
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/alphabet"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+	"github.com/virus-evolution/gofasta/pkg/sam"
+)
+
+// samRecord is one line of sam output
+type samRecord struct {
+	flag    int
+	pos     int // 0-based
+	cigar   []cigarOp
+	reverse bool
+	nm      int
+	score   int32
+}
+
+// alignedQuery is all the sam records for one query
+type alignedQuery struct {
+	id      string
+	idx     int
+	seq     []byte
+	records []samRecord
+}
+
+// aligner holds what is needed to align queries to one reference
+type aligner struct {
+	ref   []byte
+	refID string
+	idx   index
+	band  int
+	sc    scoring
+}
+
+// clean returns a sequence in upper case, without any alignment gaps
+func clean(seq string) []byte {
+	b := make([]byte, 0, len(seq))
+	for i := 0; i < len(seq); i++ {
+		if seq[i] != '-' {
+			b = append(b, seq[i])
+		}
+	}
+	return bytes.ToUpper(b)
+}
+
+func newAligner(ref fasta.Record, band int) aligner {
+	seq := clean(ref.Seq)
+	return aligner{ref: seq, refID: ref.ID, idx: newIndex(seq), band: band, sc: defaultScoring}
+}
+
+// core aligns the query between the first and the last anchor of a chain, and returns the operations and
+// the start and end of the alignment in the query (in the chain's orientation) and the reference
+func (al aligner) core(q []byte, anchors []anchor) ([]cigarOp, int, int, int, int) {
+	ops := make([]cigarOp, 0)
+	curQ, curR := anchors[0].q, anchors[0].r
+	for _, a := range anchors {
+		if a.q < curQ || a.r < curR {
+			// this anchor overlaps the alignment so far, which can be extended if it is on the same diagonal
+			if a.diagonal() == curR-curQ && a.q+k > curQ {
+				ops = appendOps(ops, cigarOp{op: 'M', len: a.q + k - curQ})
+				curR += a.q + k - curQ
+				curQ = a.q + k
+			}
+			continue
+		}
+		ops = appendOps(ops, globalAlign(q[curQ:a.q], al.ref[curR:a.r], al.band, al.sc)...)
+		ops = appendOps(ops, cigarOp{op: 'M', len: k})
+		curQ, curR = a.q+k, a.r+k
+	}
+	return ops, anchors[0].q, curQ, anchors[0].r, curR
+}
+
+// extend extends an alignment of q[qStart:qEnd] to ref[rStart:rEnd] in both directions, using no query
+// outside of [qLo, qHi), and returns the sam record (which soft clips whatever isn't aligned)
+func (al aligner) extend(q []byte, ops []cigarOp, qStart, qEnd, rStart, rEnd, qLo, qHi int) samRecord {
+
+	// left, by aligning the reversed sequences
+	lq := reverse(q[qLo:qStart])
+	rFrom := rStart - len(lq) - al.band
+	if rFrom < 0 {
+		rFrom = 0
+	}
+	lr := reverse(al.ref[rFrom:rStart])
+	leftOps, lqn, lrn := extendAlign(lq, lr, al.band, al.sc)
+
+	// right
+	rq := q[qEnd:qHi]
+	rTo := rEnd + len(rq) + al.band
+	if rTo > len(al.ref) {
+		rTo = len(al.ref)
+	}
+	rightOps, rqn, _ := extendAlign(rq, al.ref[rEnd:rTo], al.band, al.sc)
+
+	cigar := appendOps([]cigarOp{}, cigarOp{op: 'S', len: qStart - lqn})
+	cigar = appendOps(cigar, reverseOps(leftOps)...)
+	cigar = appendOps(cigar, ops...)
+	cigar = appendOps(cigar, rightOps...)
+	cigar = appendOps(cigar, cigarOp{op: 'S', len: len(q) - qEnd - rqn})
+
+	rec := samRecord{pos: rStart - lrn, cigar: cigar}
+	rec.nm, rec.score = al.stats(q, rec)
+	return rec
+}
+
+// stats returns the edit distance to the reference and the alignment score for a record
+func (al aligner) stats(q []byte, rec samRecord) (int, int32) {
+	nm := 0
+	var score int32
+	qi, ri := 0, rec.pos
+	for _, op := range rec.cigar {
+		switch op.op {
+		case 'S':
+			qi += op.len
+		case 'M':
+			for x := 0; x < op.len; x++ {
+				if q[qi+x] != al.ref[ri+x] {
+					nm++
+				}
+				score += al.sc.score(q[qi+x], al.ref[ri+x])
+			}
+			qi += op.len
+			ri += op.len
+		case 'I':
+			nm += op.len
+			score -= al.sc.gapOpen + int32(op.len)*al.sc.gapExtend
+			qi += op.len
+		case 'D':
+			nm += op.len
+			score -= al.sc.gapOpen + int32(op.len)*al.sc.gapExtend
+			ri += op.len
+		}
+	}
+	return nm, score
+}
+
+// align aligns one query to the reference. The first record is the primary alignment, and any others are
+// supplementary alignments of parts of the query which aren't in the primary alignment (e.g. because of a
+// rearrangement relative to the reference). If no part of the query can be aligned, there is one unmapped record.
+func (al aligner) align(seq []byte) []samRecord {
+	rc := []byte(alphabet.ReverseComplement(string(seq)))
+
+	chains := findChains(findAnchors(al.idx, seq), findAnchors(al.idx, rc), len(seq))
+	if len(chains) == 0 {
+		return []samRecord{{flag: 4}}
+	}
+
+	records := make([]samRecord, len(chains))
+	for i, c := range chains {
+		// the query that this chain can be extended into is bounded by the chains either side of it
+		lo, hi := 0, len(seq)
+		for j, o := range chains {
+			if j == i {
+				continue
+			}
+			if o.span.end <= c.span.start && o.span.end > lo {
+				lo = o.span.end
+			}
+			if o.span.start >= c.span.end && o.span.start < hi {
+				hi = o.span.start
+			}
+		}
+
+		q := seq
+		if c.reverse {
+			q = rc
+			lo, hi = len(seq)-hi, len(seq)-lo
+		}
+
+		ops, qStart, qEnd, rStart, rEnd := al.core(q, c.anchors)
+		records[i] = al.extend(q, ops, qStart, qEnd, rStart, rEnd, lo, hi)
+		records[i].reverse = c.reverse
+		if c.reverse {
+			records[i].flag |= 16
+		}
+		if i > 0 {
+			records[i].flag |= 2048
+		}
+	}
+
+	return records
+}
+
+func reverse(s []byte) []byte {
+	r := make([]byte, len(s))
+	for i, b := range s {
+		r[len(s)-1-i] = b
+	}
+	return r
+}
+
+func cigarString(cigar []cigarOp) string {
+	var sb strings.Builder
+	for _, op := range cigar {
+		sb.WriteString(strconv.Itoa(op.len))
+		sb.WriteByte(op.op)
+	}
+	return sb.String()
+}
+
+// formatRecords formats all the sam records for one query
+func formatRecords(aq alignedQuery, refID string) string {
+	var sb strings.Builder
+
+	var rc []byte
+	for i, rec := range aq.records {
+		if rec.flag&4 != 0 {
+			sb.WriteString(aq.id + "\t4\t*\t0\t0\t*\t*\t0\t0\t" + string(aq.seq) + "\t*\n")
+			continue
+		}
+
+		seq := aq.seq
+		if rec.reverse {
+			if rc == nil {
+				rc = []byte(alphabet.ReverseComplement(string(aq.seq)))
+			}
+			seq = rc
+		}
+		fields := []string{
+			aq.id,
+			strconv.Itoa(rec.flag),
+			refID,
+			strconv.Itoa(rec.pos + 1),
+			"60",
+			cigarString(rec.cigar),
+			"*", "0", "0",
+			string(seq),
+			"*",
+			"NM:i:" + strconv.Itoa(rec.nm),
+			"AS:i:" + strconv.Itoa(int(rec.score)),
+		}
+
+		// the SA tag lists the other records for this query
+		if len(aq.records) > 1 {
+			others := make([]string, 0, len(aq.records)-1)
+			for j, o := range aq.records {
+				if j == i {
+					continue
+				}
+				s := "+"
+				if o.reverse {
+					s = "-"
+				}
+				others = append(others, refID+","+strconv.Itoa(o.pos+1)+","+s+","+cigarString(o.cigar)+",60,"+strconv.Itoa(o.nm)+";")
+			}
+			fields = append(fields, "SA:Z:"+strings.Join(others, ""))
+		}
+
+		sb.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+
+	return sb.String()
+}
+
+// writeSAM writes the sam header, then each query's records in input order
+func writeSAM(w io.Writer, al aligner, cAligned chan alignedQuery, cErr chan error, cWriteDone chan bool) {
+	_, err := w.Write([]byte("@HD\tVN:1.6\tSO:unsorted\n@SQ\tSN:" + al.refID + "\tLN:" + strconv.Itoa(len(al.ref)) + "\n@PG\tID:gofasta\tPN:gofasta\n"))
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	outputMap := make(map[int]alignedQuery)
+	counter := 0
+	for aq := range cAligned {
+		outputMap[aq.idx] = aq
+		for {
+			if aq, ok := outputMap[counter]; ok {
+				_, err = w.Write([]byte(formatRecords(aq, al.refID)))
+				if err != nil {
+					cErr <- err
+					return
+				}
+				delete(outputMap, counter)
+				counter++
+			} else {
+				break
+			}
+		}
+	}
+	cWriteDone <- true
+}
+
+// readQueries reads unaligned (or aligned, in which case they are degapped) sequences to a channel
+func readQueries(f io.Reader, cQ chan alignedQuery, cErr chan error, cDone chan bool) {
+	r := fasta.NewReader(f)
+	counter := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cErr <- err
+			return
+		}
+		cQ <- alignedQuery{id: record.ID, idx: counter, seq: clean(record.Seq)}
+		counter++
+	}
+	cDone <- true
+}
+
+// alignSAM aligns every query to the reference and writes the alignments in sam format
+func alignSAM(queryIn io.Reader, al aligner, out io.Writer, threads int) error {
+
+	cErr := make(chan error)
+
+	cQ := make(chan alignedQuery, threads)
+	cReadDone := make(chan bool)
+
+	cAligned := make(chan alignedQuery, threads)
+	cAlignDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go readQueries(queryIn, cQ, cErr, cReadDone)
+
+	go writeSAM(out, al, cAligned, cErr, cWriteDone)
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			for aq := range cQ {
+				aq.records = al.align(aq.seq)
+				cAligned <- aq
+			}
+			wg.Done()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cAlignDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cQ)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cAlignDone:
+			close(cAligned)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
+
+// Align aligns every sequence in queryIn (in fasta format) to the first sequence in refIn. If format is "sam",
+// the pairwise alignments are written in sam format, with soft-clipped supplementary records for any parts of
+// a query which align elsewhere in the reference (e.g. because of a rearrangement). If format is "fasta", the
+// alignments are written as a multiple sequence alignment in reference coordinates, in the same way as gofasta
+// sam toMultiAlign does (so insertions relative to the reference are left out). band is how far alignments can
+// stray from the diagonals between seeds, which limits the size of indels that aren't bridged by seeds.
+func Align(queryIn, refIn io.Reader, format string, band int, out io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	if band < 1 {
+		return errors.New("the band must be at least 1")
+	}
+
+	ref, err := fasta.NewReader(refIn).Read()
+	if err == io.EOF {
+		return errors.New("empty reference file")
+	}
+	if err != nil {
+		return err
+	}
+	al := newAligner(ref, band)
+
+	switch format {
+	case "sam":
+		return alignSAM(queryIn, al, out, threads)
+	case "fasta":
+		pr, pw := io.Pipe()
+		cTomaErr := make(chan error)
+		go func() {
+			err := sam.ToMultiAlign(pr, out, 0, -1, -1, false, false, threads)
+			pr.CloseWithError(err)
+			cTomaErr <- err
+		}()
+		err = alignSAM(queryIn, al, pw, threads)
+		pw.CloseWithError(err)
+		tomaErr := <-cTomaErr
+		if err != nil {
+			return err
+		}
+		return tomaErr
+	default:
+		return errors.New("unknown output format: " + format)
+	}
+}
@@ -0,0 +1,110 @@
+package align
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/virus-evolution/gofasta/pkg/alphabet"
+)
+
+// randomSeq returns a random nucleotide sequence that is the same every time
+func randomSeq(n int) string {
+	r := rand.New(rand.NewSource(42))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = "ACGT"[r.Intn(4)]
+	}
+	return string(b)
+}
+
+func TestAlignSAM(t *testing.T) {
+	ref := randomSeq(2000)
+
+	snp := []byte(ref[510:])
+	snp[490] = "ACGT"[(strings.IndexByte("ACGT", snp[490])+1)%4]
+
+	queries := []struct {
+		id    string
+		seq   string
+		lines []string // everything up to and including the cigar for each record
+	}{
+		{"identical", ref, []string{"identical\t0\tref\t1\t60\t2000M"}},
+		{"deletion", ref[:500] + string(snp), []string{"deletion\t0\tref\t1\t60\t500M10D1490M"}},
+		{"insertion", ref[:800] + "GATTACA" + ref[800:], []string{"insertion\t0\tref\t1\t60\t800M7I1200M"}},
+		{"reverse", alphabet.ReverseComplement(ref), []string{"reverse\t16\tref\t1\t60\t2000M"}},
+		{"ends", "NNNNN" + ref[100:1900], []string{"ends\t0\tref\t101\t60\t5S1800M"}},
+		{"rearranged", ref[1200:] + ref[:1200], []string{"rearranged\t0\tref\t1\t60\t800S1200M", "rearranged\t2048\tref\t1201\t60\t800M1200S"}},
+		{"unmapped", strings.Repeat("N", 100), []string{"unmapped\t4\t*\t0\t0\t*"}},
+	}
+
+	var in bytes.Buffer
+	for _, q := range queries {
+		in.WriteString(">" + q.id + "\n" + q.seq + "\n")
+	}
+
+	out := new(bytes.Buffer)
+	err := Align(&in, strings.NewReader(">ref\n"+ref+"\n"), "sam", 100, out, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if lines[0] != "@HD\tVN:1.6\tSO:unsorted" || lines[1] != "@SQ\tSN:ref\tLN:2000" {
+		t.Errorf("problem in TestAlignSAM (header)")
+		t.Error(lines[:3])
+	}
+
+	lines = lines[3:]
+	i := 0
+	for _, q := range queries {
+		for _, desired := range q.lines {
+			if i >= len(lines) || !strings.HasPrefix(lines[i], desired+"\t") {
+				t.Errorf("problem in TestAlignSAM (%s)", q.id)
+				if i < len(lines) {
+					t.Error(strings.Join(strings.Split(lines[i], "\t")[:6], "\t"))
+				}
+			}
+			i++
+		}
+	}
+	if i != len(lines) {
+		t.Errorf("problem in TestAlignSAM: expected %d records but got %d", i, len(lines))
+	}
+
+	if !strings.Contains(lines[1], "\tNM:i:11\t") {
+		t.Errorf("problem in TestAlignSAM (NM)")
+		t.Error(lines[1])
+	}
+}
+
+func TestAlignFasta(t *testing.T) {
+	ref := randomSeq(2000)
+
+	query := ref[:500] + ref[510:800] + "GATTACA" + ref[800:1900]
+
+	out := new(bytes.Buffer)
+	err := Align(strings.NewReader(">q1\n"+alphabet.ReverseComplement(query)+"\n>q2\n"+ref+"\n"), strings.NewReader(">ref\n"+ref+"\n"), "fasta", 100, out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := ">q1\n" + ref[:500] + strings.Repeat("-", 10) + ref[510:1900] + strings.Repeat("-", 100) + "\n>q2\n" + ref + "\n"
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestAlignFasta")
+		t.Error(out.String())
+	}
+}
+
+func TestBandedAlign(t *testing.T) {
+	ops := globalAlign([]byte("ACGTTTACGT"), []byte("ACGTACGT"), 5, defaultScoring)
+	if cigarString(ops) != "4M2I4M" && cigarString(ops) != "3M2I5M" && cigarString(ops) != "5M2I3M" {
+		t.Errorf("problem in TestBandedAlign (global): %s", cigarString(ops))
+	}
+
+	ops, qn, rn := extendAlign([]byte("ACGTANNNNNNNN"), []byte("ACGTACCCCCCCCCC"), 5, defaultScoring)
+	if cigarString(ops) != "5M" || qn != 5 || rn != 5 {
+		t.Errorf("problem in TestBandedAlign (extend): %s %d %d", cigarString(ops), qn, rn)
+	}
+}
@@ -0,0 +1,205 @@
+package align
+
+import (
+	"sort"
+)
+
+// k is the length of the k-mers that seed alignments
+const k = 15
+
+// minAnchors is the fewest anchors a chain needs to be aligned
+const minAnchors = 5
+
+// maxIndel is the largest change in diagonal between two anchors in the same chain. Bigger jumps
+// split the chain, and the pieces are aligned separately (as supplementary alignments)
+const maxIndel = 5000
+
+var nucBits = func() [256]int8 {
+	var a [256]int8
+	for i := range a {
+		a[i] = -1
+	}
+	a['A'], a['C'], a['G'], a['T'] = 0, 1, 2, 3
+	return a
+}()
+
+// index maps the k-mers that occur once in the reference to their positions
+type index map[uint32]int
+
+// newIndex indexes the k-mers in a reference sequence, leaving out those that occur more than once
+func newIndex(ref []byte) index {
+	idx := make(index)
+	forEachKmer(ref, func(pos int, kmer uint32) {
+		if _, ok := idx[kmer]; ok {
+			idx[kmer] = -1
+		} else {
+			idx[kmer] = pos
+		}
+	})
+	return idx
+}
+
+// forEachKmer calls fn for each k-mer in seq (that has no bases other than A, C, G or T) with its start position
+func forEachKmer(seq []byte, fn func(int, uint32)) {
+	var kmer uint32
+	mask := uint32(1)<<(2*k) - 1
+	valid := 0
+	for i, nuc := range seq {
+		b := nucBits[nuc]
+		if b < 0 {
+			valid = 0
+			continue
+		}
+		kmer = (kmer<<2 | uint32(b)) & mask
+		valid++
+		if valid >= k {
+			fn(i-k+1, kmer)
+		}
+	}
+}
+
+// anchor is an exact k-mer match between a query (in one orientation) and the reference
+type anchor struct {
+	q int
+	r int
+}
+
+func (a anchor) diagonal() int {
+	return a.r - a.q
+}
+
+// findAnchors returns the anchors between a query and the reference, in order of their query position
+func findAnchors(idx index, q []byte) []anchor {
+	anchors := make([]anchor, 0)
+	forEachKmer(q, func(pos int, kmer uint32) {
+		if r, ok := idx[kmer]; ok && r >= 0 {
+			anchors = append(anchors, anchor{q: pos, r: r})
+		}
+	})
+	return anchors
+}
+
+// longestChain returns the longest chain of anchors that are in the same order in the query and the reference,
+// from anchors that are in query order
+func longestChain(anchors []anchor) []anchor {
+	if len(anchors) == 0 {
+		return []anchor{}
+	}
+	// patience sorting: tails[l] is the index of the anchor that ends the best chain of length l+1
+	tails := make([]int, 0)
+	prev := make([]int, len(anchors))
+	for i, a := range anchors {
+		l := sort.Search(len(tails), func(x int) bool { return anchors[tails[x]].r >= a.r })
+		if l > 0 {
+			prev[i] = tails[l-1]
+		} else {
+			prev[i] = -1
+		}
+		if l == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[l] = i
+		}
+	}
+	chain := make([]anchor, len(tails))
+	for i, x := len(tails)-1, tails[len(tails)-1]; i >= 0; i, x = i-1, prev[x] {
+		chain[i] = anchors[x]
+	}
+	return chain
+}
+
+// splitChain splits a chain wherever the diagonal jumps by more than maxIndel, and returns the piece that
+// spans the most query
+func splitChain(chain []anchor) []anchor {
+	best, bestSpan := []anchor{}, 0
+	start := 0
+	for i := 1; i <= len(chain); i++ {
+		if i < len(chain) {
+			d := chain[i].diagonal() - chain[i-1].diagonal()
+			if d <= maxIndel && d >= -maxIndel {
+				continue
+			}
+		}
+		piece := chain[start:i]
+		span := piece[len(piece)-1].q + k - piece[0].q
+		if span > bestSpan {
+			best, bestSpan = piece, span
+		}
+		start = i
+	}
+	return best
+}
+
+// interval is a half-open range of query positions, in the query's original orientation
+type interval struct {
+	start int
+	end   int
+}
+
+func overlaps(a interval, covered []interval) bool {
+	for _, c := range covered {
+		if a.start < c.end && c.start < a.end {
+			return true
+		}
+	}
+	return false
+}
+
+// chain is a set of colinear anchors on one strand of the query
+type chain struct {
+	reverse bool
+	anchors []anchor
+	span    interval // the query covered by the anchors, in the query's original orientation
+}
+
+// findChains finds the chain of anchors which covers the most query, then the best chain in the parts of the
+// query that aren't covered by it, and so on, until no chain with enough anchors is left. fwd and rev are
+// the anchors for the query and its reverse complement, and qLen is the length of the query.
+func findChains(fwd, rev []anchor, qLen int) []chain {
+	chains := make([]chain, 0)
+	covered := make([]interval, 0)
+
+	toForward := func(a anchor, reverse bool) interval {
+		if reverse {
+			return interval{start: qLen - a.q - k, end: qLen - a.q}
+		}
+		return interval{start: a.q, end: a.q + k}
+	}
+
+	for {
+		var best chain
+		bestSpan := 0
+		for _, reverse := range []bool{false, true} {
+			anchors := fwd
+			if reverse {
+				anchors = rev
+			}
+			free := make([]anchor, 0, len(anchors))
+			for _, a := range anchors {
+				if !overlaps(toForward(a, reverse), covered) {
+					free = append(free, a)
+				}
+			}
+			piece := splitChain(longestChain(free))
+			if len(piece) < minAnchors {
+				continue
+			}
+			span := piece[len(piece)-1].q + k - piece[0].q
+			if span > bestSpan {
+				first, last := toForward(piece[0], reverse), toForward(piece[len(piece)-1], reverse)
+				s := interval{start: first.start, end: last.end}
+				if reverse {
+					s = interval{start: last.start, end: first.end}
+				}
+				best, bestSpan = chain{reverse: reverse, anchors: piece, span: s}, span
+			}
+		}
+		if bestSpan == 0 {
+			break
+		}
+		chains = append(chains, best)
+		covered = append(covered, best.span)
+	}
+
+	return chains
+}
@@ -0,0 +1,236 @@
+package align
+
+import (
+	"math"
+)
+
+// cigarOp is one run of a CIGAR operation
+type cigarOp struct {
+	op  byte // 'M', 'I', 'D' or 'S'
+	len int
+}
+
+// scoring is the scoring scheme for pairwise alignment. A gap of length L costs gapOpen + L*gapExtend
+type scoring struct {
+	match     int32
+	mismatch  int32
+	ambiguous int32 // the penalty for aligning anything to a base that isn't A, C, G or T
+	gapOpen   int32
+	gapExtend int32
+}
+
+// defaultScoring is the same as minimap2's asm presets, more or less
+var defaultScoring = scoring{match: 2, mismatch: 4, ambiguous: 1, gapOpen: 4, gapExtend: 2}
+
+var isACGT = [256]bool{'A': true, 'C': true, 'G': true, 'T': true}
+
+func (s scoring) score(a, b byte) int32 {
+	if !isACGT[a] || !isACGT[b] {
+		return -s.ambiguous
+	}
+	if a == b {
+		return s.match
+	}
+	return -s.mismatch
+}
+
+const negInf = math.MinInt32 / 2
+
+// traceback bits: the low two bits are where H came from, and the next two whether E and F were extended
+const (
+	fromDiag = 0
+	fromE    = 1
+	fromF    = 2
+	extE     = 4
+	extF     = 8
+)
+
+// bandedAlign aligns query q to reference r with affine gaps (Gotoh), considering only cells whose diagonal
+// (j-i, for q[i] and r[j]) is between lo and hi inclusive. lo must be <= 0 <= hi. The alignment starts at
+// the start of both sequences. If global is true it ends at the end of both sequences (and m-n must be
+// inside the band), otherwise it ends wherever the score is highest, which is how alignments are extended
+// out from an anchor. It returns the operations, the score, and how much of q and r are used.
+func bandedAlign(q, r []byte, lo, hi int, global bool, sc scoring) ([]cigarOp, int32, int, int) {
+	n, m := len(q), len(r)
+	W := hi - lo + 1
+
+	Hprev, Hcur := make([]int32, W), make([]int32, W)
+	Eprev, Ecur := make([]int32, W), make([]int32, W)
+	Fprev, Fcur := make([]int32, W), make([]int32, W)
+	tb := make([]byte, (n+1)*W)
+
+	openExt := sc.gapOpen + sc.gapExtend
+
+	var best int32
+	bi, bj := 0, 0
+
+	for i := 0; i <= n; i++ {
+		for k := range Hcur {
+			Hcur[k], Ecur[k], Fcur[k] = negInf, negInf, negInf
+		}
+		jStart, jEnd := i+lo, i+hi
+		if jStart < 0 {
+			jStart = 0
+		}
+		if jEnd > m {
+			jEnd = m
+		}
+		for j := jStart; j <= jEnd; j++ {
+			k := j - i - lo
+			var t byte
+			if i == 0 && j == 0 {
+				Hcur[k] = 0
+				tb[k] = t
+				continue
+			}
+
+			// deletion: r[j-1] against a gap, from (i, j-1)
+			e := int32(negInf)
+			if j > 0 && k > 0 {
+				e = Hcur[k-1] - openExt
+				if x := Ecur[k-1] - sc.gapExtend; x > e {
+					e = x
+					t |= extE
+				}
+			}
+			// insertion: q[i-1] against a gap, from (i-1, j)
+			f := int32(negInf)
+			if i > 0 && k+1 < W {
+				f = Hprev[k+1] - openExt
+				if x := Fprev[k+1] - sc.gapExtend; x > f {
+					f = x
+					t |= extF
+				}
+			}
+			h := int32(negInf)
+			src := byte(fromDiag)
+			if i > 0 && j > 0 && Hprev[k] > negInf {
+				h = Hprev[k] + sc.score(q[i-1], r[j-1])
+			}
+			if e > h {
+				h = e
+				src = fromE
+			}
+			if f > h {
+				h = f
+				src = fromF
+			}
+
+			Hcur[k], Ecur[k], Fcur[k] = h, e, f
+			tb[i*W+k] = t | src
+
+			if !global && h > best {
+				best, bi, bj = h, i, j
+			}
+		}
+		Hprev, Hcur = Hcur, Hprev
+		Eprev, Ecur = Ecur, Eprev
+		Fprev, Fcur = Fcur, Fprev
+	}
+
+	if global {
+		bi, bj = n, m
+		best = Hprev[m-n-lo]
+	}
+
+	// trace back from (bi, bj)
+	ops := make([]cigarOp, 0)
+	push := func(op byte) {
+		if len(ops) > 0 && ops[len(ops)-1].op == op {
+			ops[len(ops)-1].len++
+		} else {
+			ops = append(ops, cigarOp{op: op, len: 1})
+		}
+	}
+	i, j := bi, bj
+	state := byte(fromDiag)
+	for i > 0 || j > 0 {
+		t := tb[i*W+j-i-lo]
+		switch state {
+		case fromDiag:
+			switch t & 3 {
+			case fromDiag:
+				push('M')
+				i--
+				j--
+			case fromE:
+				state = fromE
+			case fromF:
+				state = fromF
+			}
+		case fromE:
+			push('D')
+			j--
+			if t&extE == 0 {
+				state = fromDiag
+			}
+		case fromF:
+			push('I')
+			i--
+			if t&extF == 0 {
+				state = fromDiag
+			}
+		}
+	}
+	for a, b := 0, len(ops)-1; a < b; a, b = a+1, b-1 {
+		ops[a], ops[b] = ops[b], ops[a]
+	}
+
+	return ops, best, bi, bj
+}
+
+// globalAlign aligns all of q to all of r, in a band of width band either side of the diagonals
+// between the start and the end of the alignment
+func globalAlign(q, r []byte, band int, sc scoring) []cigarOp {
+	n, m := len(q), len(r)
+	switch {
+	case n == 0 && m == 0:
+		return []cigarOp{}
+	case n == 0:
+		return []cigarOp{{op: 'D', len: m}}
+	case m == 0:
+		return []cigarOp{{op: 'I', len: n}}
+	}
+	lo, hi := -band, band
+	if m-n < 0 {
+		lo += m - n
+	} else {
+		hi += m - n
+	}
+	ops, _, _, _ := bandedAlign(q, r, lo, hi, true, sc)
+	return ops
+}
+
+// extendAlign extends an alignment from the start of q and r for as long as it is worth it, and returns the
+// operations and how much of q and r they use
+func extendAlign(q, r []byte, band int, sc scoring) ([]cigarOp, int, int) {
+	if len(q) == 0 || len(r) == 0 {
+		return []cigarOp{}, 0, 0
+	}
+	ops, _, qn, rn := bandedAlign(q, r, -band, band, false, sc)
+	return ops, qn, rn
+}
+
+// appendOps appends the operations in b to a, merging runs of the same operation
+func appendOps(a []cigarOp, b ...cigarOp) []cigarOp {
+	for _, op := range b {
+		if op.len == 0 {
+			continue
+		}
+		if len(a) > 0 && a[len(a)-1].op == op.op {
+			a[len(a)-1].len += op.len
+		} else {
+			a = append(a, op)
+		}
+	}
+	return a
+}
+
+// reverseOps returns the operations in reverse order
+func reverseOps(ops []cigarOp) []cigarOp {
+	rev := make([]cigarOp, len(ops))
+	for i, op := range ops {
+		rev[len(ops)-1-i] = op
+	}
+	return rev
+}
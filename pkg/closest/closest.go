@@ -14,7 +14,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/virus-evolution/gofasta/pkg/encoding"
 	"github.com/virus-evolution/gofasta/pkg/fasta"
 )
 
@@ -46,7 +45,8 @@ func rawDistance(query, target fasta.EncodedRecord) float64 {
 	return distance
 }
 
-// TO DO - have this operate on the lists of snps not the entire sequences
+// snpDistance counts the sites at which two sequences certainly differ, comparing the entire sequences (see
+// snpDistanceSparse for the version that only compares their differences from the reference)
 func snpDistance(query, target fasta.EncodedRecord) float64 {
 	n := 0
 	for i, tNuc := range target.Seq {
@@ -62,23 +62,6 @@ func snpDistance(query, target fasta.EncodedRecord) float64 {
 // See also ape: https://github.com/cran/ape/blob/c2fd899f66d6493a80484033772a3418e5d706a4/src/dist_dna.c
 func tn93Distance(query, target fasta.EncodedRecord) float64 {
 
-	// Total ATGC length of the two sequences
-	L := float64(target.Count_A + target.Count_C + target.Count_G + target.Count_T + query.Count_A + query.Count_C + query.Count_G + query.Count_T)
-
-	// estimates of the equilibrium base contents from the pair's sequence data
-	g_A := float64(target.Count_A+query.Count_A) / L
-	g_C := float64(target.Count_C+query.Count_C) / L
-	g_G := float64(target.Count_G+query.Count_G) / L
-	g_T := float64(target.Count_T+query.Count_T) / L
-
-	g_R := float64(target.Count_A+query.Count_A+target.Count_G+query.Count_G) / L
-	g_Y := float64(target.Count_C+query.Count_C+target.Count_T+query.Count_T) / L
-
-	// tidies up the equations a bit, after ape
-	k1 := 2.0 * g_A * g_G / g_R
-	k2 := 2.0 * g_T * g_C / g_Y
-	k3 := 2.0 * (g_R*g_Y - g_A*g_G*g_Y/g_R - g_T*g_C*g_R/g_Y)
-
 	count_P1 := 0 // count of transitional differences between purines (A ⇄ G)
 	count_P2 := 0 // count of transitional differences between pyramidines (C ⇄ T)
 
@@ -100,6 +83,30 @@ func tn93Distance(query, target fasta.EncodedRecord) float64 {
 		}
 	}
 
+	return tn93FromCounts(query, target, count_P1, count_P2, count_d, count_L)
+}
+
+// tn93FromCounts calculates the tn93 distance between a pair of sequences from their base contents
+// and the counts of the different types of change between them
+func tn93FromCounts(query, target fasta.EncodedRecord, count_P1, count_P2, count_d, count_L int) float64 {
+
+	// Total ATGC length of the two sequences
+	L := float64(target.Count_A + target.Count_C + target.Count_G + target.Count_T + query.Count_A + query.Count_C + query.Count_G + query.Count_T)
+
+	// estimates of the equilibrium base contents from the pair's sequence data
+	g_A := float64(target.Count_A+query.Count_A) / L
+	g_C := float64(target.Count_C+query.Count_C) / L
+	g_G := float64(target.Count_G+query.Count_G) / L
+	g_T := float64(target.Count_T+query.Count_T) / L
+
+	g_R := float64(target.Count_A+query.Count_A+target.Count_G+query.Count_G) / L
+	g_Y := float64(target.Count_C+query.Count_C+target.Count_T+query.Count_T) / L
+
+	// tidies up the equations a bit, after ape
+	k1 := 2.0 * g_A * g_G / g_R
+	k2 := 2.0 * g_T * g_C / g_Y
+	k3 := 2.0 * (g_R*g_Y - g_A*g_G*g_Y/g_R - g_T*g_C*g_R/g_Y)
+
 	// estimated rates from this pairwise comparison
 	P1 := float64(count_P1) / float64(count_L)                   // rate of changes which are transitional differences between purines (A ⇄ G)
 	P2 := float64(count_P2) / float64(count_L)                   // rate of changes which are transitional differences between pyramidines (C ⇄ T)
@@ -121,56 +128,28 @@ func tn93Distance(query, target fasta.EncodedRecord) float64 {
 }
 
 // findClosest finds the single closest sequence by genetic distance among a set of target sequences to a query sequence
-func findClosest(query fasta.EncodedRecord, measure string, cIn chan fasta.EncodedRecord, cOut chan resultsStruct) {
+func findClosest(query seqRecord, cmp comparison, cIn chan seqRecord, cOut chan resultsStruct) {
 	var closest resultsStruct
 	var distance float64
-	var snps []string
 
 	first := true
 
-	decoding := encoding.MakeDecodingArray()
-
 	for target := range cIn {
 
-		switch measure {
-		case "raw":
-			distance = rawDistance(query, target)
-		case "snp":
-			distance = snpDistance(query, target)
-		case "tn93":
-			distance = tn93Distance(query, target)
-		}
+		distance = cmp.distance(query, target)
 
 		if first {
-			snps = make([]string, 0)
-			for i, tNuc := range target.Seq {
-				if (query.Seq[i] & tNuc) < 16 {
-					snps = append(snps, strconv.Itoa(i+1)+decoding[query.Seq[i]]+decoding[tNuc])
-				}
-			}
-			closest = resultsStruct{tname: target.ID, completeness: target.Score, distance: distance, snps: snps}
+			closest = resultsStruct{tname: target.ID, completeness: target.Score, distance: distance, snps: cmp.snps(query, target)}
 			first = false
 			continue
 		}
 
 		if distance < closest.distance {
-			snps = make([]string, 0)
-			for i, tNuc := range target.Seq {
-				if (query.Seq[i] & tNuc) < 16 {
-					snps = append(snps, strconv.Itoa(i+1)+decoding[query.Seq[i]]+decoding[tNuc])
-				}
-			}
-			closest = resultsStruct{tname: target.ID, completeness: target.Score, distance: distance, snps: snps}
+			closest = resultsStruct{tname: target.ID, completeness: target.Score, distance: distance, snps: cmp.snps(query, target)}
 
 		} else if distance == closest.distance {
 			if target.Score > closest.completeness {
-				snps = make([]string, 0)
-				for i, tNuc := range target.Seq {
-					if (query.Seq[i] & tNuc) < 16 {
-						snps = append(snps, strconv.Itoa(i+1)+decoding[query.Seq[i]]+decoding[tNuc])
-					}
-				}
-				closest = resultsStruct{tname: target.ID, completeness: target.Score, distance: distance, snps: snps}
+				closest = resultsStruct{tname: target.ID, completeness: target.Score, distance: distance, snps: cmp.snps(query, target)}
 			}
 		}
 	}
@@ -182,18 +161,18 @@ func findClosest(query fasta.EncodedRecord, measure string, cIn chan fasta.Encod
 }
 
 // splitInput fans out target sequences over an array of query sequences, so that each target is passed over each query.
-func splitInput(queries []fasta.EncodedRecord, measure string, cIn chan fasta.EncodedRecord, cOut chan resultsStruct, cErr chan error, cSplitDone chan bool) {
+func splitInput(queries []seqRecord, cmp comparison, cIn chan fasta.EncodedRecord, cOut chan resultsStruct, cErr chan error, cSplitDone chan bool) {
 
 	nQ := len(queries)
 
 	// make an array of channels, one for each query
-	QChanArray := make([]chan fasta.EncodedRecord, nQ)
+	QChanArray := make([]chan seqRecord, nQ)
 	for i := 0; i < nQ; i++ {
-		QChanArray[i] = make(chan fasta.EncodedRecord)
+		QChanArray[i] = make(chan seqRecord)
 	}
 
 	for i, q := range queries {
-		go findClosest(q, measure, QChanArray[i], cOut)
+		go findClosest(q, cmp, QChanArray[i], cOut)
 	}
 
 	targetCounter := 0
@@ -205,8 +184,14 @@ func splitInput(queries []fasta.EncodedRecord, measure string, cIn chan fasta.En
 		}
 		targetCounter++
 
+		SR, err := cmp.prepare(EFR)
+		if err != nil {
+			cErr <- err
+			return
+		}
+
 		for i, _ := range QChanArray {
-			QChanArray[i] <- EFR
+			QChanArray[i] <- SR
 		}
 	}
 
@@ -244,8 +229,10 @@ func writeClosest(results []resultsStruct, measure string, w io.Writer) error {
 }
 
 // Closest finds the single closest sequence by genetic distance to a query/queries. It writes the results
-// to stdout or to file. Ties for distance are broken by genome completeness
-func Closest(query, target io.Reader, measure string, out io.Writer, threads int) error {
+// to stdout or to file. Ties for distance are broken by genome completeness. If ref is not nil, distances
+// are calculated from each sequence's differences from the (first) sequence in it, which is much faster
+// for closely related sequences and gives the same results
+func Closest(query, target, ref io.Reader, measure string, out io.Writer, threads int) error {
 
 	if threads == 0 {
 		threads = runtime.NumCPU()
@@ -253,7 +240,7 @@ func Closest(query, target io.Reader, measure string, out io.Writer, threads int
 		runtime.GOMAXPROCS(threads)
 	}
 
-	queries, err := fasta.LoadEncodeAlignment(query, false, true, false)
+	cmp, queries, err := loadQueries(query, ref, measure)
 	if err != nil {
 		return err
 	}
@@ -273,7 +260,7 @@ func Closest(query, target io.Reader, measure string, out io.Writer, threads int
 
 	go fasta.StreamEncodeAlignment(target, cTEFR, cErr, cTEFRdone, false, true, true)
 
-	go splitInput(queries, measure, cTEFR, cResults, cErr, cSplitDone)
+	go splitInput(queries, cmp, cTEFR, cResults, cErr, cSplitDone)
 
 	for n := 1; n > 0; {
 		select {
@@ -46,7 +46,7 @@ func rearrangeCatchment(nS *catchmentStruct, catchmentSize int) {
 }
 
 // findClosestN finds the closest sequences by genetic distance to single a query sequence
-func findClosestN(query fasta.EncodedRecord, catchmentSize int, maxdist float64, measure string, cIn chan fasta.EncodedRecord, cOut chan catchmentStruct) {
+func findClosestN(query seqRecord, catchmentSize int, maxdist float64, cmp comparison, cIn chan seqRecord, cOut chan catchmentStruct) {
 
 	neighbours := catchmentStruct{qname: query.ID, qidx: query.Idx}
 	neighbours.catchment = make([]resultsStruct, 0)
@@ -57,14 +57,7 @@ func findClosestN(query fasta.EncodedRecord, catchmentSize int, maxdist float64,
 
 	for target := range cIn {
 
-		switch measure {
-		case "raw":
-			distance = rawDistance(query, target)
-		case "snp":
-			distance = snpDistance(query, target)
-		case "tn93":
-			distance = tn93Distance(query, target)
-		}
+		distance = cmp.distance(query, target)
 
 		if maxdist != -1.0 {
 			if distance > maxdist {
@@ -103,18 +96,18 @@ func findClosestN(query fasta.EncodedRecord, catchmentSize int, maxdist float64,
 }
 
 // splitInputN fans out target sequences over an array of query sequences, so that each target is passed over each query.
-func splitInputN(queries []fasta.EncodedRecord, catchmentSize int, maxdist float64, measure string, cIn chan fasta.EncodedRecord, cOut chan catchmentStruct, cErr chan error, cSplitDone chan bool) {
+func splitInputN(queries []seqRecord, catchmentSize int, maxdist float64, cmp comparison, cIn chan fasta.EncodedRecord, cOut chan catchmentStruct, cErr chan error, cSplitDone chan bool) {
 
 	nQ := len(queries)
 
 	// make an array of channels, one for each query
-	QChanArray := make([]chan fasta.EncodedRecord, nQ)
+	QChanArray := make([]chan seqRecord, nQ)
 	for i := 0; i < nQ; i++ {
-		QChanArray[i] = make(chan fasta.EncodedRecord)
+		QChanArray[i] = make(chan seqRecord)
 	}
 
 	for i, q := range queries {
-		go findClosestN(q, catchmentSize, maxdist, measure, QChanArray[i], cOut)
+		go findClosestN(q, catchmentSize, maxdist, cmp, QChanArray[i], cOut)
 	}
 
 	targetCounter := 0
@@ -126,8 +119,14 @@ func splitInputN(queries []fasta.EncodedRecord, catchmentSize int, maxdist float
 		}
 		targetCounter++
 
+		SR, err := cmp.prepare(EFR)
+		if err != nil {
+			cErr <- err
+			return
+		}
+
 		for i, _ := range QChanArray {
-			QChanArray[i] <- EFR
+			QChanArray[i] <- SR
 		}
 	}
 
@@ -189,8 +188,9 @@ func writeClosestNTable(results []catchmentStruct, w io.Writer, measure string)
 }
 
 // ClosestN finds the closest sequence(s) by genetic distance to a query/queries. It writes the results
-// to stdout or to file. Ties for distance are broken by genome completeness.
-func ClosestN(catchmentSize int, maxdist float64, query, target io.Reader, measure string, out io.Writer, table bool, threads int) error {
+// to stdout or to file. Ties for distance are broken by genome completeness. If ref is not nil, distances
+// are calculated in sparse mode (see Closest).
+func ClosestN(catchmentSize int, maxdist float64, query, target, ref io.Reader, measure string, out io.Writer, table bool, threads int) error {
 
 	if threads == 0 {
 		threads = runtime.NumCPU()
@@ -202,7 +202,7 @@ func ClosestN(catchmentSize int, maxdist float64, query, target io.Reader, measu
 		catchmentSize = math.MaxInt
 	}
 
-	queries, err := fasta.LoadEncodeAlignment(query, false, true, false)
+	cmp, queries, err := loadQueries(query, ref, measure)
 	if err != nil {
 		return err
 	}
@@ -222,7 +222,7 @@ func ClosestN(catchmentSize int, maxdist float64, query, target io.Reader, measu
 
 	go fasta.StreamEncodeAlignment(target, cTEFR, cErr, cTEFRdone, false, true, true)
 
-	go splitInputN(queries, catchmentSize, maxdist, measure, cTEFR, cResults, cErr, cSplitDone)
+	go splitInputN(queries, catchmentSize, maxdist, cmp, cTEFR, cResults, cErr, cSplitDone)
 
 	for n := 1; n > 0; {
 		select {
@@ -0,0 +1,325 @@
+package closest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// the number of rows of the matrix that are calculated together by one thread
+const tileSize = 16
+
+// distanceTile is a block of rows of a distance matrix, which is the unit of work for calculating and writing it
+type distanceTile struct {
+	idx  int
+	rows []seqRecord
+	out  []byte
+}
+
+// formatDistance formats a distance for writing, in the same way as the output of closest
+func formatDistance(distance float64, measure string) string {
+	switch measure {
+	case "snp":
+		return strconv.Itoa(int(distance))
+	default:
+		return strconv.FormatFloat(distance, 'f', 9, 64)
+	}
+}
+
+// writeMatrixHeader writes anything that goes before the first row of the matrix
+func writeMatrixHeader(w io.Writer, cols []seqRecord, format string) error {
+	var err error
+	switch format {
+	case "phylip":
+		_, err = w.Write([]byte(strconv.Itoa(len(cols)) + "\n"))
+	case "csv":
+		ids := make([]string, len(cols))
+		for i := range cols {
+			ids[i] = cols[i].ID
+		}
+		_, err = w.Write([]byte("query," + strings.Join(ids, ",") + "\n"))
+	case "tsv":
+		_, err = w.Write([]byte("query\ttarget\tdistance\n"))
+	}
+	return err
+}
+
+// fillTile calculates the distances for a block of rows of the matrix and formats them for output. If
+// allVsAll is true, the rows are the same sequences as the columns, and in long format each pair is
+// only written once.
+func fillTile(tile *distanceTile, cols []seqRecord, cmp comparison, format string, maxdist float64, allVsAll bool) {
+	buf := new(bytes.Buffer)
+	for _, row := range tile.rows {
+		switch format {
+		case "phylip":
+			buf.WriteString(row.ID)
+			for _, col := range cols {
+				buf.WriteString(" " + formatDistance(cmp.distance(row, col), cmp.measure))
+			}
+			buf.WriteString("\n")
+		case "csv":
+			buf.WriteString(row.ID)
+			for _, col := range cols {
+				buf.WriteString("," + formatDistance(cmp.distance(row, col), cmp.measure))
+			}
+			buf.WriteString("\n")
+		case "tsv":
+			start := 0
+			if allVsAll {
+				start = row.Idx + 1
+			}
+			for _, col := range cols[start:] {
+				distance := cmp.distance(row, col)
+				if maxdist != -1.0 && distance > maxdist {
+					continue
+				}
+				buf.WriteString(row.ID + "\t" + col.ID + "\t" + formatDistance(distance, cmp.measure) + "\n")
+			}
+		}
+	}
+	tile.out = buf.Bytes()
+}
+
+// tileRows groups rows of the matrix into tiles
+func tileRows(cRows chan seqRecord, cTiles chan distanceTile) {
+	tile := distanceTile{idx: 0, rows: make([]seqRecord, 0, tileSize)}
+	for row := range cRows {
+		tile.rows = append(tile.rows, row)
+		if len(tile.rows) == tileSize {
+			cTiles <- tile
+			tile = distanceTile{idx: tile.idx + 1, rows: make([]seqRecord, 0, tileSize)}
+		}
+	}
+	if len(tile.rows) > 0 {
+		cTiles <- tile
+	}
+	close(cTiles)
+}
+
+// writeTiles writes tiles of the matrix in the order of their rows in the input
+func writeTiles(w io.Writer, cTiles chan distanceTile, cErr chan error, cDone chan bool) {
+	outputMap := make(map[int]distanceTile)
+	counter := 0
+	for tile := range cTiles {
+		outputMap[tile.idx] = tile
+		for {
+			if t, ok := outputMap[counter]; ok {
+				_, err := w.Write(t.out)
+				if err != nil {
+					cErr <- err
+					return
+				}
+				delete(outputMap, counter)
+				counter++
+			} else {
+				break
+			}
+		}
+	}
+	cDone <- true
+}
+
+// Distance writes the matrix of genetic distances between every pair of sequences in query (if target is nil),
+// or from every sequence in query (the rows) to every sequence in target (the columns). format is one of
+// "phylip" (which needs target to be nil), "csv" (a square matrix) or "tsv" (long format, one line per pair).
+// In long format, pairs further apart than maxdist are not written, unless it is -1. The columns are held in
+// memory but the rows are streamed, and the output is written as it is calculated. If ref is not nil, distances
+// are calculated in sparse mode (see Closest).
+func Distance(query, target, ref io.Reader, measure string, format string, maxdist float64, out io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	if format == "phylip" && target != nil {
+		return errors.New("phylip format needs an all-vs-all matrix (i.e. no target alignment)")
+	}
+	if maxdist != -1.0 && format != "tsv" {
+		return errors.New("a maximum distance can only be used with long format (tsv) output")
+	}
+
+	allVsAll := target == nil
+
+	var cmp comparison
+	var cols []seqRecord
+	var err error
+	if allVsAll {
+		cmp, cols, err = loadQueries(query, ref, measure)
+	} else {
+		cmp, cols, err = loadQueries(target, ref, measure)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "number of sequences in matrix columns: %d\n", len(cols))
+
+	err = writeMatrixHeader(out, cols, format)
+	if err != nil {
+		return err
+	}
+
+	cErr := make(chan error)
+
+	cRows := make(chan seqRecord, tileSize)
+	cReadDone := make(chan bool)
+
+	cTiles := make(chan distanceTile, threads)
+	cFilled := make(chan distanceTile, threads)
+	cWriteDone := make(chan bool)
+	cWaitGroupDone := make(chan bool)
+
+	if allVsAll {
+		go func() {
+			for _, row := range cols {
+				cRows <- row
+			}
+			cReadDone <- true
+		}()
+	} else {
+		cEFR := make(chan fasta.EncodedRecord, threads)
+		cEFRDone := make(chan bool)
+		go fasta.StreamEncodeAlignment(query, cEFR, cErr, cEFRDone, false, true, false)
+		go func() {
+			for EFR := range cEFR {
+				if len(EFR.Seq) != len(cols[0].Seq) {
+					cErr <- errors.New("query and target alignments are not the same width")
+					return
+				}
+				row, err := cmp.prepare(EFR)
+				if err != nil {
+					cErr <- err
+					return
+				}
+				cRows <- row
+			}
+			cReadDone <- true
+		}()
+		go func() {
+			<-cEFRDone
+			close(cEFR)
+		}()
+	}
+
+	go tileRows(cRows, cTiles)
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			for tile := range cTiles {
+				fillTile(&tile, cols, cmp, format, maxdist, allVsAll)
+				cFilled <- tile
+			}
+			wg.Done()
+		}()
+	}
+
+	go writeTiles(out, cFilled, cErr, cWriteDone)
+
+	go func() {
+		wg.Wait()
+		cWaitGroupDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cRows)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWaitGroupDone:
+			close(cFilled)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
+
+// DistanceMatrix calculates the distance between every pair of records, which must be the same width and have
+// had their ATGC content calculated (if measure is "tn93"). If ref is not nil, it is the encoded sequence of
+// the reference for sparse mode (see Closest). The matrix is held in memory, so this is for modest numbers
+// of sequences only.
+func DistanceMatrix(records []fasta.EncodedRecord, ref []byte, measure string, threads int) ([][]float64, error) {
+
+	if threads < 1 {
+		threads = runtime.NumCPU()
+	}
+
+	cmp := comparison{measure: measure}
+	if ref != nil {
+		cmp.ref = newReference(ref)
+	}
+
+	seqs := make([]seqRecord, len(records))
+	for i := range records {
+		if len(records[i].Seq) != len(records[0].Seq) {
+			return nil, errors.New("sequences are not all the same width")
+		}
+		var err error
+		seqs[i], err = cmp.prepare(records[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	matrix := make([][]float64, len(seqs))
+	for i := range matrix {
+		matrix[i] = make([]float64, len(seqs))
+	}
+
+	cRows := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			for i := range cRows {
+				for j := 0; j < i; j++ {
+					matrix[i][j] = cmp.distance(seqs[i], seqs[j])
+				}
+			}
+			wg.Done()
+		}()
+	}
+	for i := range seqs {
+		cRows <- i
+	}
+	close(cRows)
+	wg.Wait()
+
+	for i := range matrix {
+		for j := 0; j < i; j++ {
+			matrix[j][i] = matrix[i][j]
+		}
+	}
+
+	return matrix, nil
+}
@@ -0,0 +1,114 @@
+package closest
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var distanceData = []byte(`>a
+ATGATGATGC
+>b
+ATGTTGATGC
+>c
+ATGTTGATCC
+`)
+
+func TestDistanceFormats(t *testing.T) {
+
+	desiredResults := map[string]string{
+		"csv": `query,a,b,c
+a,0,1,2
+b,1,0,1
+c,2,1,0
+`,
+		"phylip": `3
+a 0 1 2
+b 1 0 1
+c 2 1 0
+`,
+		"tsv": `query	target	distance
+a	b	1
+a	c	2
+b	c	1
+`,
+	}
+
+	for format, desiredResult := range desiredResults {
+		out := new(bytes.Buffer)
+		err := Distance(bytes.NewReader(distanceData), nil, nil, "snp", format, -1.0, out, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != desiredResult {
+			t.Errorf("problem in TestDistanceFormats (%s)", format)
+			t.Error(out.String())
+		}
+	}
+}
+
+func TestDistanceQueryTarget(t *testing.T) {
+	query := []byte(`>q1
+ATGATGATGA
+>q2
+ATGATGATGC
+`)
+
+	out := new(bytes.Buffer)
+	err := Distance(bytes.NewReader(query), bytes.NewReader(distanceData), nil, "raw", "tsv", 0.15, out, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `query	target	distance
+q1	a	0.100000000
+q2	a	0.000000000
+q2	b	0.100000000
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestDistanceQueryTarget")
+		t.Error(out.String())
+	}
+
+	err = Distance(bytes.NewReader(query), bytes.NewReader(distanceData), nil, "raw", "phylip", -1.0, new(bytes.Buffer), 2)
+	if err == nil {
+		t.Errorf("expected an error asking for a phylip format query-vs-target matrix")
+	}
+
+	err = Distance(bytes.NewReader(query), nil, nil, "raw", "csv", 0.1, new(bytes.Buffer), 2)
+	if err == nil {
+		t.Errorf("expected an error asking for a max distance with csv output")
+	}
+}
+
+// rows must be written in input order even when there are many tiles of them
+func TestDistanceManyTiles(t *testing.T) {
+	_, _, targetData := makeSparseTestData()
+
+	dense := new(bytes.Buffer)
+	err := Distance(bytes.NewReader(targetData), nil, nil, "tn93", "csv", -1.0, dense, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(dense.String()), "\n")
+	if len(lines) != 41 {
+		t.Fatalf("problem in TestDistanceManyTiles: wrong number of lines (%d)", len(lines))
+	}
+	for i, line := range lines[1:] {
+		if !strings.HasPrefix(line, "Target"+strconv.Itoa(i)+",") {
+			t.Errorf("problem in TestDistanceManyTiles: row %d is out of order", i)
+		}
+	}
+
+	refData, _, _ := makeSparseTestData()
+	sparse := new(bytes.Buffer)
+	err = Distance(bytes.NewReader(targetData), nil, bytes.NewReader(refData), "tn93", "csv", -1.0, sparse, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sparse.String() != dense.String() {
+		t.Errorf("problem in TestDistanceManyTiles: sparse and dense results differ")
+	}
+}
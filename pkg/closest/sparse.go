@@ -0,0 +1,237 @@
+package closest
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/virus-evolution/gofasta/pkg/encoding"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+/*
+For closely related sequences, most sites in any pair are the same as each other and as some reference
+sequence. So if we know where each sequence differs from a reference, we only need to look at the union of
+those sites for a pair to calculate the distance between them: at every other site, both sequences have the
+reference nucleotide, and what that site contributes to the distance can be counted once for the reference.
+This gives exactly the same answers as comparing the whole sequences.
+*/
+
+// seqRecord is an encoded record plus, in sparse mode, the sites at which it differs from the reference
+type seqRecord struct {
+	fasta.EncodedRecord
+	diffPos []int  // (0-based) positions that differ from the reference, in order
+	diffNuc []byte // the record's nucleotides at those positions
+}
+
+// reference holds what we need to know about the reference sequence in sparse mode
+type reference struct {
+	seq   []byte
+	known int // the number of sites in seq that are known for certain (A, T, G or C)
+}
+
+// comparison holds the settings for calculating distances between pairs of sequences. If ref is nil,
+// the whole sequences are compared
+type comparison struct {
+	measure string
+	ref     *reference
+}
+
+// loadReference reads the (first) sequence from refIn to use in sparse mode
+func loadReference(refIn io.Reader) (*reference, error) {
+	refs, err := fasta.LoadEncodeAlignment(refIn, false, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return newReference(refs[0].Seq), nil
+}
+
+// newReference sets up an encoded sequence for use as the reference in sparse mode
+func newReference(seq []byte) *reference {
+	ref := &reference{seq: seq}
+	for _, nuc := range ref.seq {
+		if nuc&8 == 8 {
+			ref.known++
+		}
+	}
+	return ref
+}
+
+// prepare converts an EncodedRecord to a seqRecord, finding its differences from the reference in sparse mode
+func (c comparison) prepare(EFR fasta.EncodedRecord) (seqRecord, error) {
+	SR := seqRecord{EncodedRecord: EFR}
+	if c.ref == nil {
+		return SR, nil
+	}
+	if len(EFR.Seq) != len(c.ref.seq) {
+		return SR, errors.New("reference and alignments are not the same width")
+	}
+	SR.diffPos = make([]int, 0)
+	SR.diffNuc = make([]byte, 0)
+	for i, nuc := range EFR.Seq {
+		if nuc != c.ref.seq[i] {
+			SR.diffPos = append(SR.diffPos, i)
+			SR.diffNuc = append(SR.diffNuc, nuc)
+		}
+	}
+	return SR, nil
+}
+
+// eachSite calls f, in order, for every site where query or target (or both) differ from the reference,
+// with the nucleotides of the query, target and reference at that site
+func (r *reference) eachSite(query, target seqRecord, f func(i int, qNuc, tNuc, rNuc byte)) {
+	var qi, ti int
+	for qi < len(query.diffPos) || ti < len(target.diffPos) {
+		switch {
+		case ti == len(target.diffPos) || (qi < len(query.diffPos) && query.diffPos[qi] < target.diffPos[ti]):
+			i := query.diffPos[qi]
+			f(i, query.diffNuc[qi], r.seq[i], r.seq[i])
+			qi++
+		case qi == len(query.diffPos) || target.diffPos[ti] < query.diffPos[qi]:
+			i := target.diffPos[ti]
+			f(i, r.seq[i], target.diffNuc[ti], r.seq[i])
+			ti++
+		default:
+			i := query.diffPos[qi]
+			f(i, query.diffNuc[qi], target.diffNuc[ti], r.seq[i])
+			qi++
+			ti++
+		}
+	}
+}
+
+// distance calculates the distance between a query and a target
+func (c comparison) distance(query, target seqRecord) float64 {
+	if c.ref == nil {
+		switch c.measure {
+		case "raw":
+			return rawDistance(query.EncodedRecord, target.EncodedRecord)
+		case "snp":
+			return snpDistance(query.EncodedRecord, target.EncodedRecord)
+		case "tn93":
+			return tn93Distance(query.EncodedRecord, target.EncodedRecord)
+		}
+		return 0.0
+	}
+	switch c.measure {
+	case "raw":
+		return rawDistanceSparse(query, target, c.ref)
+	case "snp":
+		return snpDistanceSparse(query, target, c.ref)
+	case "tn93":
+		return tn93DistanceSparse(query, target, c.ref)
+	}
+	return 0.0
+}
+
+// snps lists the differences between a query and a target, like "100AG", in order
+func (c comparison) snps(query, target seqRecord) []string {
+	decoding := encoding.MakeDecodingArray()
+	snps := make([]string, 0)
+	if c.ref == nil {
+		for i, tNuc := range target.Seq {
+			if (query.Seq[i] & tNuc) < 16 {
+				snps = append(snps, strconv.Itoa(i+1)+decoding[query.Seq[i]]+decoding[tNuc])
+			}
+		}
+		return snps
+	}
+	c.ref.eachSite(query, target, func(i int, qNuc, tNuc, rNuc byte) {
+		if (qNuc & tNuc) < 16 {
+			snps = append(snps, strconv.Itoa(i+1)+decoding[qNuc]+decoding[tNuc])
+		}
+	})
+	return snps
+}
+
+// rawDistanceSparse is rawDistance in sparse mode
+func rawDistanceSparse(query, target seqRecord, ref *reference) float64 {
+	n := 0
+	d := ref.known
+	ref.eachSite(query, target, func(i int, qNuc, tNuc, rNuc byte) {
+		if (qNuc & tNuc) < 16 {
+			n += 1
+			d += 1
+		}
+		if (qNuc&8 == 8) && qNuc == tNuc {
+			d += 1
+		}
+		// this site was counted once for the reference
+		if rNuc&8 == 8 {
+			d -= 1
+		}
+	})
+	distance := float64(n) / float64(d)
+	return distance
+}
+
+// snpDistanceSparse is snpDistance in sparse mode
+func snpDistanceSparse(query, target seqRecord, ref *reference) float64 {
+	n := 0
+	ref.eachSite(query, target, func(i int, qNuc, tNuc, rNuc byte) {
+		if (qNuc & tNuc) < 16 {
+			n += 1
+		}
+	})
+	return float64(n)
+}
+
+// tn93DistanceSparse is tn93Distance in sparse mode
+func tn93DistanceSparse(query, target seqRecord, ref *reference) float64 {
+
+	count_P1 := 0
+	count_P2 := 0
+
+	count_d := 0
+	count_L := ref.known
+
+	ref.eachSite(query, target, func(i int, qNuc, tNuc, rNuc byte) {
+		if (qNuc&tNuc) < 16 && qNuc&8 == 8 && tNuc&8 == 8 {
+			count_d++
+			count_L++
+			if (qNuc | tNuc) == 200 {
+				count_P1++
+			} else if (qNuc | tNuc) == 56 {
+				count_P2++
+			}
+		} else if qNuc&8 == 8 && qNuc == tNuc {
+			count_L++
+		}
+		// this site was counted once for the reference
+		if rNuc&8 == 8 {
+			count_L--
+		}
+	})
+
+	return tn93FromCounts(query.EncodedRecord, target.EncodedRecord, count_P1, count_P2, count_d, count_L)
+}
+
+// loadQueries reads the query alignment into memory and sets up the comparison between queries and targets.
+// If refIn is not nil, its first sequence is used as the reference for sparse mode
+func loadQueries(query io.Reader, refIn io.Reader, measure string) (comparison, []seqRecord, error) {
+
+	cmp := comparison{measure: measure}
+
+	if refIn != nil {
+		ref, err := loadReference(refIn)
+		if err != nil {
+			return cmp, nil, err
+		}
+		cmp.ref = ref
+	}
+
+	EFRs, err := fasta.LoadEncodeAlignment(query, false, true, false)
+	if err != nil {
+		return cmp, nil, err
+	}
+
+	queries := make([]seqRecord, len(EFRs))
+	for i, EFR := range EFRs {
+		queries[i], err = cmp.prepare(EFR)
+		if err != nil {
+			return cmp, nil, err
+		}
+	}
+
+	return cmp, queries, nil
+}
@@ -0,0 +1,91 @@
+package closest
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// makeSparseTestData makes a reference sequence and two alignments of sequences which each differ from it
+// at a few sites (including by ambiguities and gaps)
+func makeSparseTestData() ([]byte, []byte, []byte) {
+	r := rand.New(rand.NewSource(42))
+	nucs := []byte("ATGCATGCATGCATGCRYN-")
+	width := 200
+
+	ref := make([]byte, width)
+	for i := range ref {
+		ref[i] = "ATGC"[r.Intn(4)]
+	}
+	// a few ambiguities in the reference too
+	ref[10] = 'N'
+	ref[11] = '-'
+	ref[150] = 'R'
+
+	makeAlignment := func(prefix string, n int) []byte {
+		buf := new(bytes.Buffer)
+		for i := 0; i < n; i++ {
+			seq := make([]byte, width)
+			copy(seq, ref)
+			for j := 0; j < r.Intn(12); j++ {
+				seq[r.Intn(width)] = nucs[r.Intn(len(nucs))]
+			}
+			buf.WriteString(">" + prefix + strconv.Itoa(i) + "\n" + string(seq) + "\n")
+		}
+		return buf.Bytes()
+	}
+
+	return []byte(">ref\n" + string(ref) + "\n"), makeAlignment("Query", 5), makeAlignment("Target", 40)
+}
+
+func TestClosestSparse(t *testing.T) {
+	refData, queryData, targetData := makeSparseTestData()
+
+	for _, measure := range []string{"raw", "snp", "tn93"} {
+		dense := new(bytes.Buffer)
+		err := Closest(bytes.NewReader(queryData), bytes.NewReader(targetData), nil, measure, dense, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sparse := new(bytes.Buffer)
+		err = Closest(bytes.NewReader(queryData), bytes.NewReader(targetData), bytes.NewReader(refData), measure, sparse, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dense.String() != sparse.String() {
+			t.Errorf("problem in TestClosestSparse (%s): sparse and dense results differ", measure)
+			t.Error(dense.String())
+			t.Error(sparse.String())
+		}
+	}
+}
+
+func TestClosestNSparse(t *testing.T) {
+	refData, queryData, targetData := makeSparseTestData()
+
+	for _, measure := range []string{"raw", "snp", "tn93"} {
+		dense := new(bytes.Buffer)
+		err := ClosestN(10, -1.0, bytes.NewReader(queryData), bytes.NewReader(targetData), nil, measure, dense, true, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sparse := new(bytes.Buffer)
+		err = ClosestN(10, -1.0, bytes.NewReader(queryData), bytes.NewReader(targetData), bytes.NewReader(refData), measure, sparse, true, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dense.String() != sparse.String() {
+			t.Errorf("problem in TestClosestNSparse (%s): sparse and dense results differ", measure)
+			t.Error(dense.String())
+			t.Error(sparse.String())
+		}
+	}
+}
+
+func TestClosestSparseWidth(t *testing.T) {
+	err := Closest(bytes.NewReader([]byte(">q\nATGATG\n")), bytes.NewReader([]byte(">t\nATGATG\n")), bytes.NewReader([]byte(">ref\nATGAT\n")), "snp", new(bytes.Buffer), 1)
+	if err == nil {
+		t.Errorf("expected an error when the reference is a different width to the alignments")
+	}
+}
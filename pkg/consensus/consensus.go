@@ -0,0 +1,298 @@
+/*
+Package consensus implements functions to make consensus sequences from a multiple sequence
+alignment in fasta format, for the whole alignment or for groups of sequences within it.
+*/
+package consensus
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/bits"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// iupac maps a set of bases, as a 4-bit mask in the same order as the high bits of EP's encoding
+// (A=8, G=4, C=2, T=1), to its IUPAC code
+var iupac = [16]byte{'N', 'T', 'C', 'Y', 'G', 'K', 'S', 'B', 'A', 'W', 'M', 'H', 'R', 'D', 'V', 'N'}
+
+// column is the tally of one column of the alignment for one group of sequences
+type column struct {
+	bases [4]float64 // A, G, C, T. An ambiguity code adds an equal share to each of the bases it could be
+	gaps  int
+	seqs  int   // the number of sequences that have a (possibly ambiguous) base here
+	union uint8 // all the bases that have been seen here
+}
+
+// add tallies one encoded nucleotide
+func (c *column) add(nuc byte) {
+	switch nuc {
+	case 244, 4:
+		c.gaps++
+	case 240, 242:
+	default:
+		mask := nuc >> 4
+		share := 1.0 / float64(bits.OnesCount8(mask))
+		for b := 0; b < 4; b++ {
+			if mask&(8>>b) != 0 {
+				c.bases[b] += share
+			}
+		}
+		c.seqs++
+		c.union |= mask
+	}
+}
+
+// merge adds the tally in o to c
+func (c *column) merge(o column) {
+	for b := range c.bases {
+		c.bases[b] += o.bases[b]
+	}
+	c.gaps += o.gaps
+	c.seqs += o.seqs
+	c.union |= o.union
+}
+
+// call returns the consensus character for a column
+func (c column) call(method string, threshold float64, countGaps bool, minSupport int) byte {
+
+	support := c.seqs
+	if countGaps {
+		support += c.gaps
+	}
+	if support == 0 || support < minSupport {
+		return 'N'
+	}
+
+	switch method {
+	case "strict":
+		if countGaps && c.gaps > 0 {
+			if c.seqs == 0 {
+				return '-'
+			}
+			return 'N'
+		}
+		if bits.OnesCount8(c.union) == 1 {
+			return iupac[c.union]
+		}
+		return 'N'
+
+	case "majority":
+		max := 0.0
+		for _, n := range c.bases {
+			if n > max {
+				max = n
+			}
+		}
+		if countGaps && float64(c.gaps) > max {
+			return '-'
+		}
+		var mask uint8
+		for b, n := range c.bases {
+			if n == max && n > 0 {
+				mask |= 8 >> b
+			}
+		}
+		return iupac[mask]
+
+	case "iupac":
+		if countGaps && float64(c.gaps)/float64(support) >= threshold {
+			return '-'
+		}
+		order := []int{0, 1, 2, 3}
+		sort.SliceStable(order, func(i, j int) bool { return c.bases[order[i]] > c.bases[order[j]] })
+		var mask uint8
+		sum := 0.0
+		for i, b := range order {
+			if c.bases[b] == 0 {
+				break
+			}
+			// bases that are tied with the last one included are included too
+			if sum/float64(support) >= threshold && c.bases[b] < c.bases[order[i-1]] {
+				break
+			}
+			mask |= 8 >> b
+			sum += c.bases[b]
+		}
+		if sum/float64(support) < threshold {
+			return 'N'
+		}
+		return iupac[mask]
+	}
+
+	return 'N'
+}
+
+// ReadGroups reads the group that each sequence belongs to from a csv file with a header. idCol is the column
+// with the sequence IDs in it (or "" for the first column), and groupCol is the column with the groups in it.
+func ReadGroups(r io.Reader, idCol string, groupCol string) (map[string]string, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty metadata file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idIdx, groupIdx := 0, -1
+	if idCol != "" {
+		idIdx = -1
+	}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if idCol != "" && name == idCol {
+			idIdx = i
+		}
+		if name == groupCol {
+			groupIdx = i
+		}
+	}
+	if idIdx == -1 {
+		return nil, errors.New("couldn't find column \"" + idCol + "\" in metadata")
+	}
+	if groupIdx == -1 {
+		return nil, errors.New("couldn't find column \"" + groupCol + "\" in metadata")
+	}
+
+	groups := make(map[string]string)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		groups[record[idIdx]] = record[groupIdx]
+	}
+
+	return groups, nil
+}
+
+// Consensus writes consensus sequences in fasta format. If groups is nil, one consensus is made from the whole
+// alignment and called name, otherwise one is made for each group of sequences (groups maps the sequence IDs to
+// their group), called by the group name, and sequences that aren't in a group are left out.
+//
+// method is one of "majority" (the most common base, or the IUPAC code for a tie), "iupac" (the IUPAC code for the
+// fewest bases that together make up at least threshold of the sequences), or "strict" (a base only if every
+// sequence agrees, otherwise N). Ambiguity codes count as an equal share of each of their bases, and Ns are
+// ignored. If countGaps is false, gaps are ignored too, otherwise a gap can be the consensus. Columns that fewer
+// than minSupport sequences have a base (or gap, if countGaps) in are N.
+func Consensus(msaIn io.Reader, method string, threshold float64, countGaps bool, minSupport int, groups map[string]string, name string, out io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	switch method {
+	case "majority", "strict":
+	case "iupac":
+		if threshold <= 0 || threshold > 1 {
+			return errors.New("the threshold for an iupac consensus must be greater than 0 and at most 1")
+		}
+	default:
+		return errors.New("unknown consensus method: " + method)
+	}
+
+	cErr := make(chan error)
+
+	cEFR := make(chan fasta.EncodedRecord, threads)
+	cEFRDone := make(chan bool)
+	cWaitGroupDone := make(chan bool)
+
+	go fasta.StreamEncodeAlignment(msaIn, cEFR, cErr, cEFRDone, false, false, false)
+
+	// each thread tallies the sequences it sees, and these are added together at the end
+	tallies := make([]map[string][]column, threads)
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		tallies[n] = make(map[string][]column)
+		go func(tally map[string][]column) {
+			for EFR := range cEFR {
+				group := name
+				if groups != nil {
+					var ok bool
+					group, ok = groups[EFR.ID]
+					if !ok {
+						continue
+					}
+				}
+				if _, ok := tally[group]; !ok {
+					tally[group] = make([]column, len(EFR.Seq))
+				}
+				cols := tally[group]
+				for i, nuc := range EFR.Seq {
+					cols[i].add(nuc)
+				}
+			}
+			wg.Done()
+		}(tallies[n])
+	}
+
+	go func() {
+		wg.Wait()
+		cWaitGroupDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cEFRDone:
+			close(cEFR)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWaitGroupDone:
+			n--
+		}
+	}
+
+	total := make(map[string][]column)
+	for _, tally := range tallies {
+		for group, cols := range tally {
+			if _, ok := total[group]; !ok {
+				total[group] = cols
+				continue
+			}
+			for i := range cols {
+				total[group][i].merge(cols[i])
+			}
+		}
+	}
+
+	names := make([]string, 0, len(total))
+	for group := range total {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	for _, group := range names {
+		seq := make([]byte, len(total[group]))
+		for i, c := range total[group] {
+			seq[i] = c.call(method, threshold, countGaps, minSupport)
+		}
+		_, err := out.Write([]byte(">" + group + "\n" + string(seq) + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package consensus
+
+import (
+	"bytes"
+	"testing"
+)
+
+var msaData = []byte(`>seq1
+ATGAAN-C
+>seq2
+ATGGCN-C
+>seq3
+ATTGGNAC
+>seq4
+ACTRTN-C
+`)
+
+func TestConsensus(t *testing.T) {
+
+	tests := []struct {
+		method        string
+		threshold     float64
+		countGaps     bool
+		minSupport    int
+		desiredResult string
+	}{
+		{"majority", 0, false, 0, ">consensus\nATKGNNAC\n"},
+		{"majority", 0, true, 0, ">consensus\nATKGNN-C\n"},
+		{"majority", 0, false, 2, ">consensus\nATKGNNNC\n"},
+		{"iupac", 0.75, false, 0, ">consensus\nATKRNNAC\n"},
+		{"strict", 0, false, 0, ">consensus\nANNNNNAC\n"},
+		{"strict", 0, true, 0, ">consensus\nANNNNNNC\n"},
+	}
+
+	for _, test := range tests {
+		out := new(bytes.Buffer)
+		err := Consensus(bytes.NewReader(msaData), test.method, test.threshold, test.countGaps, test.minSupport, nil, "consensus", out, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.desiredResult {
+			t.Errorf("problem in TestConsensus (%s, %v, %v, %d)", test.method, test.threshold, test.countGaps, test.minSupport)
+			t.Error(out.String())
+		}
+	}
+
+	err := Consensus(bytes.NewReader(msaData), "iupac", 0, false, 0, nil, "consensus", new(bytes.Buffer), 2)
+	if err == nil {
+		t.Errorf("expected an error for an iupac consensus without a threshold")
+	}
+}
+
+func TestConsensusGroups(t *testing.T) {
+	metadata := []byte(`sequence_name,lineage
+seq1,B.1
+seq2,B.1
+seq3,A
+seq5,A
+`)
+	groups, err := ReadGroups(bytes.NewReader(metadata), "", "lineage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	err = Consensus(bytes.NewReader(msaData), "majority", 0, false, 0, groups, "", out, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>A
+ATTGGNAC
+>B.1
+ATGRMNNC
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestConsensusGroups")
+		t.Error(out.String())
+	}
+
+	_, err = ReadGroups(bytes.NewReader(metadata), "", "country")
+	if err == nil {
+		t.Errorf("expected an error for a missing group column")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Package dedup implements functions to collapse identical (or, allowing for missing data, indistinguishable)
+sequences in a multiple sequence alignment in fasta format.
+*/
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/encoding"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// compatible is true if there is no site at which a and b are certainly different, so that they could be the
+// same sequence once their ambiguities (and gaps, unless they are hard gaps) are resolved
+func compatible(a, b []byte) bool {
+	for i := range a {
+		if a[i] != b[i] && a[i]&b[i] < 16 {
+			return false
+		}
+	}
+	return true
+}
+
+// findCompatible returns the position in reps of the first representative that seq is compatible with,
+// or -1 if there isn't one. The search is split over threads.
+func findCompatible(records []fasta.EncodedRecord, reps []int, seq []byte, threads int) int {
+	if len(reps) < threads*4 {
+		for pos, r := range reps {
+			if compatible(records[r].Seq, seq) {
+				return pos
+			}
+		}
+		return -1
+	}
+
+	found := make([]int, threads)
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for w := 0; w < threads; w++ {
+		go func(w int) {
+			found[w] = -1
+			for pos := w; pos < len(reps); pos += threads {
+				if compatible(records[reps[pos]].Seq, seq) {
+					found[w] = pos
+					break
+				}
+			}
+			wg.Done()
+		}(w)
+	}
+	wg.Wait()
+
+	first := -1
+	for _, pos := range found {
+		if pos != -1 && (first == -1 || pos < first) {
+			first = pos
+		}
+	}
+	return first
+}
+
+// Dedup writes one representative of each group of duplicate sequences in an alignment to out, in the same order
+// as the input, and writes which representative every other sequence was collapsed into to table (if it isn't nil),
+// as a csv file with the columns query and representative. If exact is true, only identical sequences are duplicates.
+// Otherwise sequences are duplicates if there is no site at which they are certainly different (i.e. if they are
+// identical up to Ns and other ambiguity codes, and gaps unless hardGaps is true). Representatives are chosen
+// greedily, most complete sequence first, and each sequence is collapsed into the most complete representative
+// that it is compatible with.
+func Dedup(msaIn io.Reader, exact bool, hardGaps bool, out io.Writer, table io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	records, err := fasta.LoadEncodeAlignment(msaIn, hardGaps, false, true)
+	if err != nil {
+		return err
+	}
+
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return records[order[i]].Score > records[order[j]].Score
+	})
+
+	reps := make([]int, 0)
+	repOf := make([]int, len(records))
+
+	if exact {
+		seen := make(map[string]int)
+		for _, i := range order {
+			if r, ok := seen[string(records[i].Seq)]; ok {
+				repOf[i] = r
+				continue
+			}
+			seen[string(records[i].Seq)] = i
+			reps = append(reps, i)
+			repOf[i] = i
+		}
+	} else {
+		for _, i := range order {
+			pos := findCompatible(records, reps, records[i].Seq, threads)
+			if pos == -1 {
+				reps = append(reps, i)
+				repOf[i] = i
+			} else {
+				repOf[i] = reps[pos]
+			}
+		}
+	}
+
+	DA := encoding.MakeDecodingArray()
+	for i, EFR := range records {
+		if repOf[i] != i {
+			continue
+		}
+		seq := make([]byte, len(EFR.Seq))
+		for j, nuc := range EFR.Seq {
+			seq[j] = DA[nuc][0]
+		}
+		_, err = out.Write([]byte(">" + EFR.ID + "\n" + string(seq) + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if table != nil {
+		_, err = table.Write([]byte("query,representative\n"))
+		if err != nil {
+			return err
+		}
+		for i, EFR := range records {
+			if repOf[i] == i {
+				continue
+			}
+			_, err = table.Write([]byte(EFR.ID + "," + records[repOf[i]].ID + "\n"))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "kept %d of %d sequences\n", len(reps), len(records))
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package dedup
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+var msaData = []byte(`>seq1
+ATGATNATGA
+>seq2
+ATGATGATGA
+>seq3
+ATGATGATRA
+>seq4
+ATGATGATCA
+>seq5
+ATGATGATGA
+>seq6
+ATG---ATGA
+`)
+
+func TestDedup(t *testing.T) {
+	out := new(bytes.Buffer)
+	table := new(bytes.Buffer)
+	err := Dedup(bytes.NewReader(msaData), false, false, out, table, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>seq2
+ATGATGATGA
+>seq4
+ATGATGATCA
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestDedup")
+		t.Error(out.String())
+	}
+
+	desiredTable := `query,representative
+seq1,seq2
+seq3,seq2
+seq5,seq2
+seq6,seq2
+`
+	if table.String() != desiredTable {
+		t.Errorf("problem in TestDedup (table)")
+		t.Error(table.String())
+	}
+}
+
+func TestDedupExactHardGaps(t *testing.T) {
+	out := new(bytes.Buffer)
+	table := new(bytes.Buffer)
+	err := Dedup(bytes.NewReader(msaData), true, true, out, table, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredTable := `query,representative
+seq5,seq2
+`
+	if table.String() != desiredTable {
+		t.Errorf("problem in TestDedupExactHardGaps")
+		t.Error(table.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = Dedup(bytes.NewReader(msaData), false, true, out, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `>seq2
+ATGATGATGA
+>seq4
+ATGATGATCA
+>seq6
+ATG---ATGA
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestDedupExactHardGaps (hard gaps)")
+		t.Error(out.String())
+	}
+}
+
+// the result mustn't depend on the number of threads that the search for representatives is split over
+func TestDedupThreads(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	buf := new(bytes.Buffer)
+	for i := 0; i < 200; i++ {
+		seq := []byte("ATGATGATGATGATGATGAT")
+		for j := 0; j < 3; j++ {
+			seq[r.Intn(len(seq))] = "ATGCN"[r.Intn(5)]
+		}
+		buf.WriteString(">seq" + strconv.Itoa(i) + "\n" + string(seq) + "\n")
+	}
+
+	one := new(bytes.Buffer)
+	err := Dedup(bytes.NewReader(buf.Bytes()), false, false, new(bytes.Buffer), one, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := new(bytes.Buffer)
+	err = Dedup(bytes.NewReader(buf.Bytes()), false, false, new(bytes.Buffer), many, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.String() != many.String() {
+		t.Errorf("problem in TestDedupThreads: results differ")
+	}
+}
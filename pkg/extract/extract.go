@@ -0,0 +1,279 @@
+/*
+Package extract implements functions to extract regions (ranges of columns) from a multiple sequence
+alignment in fasta format, by reference coordinates.
+*/
+package extract
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/encoding"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/mask"
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+// Pieces is the sequence of every region for one record, such as its extracted columns (or, in package
+// translate, its proteins)
+type Pieces struct {
+	ID   string
+	Idx  int
+	Seqs []string
+}
+
+// columns converts regions in reference coordinates to the alignment columns they span (see mask.Columns).
+// refToMSA is from variants.GetMSAOffsets, or nil if the alignment is in reference coordinates.
+func columns(regions []Region, refToMSA []int, width int) ([]Region, error) {
+	cols := make([]Region, len(regions))
+	for i, r := range regions {
+		if r.Start < 0 || r.End <= r.Start {
+			return nil, errors.New("bad region to extract: " + r.Name)
+		}
+		col, err := mask.Columns(mask.Region{Start: r.Start, End: r.End}, refToMSA, width)
+		if err != nil {
+			return nil, errors.New("region to extract (" + r.Name + ") " + err.Error())
+		}
+		cols[i] = Region{Name: r.Name, Start: col.Start, End: col.End}
+	}
+	return cols, nil
+}
+
+// getPieces decodes the columns in cols for each record from a channel
+func getPieces(cols []Region, cMSA chan fasta.EncodedRecord, cPieces chan Pieces, cErr chan error) {
+	DA := encoding.MakeDecodingArray()
+	for EFR := range cMSA {
+		p := Pieces{ID: EFR.ID, Idx: EFR.Idx, Seqs: make([]string, len(cols))}
+		for i, col := range cols {
+			if col.End > len(EFR.Seq) {
+				cErr <- errors.New("sequence " + EFR.ID + " is shorter than the region to extract (" + col.Name + "): is this an alignment?")
+				return
+			}
+			var sb strings.Builder
+			sb.Grow(col.End - col.Start)
+			for _, nuc := range EFR.Seq[col.Start:col.End] {
+				sb.WriteString(DA[nuc])
+			}
+			p.Seqs[i] = sb.String()
+		}
+		cPieces <- p
+	}
+}
+
+// WritePieces writes each record's regions in input order, either to one writer per region, or (if there is
+// only one writer and concatenate is true) all concatenated together
+func WritePieces(outs []io.Writer, concatenate bool, cPieces chan Pieces, cErr chan error, cWriteDone chan bool) {
+	outputMap := make(map[int]Pieces)
+	counter := 0
+	var err error
+	for p := range cPieces {
+		outputMap[p.Idx] = p
+		for {
+			if p, ok := outputMap[counter]; ok {
+				if concatenate {
+					_, err = outs[0].Write([]byte(">" + p.ID + "\n" + strings.Join(p.Seqs, "") + "\n"))
+				} else {
+					for i := range outs {
+						_, err = outs[i].Write([]byte(">" + p.ID + "\n" + p.Seqs[i] + "\n"))
+						if err != nil {
+							break
+						}
+					}
+				}
+				if err != nil {
+					cErr <- err
+					return
+				}
+				delete(outputMap, counter)
+				counter++
+			} else {
+				break
+			}
+		}
+	}
+	cWriteDone <- true
+}
+
+// FileNames returns a file name for the alignment of each of the regions called names, making sure they are
+// all different
+func FileNames(regionNames []string) []string {
+	names := make([]string, len(regionNames))
+	seen := make(map[string]int)
+	for i, r := range regionNames {
+		name := strings.NewReplacer("/", "_", " ", "_").Replace(r)
+		seen[name]++
+		if seen[name] > 1 {
+			name = name + "_" + strconv.Itoa(seen[name])
+		}
+		names[i] = name + ".fasta"
+	}
+	return names
+}
+
+// A Partition is one region of a concatenated alignment, with its length in columns
+type Partition struct {
+	Name   string
+	Length int
+}
+
+// WritePartitions writes the position of each region in a concatenated alignment, as a nexus format sets
+// block that phylogenetics programs such as IQ-TREE can read
+func WritePartitions(w io.Writer, partitions []Partition) error {
+	_, err := w.Write([]byte("#nexus\nbegin sets;\n"))
+	if err != nil {
+		return err
+	}
+	start := 1
+	for _, p := range partitions {
+		length := p.Length
+		_, err = w.Write([]byte("\tcharset " + strings.ReplaceAll(p.Name, " ", "_") + " = " + strconv.Itoa(start) + "-" + strconv.Itoa(start+length-1) + ";\n"))
+		if err != nil {
+			return err
+		}
+		start += length
+	}
+	_, err = w.Write([]byte("end;\n"))
+	return err
+}
+
+// Extract writes the columns of an alignment that are in regions. Regions are in reference coordinates. If refID
+// is "", the alignment must be in reference coordinates, otherwise refID is the ID of the reference sequence in
+// the alignment, which is used to convert reference coordinates to alignment columns (any insertions relative to
+// the reference within a region are kept). Records that come before the reference in the alignment are held in
+// memory until it is found. If concatenated is nil, one alignment per region is written to outDir, otherwise all
+// the regions for each sequence are concatenated into one alignment, and the positions of each region in it are
+// written to partitions (if it isn't nil).
+func Extract(msaIn io.Reader, refID string, regions []Region, outDir string, concatenated io.Writer, partitions io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	if len(regions) == 0 {
+		return errors.New("no regions to extract")
+	}
+
+	cErr := make(chan error)
+
+	cEFR := make(chan fasta.EncodedRecord, threads)
+	cReadDone := make(chan bool)
+
+	cExtract := make(chan fasta.EncodedRecord, threads)
+	cPieces := make(chan Pieces, threads)
+	cPiecesDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go fasta.StreamEncodeAlignment(msaIn, cEFR, cErr, cReadDone, false, false, false)
+
+	held, ref, readDone, err := fasta.HoldToReference(cEFR, cErr, cReadDone, refID, func(EFR fasta.EncodedRecord) string { return EFR.ID })
+	if err != nil {
+		return err
+	}
+
+	var refToMSA []int
+	if refID != "" {
+		refToMSA, _ = variants.GetMSAOffsets(ref.Seq)
+	}
+
+	if len(held) == 0 {
+		return nil
+	}
+
+	cols, err := columns(regions, refToMSA, len(held[0].Seq))
+	if err != nil {
+		return err
+	}
+
+	var outs []io.Writer
+	if concatenated != nil {
+		outs = []io.Writer{concatenated}
+		if partitions != nil {
+			ps := make([]Partition, len(cols))
+			for i, c := range cols {
+				ps[i] = Partition{Name: c.Name, Length: c.End - c.Start}
+			}
+			err = WritePartitions(partitions, ps)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		names := make([]string, len(regions))
+		for i, r := range regions {
+			names[i] = r.Name
+		}
+		for _, name := range FileNames(names) {
+			f, err := gfio.Create(filepath.Join(outDir, name))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			outs = append(outs, f)
+		}
+	}
+
+	go func() {
+		for _, EFR := range held {
+			cExtract <- EFR
+		}
+		for EFR := range cEFR {
+			cExtract <- EFR
+		}
+		close(cExtract)
+	}()
+
+	go WritePieces(outs, concatenated != nil, cPieces, cErr, cWriteDone)
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			getPieces(cols, cExtract, cPieces, cErr)
+			wg.Done()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cPiecesDone <- true
+	}()
+
+	for n := 1; n > 0 && !readDone; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cEFR)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cPiecesDone:
+			close(cPieces)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package extract
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var msaData = []byte(`>seq1
+ATGACATGCA
+>ref
+ATG-CATGCA
+>seq2
+AT--CANNCA
+`)
+
+var gffData = []byte(`##gff-version 3
+##sequence-region ref 1 9
+ref	.	gene	3	5	.	+	.	ID=gene-a;Name=a
+ref	.	CDS	8	9	.	+	0	ID=cds-b;Name=b
+ref	.	CDS	2	2	.	+	0	ID=cds-b2;Name=b
+`)
+
+func TestExtract(t *testing.T) {
+	regions, err := ParseRanges("3-5,8-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	partitions := new(bytes.Buffer)
+	err = Extract(bytes.NewReader(msaData), "ref", regions, "", out, partitions, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>seq1
+GACACA
+>ref
+G-CACA
+>seq2
+--CACA
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestExtract")
+		t.Error(out.String())
+	}
+
+	desiredPartitions := `#nexus
+begin sets;
+	charset 3-5 = 1-4;
+	charset 8-9 = 5-6;
+end;
+`
+	if partitions.String() != desiredPartitions {
+		t.Errorf("problem in TestExtract (partitions)")
+		t.Error(partitions.String())
+	}
+
+	// without a reference, the positions are alignment columns
+	out = new(bytes.Buffer)
+	err = Extract(bytes.NewReader(msaData), "", regions, "", out, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `>seq1
+GACGC
+>ref
+G-CGC
+>seq2
+--CNC
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestExtract (no reference)")
+		t.Error(out.String())
+	}
+
+	regions, _ = ParseRanges("8-10")
+	err = Extract(bytes.NewReader(msaData), "ref", regions, "", new(bytes.Buffer), nil, 1)
+	if err == nil {
+		t.Errorf("expected an error for a region beyond the end of the reference")
+	}
+}
+
+func TestExtractFeatures(t *testing.T) {
+	regions, err := Features(bytes.NewReader(gffData), "gff", []string{"b", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || regions[0] != (Region{Name: "b", Start: 1, End: 9}) || regions[1] != (Region{Name: "a", Start: 2, End: 5}) {
+		t.Errorf("problem in TestExtractFeatures")
+		t.Error(regions)
+	}
+
+	_, err = Features(bytes.NewReader(gffData), "gff", []string{"c"})
+	if err == nil {
+		t.Errorf("expected an error for a missing feature")
+	}
+
+	dir := t.TempDir()
+	err = Extract(bytes.NewReader(msaData), "ref", regions[1:], dir, nil, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "a.fasta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `>seq1
+GACA
+>ref
+G-CA
+>seq2
+--CA
+`
+	if string(b) != desiredResult {
+		t.Errorf("problem in TestExtractFeatures (a.fasta)")
+		t.Error(string(b))
+	}
+}
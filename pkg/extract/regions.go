@@ -0,0 +1,151 @@
+package extract
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/virus-evolution/gofasta/pkg/genbank"
+	"github.com/virus-evolution/gofasta/pkg/gff"
+	"github.com/virus-evolution/gofasta/pkg/mask"
+)
+
+// Region is a named range of sites to extract, in 0-based, half-open reference coordinates (like BED)
+type Region struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// rangeName names a region by its 1-based, inclusive reference coordinates
+func rangeName(start, end int) string {
+	return strconv.Itoa(start+1) + "-" + strconv.Itoa(end)
+}
+
+// fromMask names regions read by package mask by their coordinates
+func fromMask(mr []mask.Region) []Region {
+	regions := make([]Region, len(mr))
+	for i, r := range mr {
+		regions[i] = Region{Name: rangeName(r.Start, r.End), Start: r.Start, End: r.End}
+	}
+	return regions
+}
+
+// ParseRanges parses a comma-separated list of 1-based, inclusive ranges or single positions, e.g. "266-21555,21563-25384"
+func ParseRanges(s string) ([]Region, error) {
+	mr, err := mask.ParseRanges(s, ",")
+	if err != nil {
+		return nil, err
+	}
+	return fromMask(mr), nil
+}
+
+// ReadBED reads the regions in a BED file, in the same way as gofasta mask
+func ReadBED(r io.Reader) ([]Region, error) {
+	mr, err := mask.ReadBED(r)
+	if err != nil {
+		return nil, err
+	}
+	return fromMask(mr), nil
+}
+
+// span is the first and last (1-based) position of all the features with one name
+type span struct {
+	start int
+	end   int
+}
+
+func (s *span) add(start, end int) {
+	if s.start == 0 || start < s.start {
+		s.start = start
+	}
+	if end > s.end {
+		s.end = end
+	}
+}
+
+// spansFromGenbank finds the span of the features in a genbank file by their gene, product and locus_tag qualifiers
+func spansFromGenbank(gb genbank.Genbank) (map[string]*span, error) {
+	spans := make(map[string]*span)
+	for _, f := range gb.FEATURES {
+		if f.Feature == "source" {
+			continue
+		}
+		var pos []int
+		for _, tag := range []string{"gene", "product", "locus_tag"} {
+			if !f.HasAttribute(tag) {
+				continue
+			}
+			if pos == nil {
+				var err error
+				pos, err = f.Location.GetPositions()
+				if err != nil {
+					return nil, err
+				}
+			}
+			name := f.Info[tag]
+			if _, ok := spans[name]; !ok {
+				spans[name] = &span{}
+			}
+			for _, p := range pos {
+				spans[name].add(p, p)
+			}
+		}
+	}
+	return spans, nil
+}
+
+// spansFromGFF finds the span of the features in a gff file by their Name, ID and gene attributes
+func spansFromGFF(g gff.GFF) map[string]*span {
+	spans := make(map[string]*span)
+	for _, f := range g.Features {
+		for _, tag := range []string{"Name", "ID", "gene"} {
+			if !f.HasAttribute(tag) {
+				continue
+			}
+			for _, name := range f.Attributes[tag] {
+				if _, ok := spans[name]; !ok {
+					spans[name] = &span{}
+				}
+				spans[name].add(f.Start, f.End)
+			}
+		}
+	}
+	return spans
+}
+
+// Features finds the named features in a genbank (annoSuffix "gb") or gff (annoSuffix "gff") annotation. Each
+// region is the span from the first to the last position of every feature with that name (so a gene that
+// is split into several CDS features, or has several mat_peptides, is extracted in one piece).
+func Features(annoIn io.Reader, annoSuffix string, names []string) ([]Region, error) {
+	var spans map[string]*span
+	switch annoSuffix {
+	case "gb":
+		gb, err := genbank.ReadGenBank(annoIn)
+		if err != nil {
+			return nil, err
+		}
+		spans, err = spansFromGenbank(gb)
+		if err != nil {
+			return nil, err
+		}
+	case "gff":
+		g, err := gff.ReadGFF(annoIn)
+		if err != nil {
+			return nil, err
+		}
+		spans = spansFromGFF(g)
+	default:
+		return nil, errors.New("couldn't tell if the annotation was a .gb or a .gff file")
+	}
+
+	regions := make([]Region, 0, len(names))
+	for _, name := range names {
+		s, ok := spans[name]
+		if !ok || s.end == 0 {
+			return nil, errors.New("couldn't find a feature called " + name + " in the annotation")
+		}
+		regions = append(regions, Region{Name: name, Start: s.start - 1, End: s.end})
+	}
+	return regions, nil
+}
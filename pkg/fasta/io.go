@@ -149,7 +149,8 @@ func StreamAlignment(f io.Reader, cR chan Record, cErr chan error, cDone chan bo
 // StreamEncodeAlignment reads an alignment in fasta format to a channel of
 // Record structs - converting the nucleotide sequence to EP's bitwise coding
 // scheme optionally with or without hard gaps, scoring each record and getting
-// ATGC counts
+// ATGC counts. f may also be a pack file (see PackAlignment), in which case the records are
+// already encoded
 func StreamEncodeAlignment(
 	f io.Reader,
 	cER chan EncodedRecord,
@@ -159,7 +160,13 @@ func StreamEncodeAlignment(
 	atgc bool,
 	score bool) {
 
-	r := NewReader(f)
+	br := bufio.NewReader(f)
+	if IsPack(br) {
+		streamEncodePack(br, cER, cErr, cDone, hardGaps, atgc, score)
+		return
+	}
+
+	r := NewReader(br)
 	counter := 0
 	var width int
 	for {
@@ -237,6 +244,46 @@ func LoadEncodeAlignment(
 	return encodedRecords, nil
 }
 
+// HoldToReference receives records from cR, which StreamAlignment or StreamEncodeAlignment is sending to,
+// until it has received the reference, whose id (as returned by id) is refID, or if refID is "", until it has
+// received the first record. It returns every record it received, in order (so the reference may not be the
+// last one), and the reference. If the stream finished first, cR has been closed and drained and readDone is
+// true, so the caller mustn't wait for cDone. It is an error if refID isn't "" and the reference isn't found.
+func HoldToReference[T Record | EncodedRecord](cR chan T, cErr chan error, cDone chan bool, refID string, id func(T) string) (held []T, ref T, readDone bool, err error) {
+
+	held = make([]T, 0)
+
+	for found := false; !found; {
+		select {
+		case err = <-cErr:
+			return nil, ref, false, err
+		case r := <-cR:
+			held = append(held, r)
+			if refID == "" || id(r) == refID {
+				ref = r
+				found = true
+			}
+		case <-cDone:
+			// there may still be records in the channel's buffer
+			close(cR)
+			readDone = true
+			for r := range cR {
+				held = append(held, r)
+				if !found && (refID == "" || id(r) == refID) {
+					ref = r
+					found = true
+				}
+			}
+			if !found && refID != "" {
+				return nil, ref, true, errors.New("couldn't find reference (" + refID + ") in msa")
+			}
+			found = true
+		}
+	}
+
+	return held, ref, readDone, nil
+}
+
 // WriteAlignment reads Records from a channel and writes them to file or stdout,
 // in the order in which they are present in the input file.
 // It passes a true to a done channel when the channel of fasta records is empty
@@ -423,3 +423,52 @@ GATG
 		t.Errorf("Problem in TestWriteWrapAlignment()")
 	}
 }
+
+// the stream can finish while the reference is still in the channel's buffer, so HoldToReference mustn't miss it
+func TestHoldToReference(t *testing.T) {
+	source := []Record{
+		{ID: "Seq1", Seq: "ATGATGATG", Idx: 0},
+		{ID: "Seq2", Seq: "ATGATGATG", Idx: 1},
+		{ID: "Ref", Seq: "ATG---ATG", Idx: 2},
+	}
+
+	id := func(FR Record) string { return FR.ID }
+
+	stream := func() (chan Record, chan error, chan bool) {
+		cFR := make(chan Record, len(source))
+		cDone := make(chan bool, 1)
+		for _, record := range source {
+			cFR <- record
+		}
+		cDone <- true
+		return cFR, make(chan error), cDone
+	}
+
+	for i := 0; i < 20; i++ {
+		cFR, cErr, cDone := stream()
+		held, ref, readDone, err := HoldToReference(cFR, cErr, cDone, "Ref", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref.ID != "Ref" || len(held) != 3 || held[0].ID != "Seq1" {
+			t.Errorf("problem in TestHoldToReference()")
+			t.Fatal(held, ref, readDone)
+		}
+
+		cFR, cErr, cDone = stream()
+		held, ref, _, err = HoldToReference(cFR, cErr, cDone, "", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref.ID != "Seq1" || len(held) == 0 || held[0].ID != "Seq1" {
+			t.Errorf("problem in TestHoldToReference() (no reference)")
+			t.Fatal(held, ref)
+		}
+
+		cFR, cErr, cDone = stream()
+		_, _, _, err = HoldToReference(cFR, cErr, cDone, "notthere", id)
+		if err == nil {
+			t.Errorf("expected an error for a missing reference in TestHoldToReference()")
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package fasta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/mmap"
+)
+
+/*
+A pack file stores an alignment that has already been encoded using EP's scheme, along with each
+record's completeness score and ATGC counts, so that it doesn't have to be parsed and encoded again
+every time it is read. All integers are little-endian. The layout is:
+
+	header:  magic (8 bytes), version (uint32), alignment width (uint32)
+	records: for each record, 'R', len(ID) (uint32), len(Description) (uint32), Score (int64),
+	         Count_A, Count_T, Count_G, Count_C (uint32 each), ID, Description, Seq (width bytes)
+	index:   'I', number of records (uint64), then for each record its offset from the start of
+	         the file (uint64), len(ID) (uint32) and ID
+	footer:  offset of the index (uint64), magic (8 bytes)
+
+Sequences are always stored with soft gaps, and converted to hard gaps on reading if need be. Because
+the records come before the index a pack can be streamed from start to finish (e.g. from stdin), and
+because of the index a pack file on disk can be memory-mapped and single records can be read by ID.
+*/
+
+var packMagic = []byte("GOFAPACK")
+
+const packVersion uint32 = 1
+
+const (
+	packRecordTag byte = 'R'
+	packIndexTag  byte = 'I'
+)
+
+// the size of the fixed-length part of a record, from its tag to the start of its ID
+const packRecordHeaderLen = 1 + 4 + 4 + 8 + 4*4
+
+var (
+	errNotPack         = errors.New("not a gofasta pack file")
+	errBadPackVersion  = errors.New("unsupported gofasta pack file version")
+	errBadlyFormedPack = errors.New("badly formed gofasta pack file")
+)
+
+// IsPack reports whether the buffered input starts with the pack file magic number, without consuming it
+func IsPack(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(packMagic))
+	return bytes.Equal(magic, packMagic)
+}
+
+// PackWriter writes EncodedRecords to a pack file
+type PackWriter struct {
+	w       *bufio.Writer
+	offset  uint64
+	width   int
+	offsets []uint64
+	ids     []string
+}
+
+// NewPackWriter returns a PackWriter that writes to w, having written the pack file header. All
+// the records written must be width long.
+func NewPackWriter(w io.Writer, width int) (*PackWriter, error) {
+	pw := &PackWriter{w: bufio.NewWriter(w), width: width}
+	header := make([]byte, 0, len(packMagic)+8)
+	header = append(header, packMagic...)
+	header = binary.LittleEndian.AppendUint32(header, packVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(width))
+	err := pw.write(header)
+	if err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *PackWriter) write(b []byte) error {
+	_, err := pw.w.Write(b)
+	pw.offset += uint64(len(b))
+	return err
+}
+
+// Write writes one record to the pack. Its sequence must be encoded with soft gaps, and its Score
+// and ATGC counts should already have been calculated.
+func (pw *PackWriter) Write(EFR EncodedRecord) error {
+	if len(EFR.Seq) != pw.width {
+		return errDiffLenSeqs
+	}
+	pw.offsets = append(pw.offsets, pw.offset)
+	pw.ids = append(pw.ids, EFR.ID)
+
+	b := make([]byte, 0, packRecordHeaderLen+len(EFR.ID)+len(EFR.Description))
+	b = append(b, packRecordTag)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(EFR.ID)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(EFR.Description)))
+	b = binary.LittleEndian.AppendUint64(b, uint64(EFR.Score))
+	b = binary.LittleEndian.AppendUint32(b, uint32(EFR.Count_A))
+	b = binary.LittleEndian.AppendUint32(b, uint32(EFR.Count_T))
+	b = binary.LittleEndian.AppendUint32(b, uint32(EFR.Count_G))
+	b = binary.LittleEndian.AppendUint32(b, uint32(EFR.Count_C))
+	b = append(b, EFR.ID...)
+	b = append(b, EFR.Description...)
+	err := pw.write(b)
+	if err != nil {
+		return err
+	}
+	return pw.write(EFR.Seq)
+}
+
+// Close writes the index and footer of the pack and flushes the output. It does not close the
+// underlying writer.
+func (pw *PackWriter) Close() error {
+	indexOffset := pw.offset
+
+	b := make([]byte, 0, 9)
+	b = append(b, packIndexTag)
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(pw.offsets)))
+	err := pw.write(b)
+	if err != nil {
+		return err
+	}
+	for i := range pw.offsets {
+		b = b[:0]
+		b = binary.LittleEndian.AppendUint64(b, pw.offsets[i])
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(pw.ids[i])))
+		b = append(b, pw.ids[i]...)
+		err = pw.write(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	b = b[:0]
+	b = binary.LittleEndian.AppendUint64(b, indexOffset)
+	b = append(b, packMagic...)
+	err = pw.write(b)
+	if err != nil {
+		return err
+	}
+
+	return pw.w.Flush()
+}
+
+// PackAlignment reads an alignment (which may be in fasta format or already be a pack) and
+// writes it to out as a pack
+func PackAlignment(in io.Reader, out io.Writer) error {
+
+	cER := make(chan EncodedRecord)
+	cErr := make(chan error)
+	cDone := make(chan bool)
+
+	go StreamEncodeAlignment(in, cER, cErr, cDone, false, true, true)
+
+	var pw *PackWriter
+	var err error
+
+	for n := 1; n > 0; {
+		select {
+		case EFR := <-cER:
+			if pw == nil {
+				pw, err = NewPackWriter(out, len(EFR.Seq))
+				if err != nil {
+					return err
+				}
+			}
+			err = pw.Write(EFR)
+			if err != nil {
+				return err
+			}
+		case err := <-cErr:
+			return err
+		case <-cDone:
+			n--
+		}
+	}
+
+	return pw.Close()
+}
+
+// readPackHeader checks the magic number and version of a pack and returns the alignment width
+func readPackHeader(header []byte) (int, error) {
+	if len(header) < len(packMagic)+8 || !bytes.Equal(header[:len(packMagic)], packMagic) {
+		return 0, errNotPack
+	}
+	if binary.LittleEndian.Uint32(header[len(packMagic):]) != packVersion {
+		return 0, errBadPackVersion
+	}
+	return int(binary.LittleEndian.Uint32(header[len(packMagic)+4:])), nil
+}
+
+// parsePackRecordHeader gets the lengths of the ID and Description, and the precomputed values,
+// from the fixed-length part of a record
+func parsePackRecordHeader(b []byte) (idLen int, descLen int, EFR EncodedRecord, err error) {
+	if b[0] != packRecordTag {
+		return 0, 0, EFR, errBadlyFormedPack
+	}
+	idLen = int(binary.LittleEndian.Uint32(b[1:]))
+	descLen = int(binary.LittleEndian.Uint32(b[5:]))
+	EFR.Score = int64(binary.LittleEndian.Uint64(b[9:]))
+	EFR.Count_A = int(binary.LittleEndian.Uint32(b[17:]))
+	EFR.Count_T = int(binary.LittleEndian.Uint32(b[21:]))
+	EFR.Count_G = int(binary.LittleEndian.Uint32(b[25:]))
+	EFR.Count_C = int(binary.LittleEndian.Uint32(b[29:]))
+	return idLen, descLen, EFR, nil
+}
+
+// finishPackRecord does any conversion a caller of StreamEncodeAlignment asked for to a record
+// read from a pack, whose sequence has soft gaps and whose Score and ATGC counts are already set
+func finishPackRecord(EFR *EncodedRecord, hardGaps bool, atgc bool, score bool) {
+	if hardGaps {
+		for i := range EFR.Seq {
+			if EFR.Seq[i] == 244 {
+				EFR.Seq[i] = 4
+			}
+		}
+		if score {
+			EFR.CalculateCompleteness()
+		}
+	}
+	if !score {
+		EFR.Score = 0
+	}
+	if !atgc {
+		EFR.Count_A, EFR.Count_T, EFR.Count_G, EFR.Count_C = 0, 0, 0, 0
+	}
+}
+
+// streamEncodePack is StreamEncodeAlignment for pack format input, which it reads sequentially
+func streamEncodePack(
+	r *bufio.Reader,
+	cER chan EncodedRecord,
+	cErr chan error,
+	cDone chan bool,
+	hardGaps bool,
+	atgc bool,
+	score bool) {
+
+	header := make([]byte, len(packMagic)+8)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		cErr <- errBadlyFormedPack
+		return
+	}
+	width, err := readPackHeader(header)
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	counter := 0
+	recordHeader := make([]byte, packRecordHeaderLen)
+	for {
+		tag, err := r.Peek(1)
+		if err != nil {
+			cErr <- errBadlyFormedPack
+			return
+		}
+		if tag[0] == packIndexTag {
+			break
+		}
+		_, err = io.ReadFull(r, recordHeader)
+		if err != nil {
+			cErr <- errBadlyFormedPack
+			return
+		}
+		idLen, descLen, EFR, err := parsePackRecordHeader(recordHeader)
+		if err != nil {
+			cErr <- err
+			return
+		}
+		rest := make([]byte, idLen+descLen+width)
+		_, err = io.ReadFull(r, rest)
+		if err != nil {
+			cErr <- errBadlyFormedPack
+			return
+		}
+		EFR.ID = string(rest[:idLen])
+		EFR.Description = string(rest[idLen : idLen+descLen])
+		EFR.Seq = rest[idLen+descLen:]
+		EFR.Idx = counter
+		finishPackRecord(&EFR, hardGaps, atgc, score)
+		cER <- EFR
+		counter++
+	}
+
+	// drain the index so that whatever is upstream of us doesn't block
+	_, err = io.Copy(io.Discard, r)
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	if counter == 0 {
+		cErr <- errEmptyFasta
+		return
+	}
+	cDone <- true
+}
+
+// PackReader gives random access to the records in a pack file, which is memory-mapped
+type PackReader struct {
+	m       *mmap.ReaderAt
+	width   int
+	offsets []int64
+	ids     map[string]int
+}
+
+// OpenPack memory-maps the pack file at path and reads its index
+func OpenPack(path string) (*PackReader, error) {
+	m, err := mmap.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPackReader(m)
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func newPackReader(m *mmap.ReaderAt) (*PackReader, error) {
+
+	footerLen := 8 + len(packMagic)
+	if m.Len() < len(packMagic)+8+footerLen {
+		return nil, errNotPack
+	}
+
+	header := make([]byte, len(packMagic)+8)
+	_, err := m.ReadAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+	width, err := readPackHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	footer := make([]byte, footerLen)
+	_, err = m.ReadAt(footer, int64(m.Len()-footerLen))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(footer[8:], packMagic) {
+		return nil, errBadlyFormedPack
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer))
+	if indexOffset < 0 || indexOffset >= int64(m.Len()-footerLen) {
+		return nil, errBadlyFormedPack
+	}
+
+	index := make([]byte, int64(m.Len()-footerLen)-indexOffset)
+	_, err = m.ReadAt(index, indexOffset)
+	if err != nil {
+		return nil, err
+	}
+	if len(index) < 9 || index[0] != packIndexTag {
+		return nil, errBadlyFormedPack
+	}
+	n := binary.LittleEndian.Uint64(index[1:])
+	index = index[9:]
+
+	p := &PackReader{m: m, width: width, offsets: make([]int64, 0, n), ids: make(map[string]int, n)}
+	for i := 0; i < int(n); i++ {
+		if len(index) < 12 {
+			return nil, errBadlyFormedPack
+		}
+		offset := int64(binary.LittleEndian.Uint64(index))
+		idLen := int(binary.LittleEndian.Uint32(index[8:]))
+		if len(index) < 12+idLen {
+			return nil, errBadlyFormedPack
+		}
+		id := string(index[12 : 12+idLen])
+		index = index[12+idLen:]
+
+		p.offsets = append(p.offsets, offset)
+		// if there are duplicate IDs, the first one wins
+		if _, ok := p.ids[id]; !ok {
+			p.ids[id] = i
+		}
+	}
+
+	return p, nil
+}
+
+// Close unmaps the pack file
+func (p *PackReader) Close() error {
+	return p.m.Close()
+}
+
+// Len returns the number of records in the pack
+func (p *PackReader) Len() int {
+	return len(p.offsets)
+}
+
+// Width returns the width of the alignment in the pack
+func (p *PackReader) Width() int {
+	return p.width
+}
+
+// Record returns the ith record in the pack, with soft gaps and its Score and ATGC counts set
+func (p *PackReader) Record(i int) (EncodedRecord, error) {
+	if i < 0 || i >= len(p.offsets) {
+		return EncodedRecord{}, fmt.Errorf("record %d is out of range for a pack with %d records", i, len(p.offsets))
+	}
+	recordHeader := make([]byte, packRecordHeaderLen)
+	_, err := p.m.ReadAt(recordHeader, p.offsets[i])
+	if err != nil {
+		return EncodedRecord{}, err
+	}
+	idLen, descLen, EFR, err := parsePackRecordHeader(recordHeader)
+	if err != nil {
+		return EncodedRecord{}, err
+	}
+	rest := make([]byte, idLen+descLen+p.width)
+	_, err = p.m.ReadAt(rest, p.offsets[i]+packRecordHeaderLen)
+	if err != nil {
+		return EncodedRecord{}, err
+	}
+	EFR.ID = string(rest[:idLen])
+	EFR.Description = string(rest[idLen : idLen+descLen])
+	EFR.Seq = rest[idLen+descLen:]
+	EFR.Idx = i
+	return EFR, nil
+}
+
+// Lookup returns the record in the pack with this ID (the first one, if there are several)
+func (p *PackReader) Lookup(id string) (EncodedRecord, error) {
+	i, ok := p.ids[id]
+	if !ok {
+		return EncodedRecord{}, fmt.Errorf("couldn't find %s in the pack", id)
+	}
+	return p.Record(i)
+}
+
+// Has reports whether there is a record in the pack with this ID
+func (p *PackReader) Has(id string) bool {
+	_, ok := p.ids[id]
+	return ok
+}
+
+// UnpackAlignment reads an alignment (normally a pack, but fasta works too) and writes it to out
+// in fasta format
+func UnpackAlignment(in io.Reader, out io.Writer) error {
+
+	cER := make(chan EncodedRecord)
+	cR := make(chan Record)
+	cErr := make(chan error)
+	cReadDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go StreamEncodeAlignment(in, cER, cErr, cReadDone, false, false, false)
+
+	go WriteAlignment(cR, out, cErr, cWriteDone)
+
+	for n := 1; n > 0; {
+		select {
+		case EFR := <-cER:
+			cR <- EFR.Decode()
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cR)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
+
+// UnpackIDs looks up each of ids in a pack and writes the records to out in fasta format, in
+// the order they are given
+func UnpackIDs(p *PackReader, ids []string, out io.Writer) error {
+	for _, id := range ids {
+		EFR, err := p.Lookup(id)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write([]byte(">" + EFR.ID + "\n" + EFR.Decode().Seq + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package fasta
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var packAlignmentData = []byte(`>seq1 a description
+ATGATC-NNA
+>seq2
+ATGATGRYAC
+>seq3
+AT--TCATGT
+`)
+
+func TestPackStreamEncodeAlignment(t *testing.T) {
+
+	pack := new(bytes.Buffer)
+	err := PackAlignment(bytes.NewReader(packAlignmentData), pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hardGaps := range []bool{false, true} {
+		for _, atgc := range []bool{false, true} {
+			for _, score := range []bool{false, true} {
+				fromFasta, err := LoadEncodeAlignment(bytes.NewReader(packAlignmentData), hardGaps, atgc, score)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fromPack, err := LoadEncodeAlignment(bytes.NewReader(pack.Bytes()), hardGaps, atgc, score)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(fromFasta, fromPack) {
+					t.Errorf("problem in TestPackStreamEncodeAlignment (hardGaps: %t, atgc: %t, score: %t)", hardGaps, atgc, score)
+				}
+			}
+		}
+	}
+}
+
+func TestUnpackAlignment(t *testing.T) {
+
+	pack := new(bytes.Buffer)
+	err := PackAlignment(bytes.NewReader(packAlignmentData), pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	err = UnpackAlignment(pack, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>seq1
+ATGATC-NNA
+>seq2
+ATGATGRYAC
+>seq3
+AT--TCATGT
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestUnpackAlignment")
+		t.Error(out.String())
+	}
+}
+
+func TestPackReader(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "test.pack")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PackAlignment(bytes.NewReader(packAlignmentData), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p, err := OpenPack(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if p.Len() != 3 || p.Width() != 10 {
+		t.Errorf("problem in TestPackReader: wrong dimensions (%d x %d)", p.Len(), p.Width())
+	}
+
+	expected, err := LoadEncodeAlignment(bytes.NewReader(packAlignmentData), false, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range expected {
+		EFR, err := p.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(EFR, expected[i]) {
+			t.Errorf("problem in TestPackReader: record %d", i)
+		}
+	}
+
+	EFR, err := p.Lookup("seq2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(EFR, expected[1]) {
+		t.Errorf("problem in TestPackReader: Lookup()")
+	}
+
+	if p.Has("seq4") {
+		t.Errorf("problem in TestPackReader: Has()")
+	}
+	_, err = p.Lookup("seq4")
+	if err == nil {
+		t.Errorf("problem in TestPackReader: expected an error looking up a missing ID")
+	}
+
+	out := new(bytes.Buffer)
+	err = UnpackIDs(p, []string{"seq3", "seq1"}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != ">seq3\nAT--TCATGT\n>seq1\nATGATC-NNA\n" {
+		t.Errorf("problem in TestPackReader: UnpackIDs()")
+	}
+}
+
+func TestOpenPackNotAPack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.fasta")
+	err := os.WriteFile(path, packAlignmentData, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenPack(path)
+	if err == nil {
+		t.Errorf("expected an error opening a fasta file as a pack")
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Package filter implements functions to keep or drop the sequences in a fasta format alignment
+according to their quality, their IDs, or their metadata.
+*/
+package filter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/virus-evolution/gofasta/pkg/encoding"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// Options are the criteria that a record must meet to be kept. The zero value of each field (or -1 for the
+// numeric ones, see NewOptions) means that criterion isn't used
+type Options struct {
+	MinCompleteness float64         // the minimum completeness score as a proportion of the maximum possible (i.e. of an all-ATGC sequence)
+	MaxNRun         int             // the longest allowed run of Ns
+	MinLength       int             // the minimum length, excluding alignment gaps
+	MaxLength       int             // the maximum length, excluding alignment gaps
+	Include         map[string]bool // if not nil, only keep records with these IDs
+	Exclude         map[string]bool // drop records with these IDs
+	IDRegex         *regexp.Regexp  // only keep records whose ID matches this
+	DescRegex       *regexp.Regexp  // only keep records whose description (the whole header line) matches this
+	Metadata        *Metadata       // if not nil, only keep records whose metadata matches all of Where
+	Where           []Predicate
+}
+
+// NewOptions returns an Options that keeps everything
+func NewOptions() Options {
+	return Options{MinCompleteness: -1, MaxNRun: -1, MinLength: -1, MaxLength: -1}
+}
+
+// keep is true if FR meets all the criteria in o
+func (o Options) keep(FR fasta.Record, scoring [256]int64) (bool, error) {
+
+	if o.Include != nil && !o.Include[FR.ID] {
+		return false, nil
+	}
+	if o.Exclude[FR.ID] {
+		return false, nil
+	}
+	if o.IDRegex != nil && !o.IDRegex.MatchString(FR.ID) {
+		return false, nil
+	}
+	if o.DescRegex != nil && !o.DescRegex.MatchString(FR.Description) {
+		return false, nil
+	}
+
+	if o.Metadata != nil {
+		row, ok := o.Metadata.rows[FR.ID]
+		if !ok {
+			return false, nil
+		}
+		for _, p := range o.Where {
+			match, err := p.match(o.Metadata, row)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				return false, nil
+			}
+		}
+	}
+
+	if o.MinCompleteness == -1 && o.MaxNRun == -1 && o.MinLength == -1 && o.MaxLength == -1 {
+		return true, nil
+	}
+
+	var (
+		score     int64
+		length    int
+		run, nRun int
+	)
+	for i := 0; i < len(FR.Seq); i++ {
+		nuc := FR.Seq[i]
+		score += scoring[nuc]
+		if nuc != '-' {
+			length++
+		}
+		if nuc == 'N' || nuc == 'n' || nuc == '?' {
+			run++
+			if run > nRun {
+				nRun = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	if o.MinCompleteness != -1 && (len(FR.Seq) == 0 || float64(score)/float64(12*len(FR.Seq)) < o.MinCompleteness) {
+		return false, nil
+	}
+	if o.MaxNRun != -1 && nRun > o.MaxNRun {
+		return false, nil
+	}
+	if o.MinLength != -1 && length < o.MinLength {
+		return false, nil
+	}
+	if o.MaxLength != -1 && length > o.MaxLength {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Filter streams the records in an alignment and writes the ones that meet all the criteria in o to out,
+// in the same order as in the input. If wrap is greater than 0, sequence lines are wrapped to that many
+// characters.
+func Filter(msaIn io.Reader, o Options, out io.Writer, wrap int) error {
+
+	cErr := make(chan error)
+
+	cFR := make(chan fasta.Record)
+	cReadDone := make(chan bool)
+
+	cKept := make(chan fasta.Record)
+	cFilterDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go fasta.StreamAlignment(msaIn, cFR, cErr, cReadDone)
+
+	var total, kept int
+
+	// records are renumbered as they are kept, so that the writer sees a contiguous run of indices
+	go func() {
+		scoring := encoding.MakeScoreArray()
+		for FR := range cFR {
+			total++
+			keep, err := o.keep(FR, scoring)
+			if err != nil {
+				cErr <- err
+				return
+			}
+			if keep {
+				FR.Idx = kept
+				cKept <- FR
+				kept++
+			}
+		}
+		cFilterDone <- true
+	}()
+
+	if wrap > 0 {
+		go fasta.WriteWrapAlignment(cKept, out, wrap, cErr, cWriteDone)
+	} else {
+		go fasta.WriteAlignment(cKept, out, cErr, cWriteDone)
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cFR)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cFilterDone:
+			close(cKept)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "kept %d of %d sequences\n", kept, total)
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package filter
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+var msaData = []byte(`>seq1 country=UK
+ATGATGATGA
+>seq2 country=FR
+ATGNNNNTGA
+>seq3 country=UK
+ATG---ATGA
+>seq4 country=US
+ATGATNATGA
+`)
+
+func TestFilterQuality(t *testing.T) {
+	o := NewOptions()
+	o.MaxNRun = 2
+	o.MinLength = 8
+
+	out := new(bytes.Buffer)
+	err := Filter(bytes.NewReader(msaData), o, out, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `>seq1
+ATGATGATGA
+>seq4
+ATGATNATGA
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestFilterQuality")
+		t.Error(out.String())
+	}
+
+	o = NewOptions()
+	o.MinCompleteness = 0.75
+
+	out = new(bytes.Buffer)
+	err = Filter(bytes.NewReader(msaData), o, out, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `>seq1
+ATGA
+TGAT
+GA
+>seq3
+ATG-
+--AT
+GA
+>seq4
+ATGA
+TNAT
+GA
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestFilterQuality (completeness)")
+		t.Error(out.String())
+	}
+}
+
+func TestFilterIDs(t *testing.T) {
+	o := NewOptions()
+	o.Exclude = map[string]bool{"seq1": true}
+	o.DescRegex = regexp.MustCompile("country=UK")
+
+	out := new(bytes.Buffer)
+	err := Filter(bytes.NewReader(msaData), o, out, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != ">seq3\nATG---ATGA\n" {
+		t.Errorf("problem in TestFilterIDs")
+		t.Error(out.String())
+	}
+
+	o = NewOptions()
+	o.Include = map[string]bool{"seq2": true, "seq4": true, "seq5": true}
+	o.IDRegex = regexp.MustCompile("4$")
+
+	out = new(bytes.Buffer)
+	err = Filter(bytes.NewReader(msaData), o, out, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != ">seq4\nATGATNATGA\n" {
+		t.Errorf("problem in TestFilterIDs (include)")
+		t.Error(out.String())
+	}
+}
+
+func TestFilterMetadata(t *testing.T) {
+	metadata := []byte(`sequence_name,date,lineage,count
+seq1,2021-01-05,B.1.1.7,10
+seq2,2020-12-20,B.1.1.7,2
+seq3,2021-02-01,B.1.177,9
+`)
+
+	m, err := ReadMetadata(bytes.NewReader(metadata), "sequence_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewOptions()
+	o.Metadata = m
+	for _, s := range []string{"date>=2021-01-01", "count<=9.5"} {
+		p, err := ParsePredicate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Where = append(o.Where, p)
+	}
+
+	out := new(bytes.Buffer)
+	err = Filter(bytes.NewReader(msaData), o, out, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != ">seq3\nATG---ATGA\n" {
+		t.Errorf("problem in TestFilterMetadata")
+		t.Error(out.String())
+	}
+
+	p, err := ParsePredicate("lineage!=B.1.1.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (Predicate{Column: "lineage", Op: "!=", Value: "B.1.1.7"}) {
+		t.Errorf("problem in TestFilterMetadata (ParsePredicate): %v", p)
+	}
+
+	// the expression is split at the first operator in it, whichever operator it is
+	for s, want := range map[string]Predicate{
+		"col<a=b":   {Column: "col", Op: "<", Value: "a=b"},
+		"col=a<b":   {Column: "col", Op: "=", Value: "a<b"},
+		"col<=a!=b": {Column: "col", Op: "<=", Value: "a!=b"},
+		"col>=a":    {Column: "col", Op: ">=", Value: "a"},
+	} {
+		p, err = ParsePredicate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != want {
+			t.Errorf("problem in TestFilterMetadata (ParsePredicate %s): %v", s, p)
+		}
+	}
+
+	_, err = ParsePredicate("lineage")
+	if err == nil {
+		t.Errorf("expected an error parsing a predicate without an operator")
+	}
+
+	o.Where = []Predicate{{Column: "country", Op: "=", Value: "UK"}}
+	err = Filter(bytes.NewReader(msaData), o, new(bytes.Buffer), 0)
+	if err == nil {
+		t.Errorf("expected an error for a predicate on a missing column")
+	}
+}
@@ -0,0 +1,118 @@
+package filter
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Metadata is a table of information about sequences, read from a csv file with a header
+type Metadata struct {
+	columns map[string]int
+	rows    map[string][]string
+}
+
+// ReadMetadata reads a csv file with a header, one of whose columns (idCol) is the sequence ID. If
+// idCol is "", the first column is used.
+func ReadMetadata(r io.Reader, idCol string) (*Metadata, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty metadata file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{columns: make(map[string]int), rows: make(map[string][]string)}
+	for i, name := range header {
+		m.columns[strings.TrimSpace(name)] = i
+	}
+
+	idIdx := 0
+	if idCol != "" {
+		var ok bool
+		idIdx, ok = m.columns[idCol]
+		if !ok {
+			return nil, errors.New("couldn't find column \"" + idCol + "\" in metadata")
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.rows[record[idIdx]] = record
+	}
+
+	return m, nil
+}
+
+// Predicate is a test on one column of the metadata, e.g. country=UK or date>=2021-01-01
+type Predicate struct {
+	Column string
+	Op     string
+	Value  string
+}
+
+// ParsePredicate parses an expression of the form column<op>value, where op is one of =, !=, <, <=, > or >=. The
+// expression is split at the first operator in it, so the value may contain operator characters (e.g. col<a=b)
+func ParsePredicate(s string) (Predicate, error) {
+	for i := 1; i < len(s); i++ {
+		// two-character operators have to be looked for first
+		for _, op := range []string{"!=", "<=", ">=", "=", "<", ">"} {
+			if strings.HasPrefix(s[i:], op) {
+				return Predicate{Column: strings.TrimSpace(s[:i]), Op: op, Value: strings.TrimSpace(s[i+len(op):])}, nil
+			}
+		}
+	}
+	return Predicate{}, errors.New("couldn't parse metadata predicate: " + s + " (expected e.g. country=UK or date>=2021-01-01)")
+}
+
+// compare returns -1, 0 or 1 as a is less than, equal to or greater than b. They are compared as numbers
+// if they both are numbers, otherwise as strings (which works for ISO 8601 dates)
+func compare(a, b string) int {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// match is true if a row of the metadata passes the test
+func (p Predicate) match(m *Metadata, row []string) (bool, error) {
+	i, ok := m.columns[p.Column]
+	if !ok {
+		return false, errors.New("couldn't find column \"" + p.Column + "\" in metadata")
+	}
+	c := compare(row[i], p.Value)
+	switch p.Op {
+	case "=":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, errors.New("unknown operator in metadata predicate: " + p.Op)
+}
@@ -14,15 +14,15 @@ import (
 // Genbank is a master struct containing information from a single genbank record
 type Genbank struct {
 	LOCUS struct {
-		Name     string
+		Name     string // implemented
 		Length   int
 		Type     string
 		Division string
 		Date     string
-	} // NOT implemented
+	} // only Name is implemented
 	DEFINITION string // NOT implemented
-	ACCESSION  string // NOT implemented
-	VERSION    string // NOT implemented
+	ACCESSION  string // implemented (the primary accession only)
+	VERSION    string // implemented
 	KEYWORDS   string // NOT implemented
 	SOURCE     struct {
 		Source   string
@@ -228,6 +228,23 @@ func parseGenbankORIGIN(field genbankField) []byte {
 	return seq
 }
 
+// parseHeaderLine sets the fields that are given on the first line of a top-level field: the LOCUS name, the
+// ACCESSION and the VERSION
+func (gb *Genbank) parseHeaderLine(line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return
+	}
+	switch fields[0] {
+	case "LOCUS":
+		gb.LOCUS.Name = fields[1]
+	case "ACCESSION":
+		gb.ACCESSION = fields[1]
+	case "VERSION":
+		gb.VERSION = fields[1]
+	}
+}
+
 // ReadGenBank reads a genbank annotation file and returns a struct that contains
 // parsed versions of the fields it contains. Not all fields are currently parsed.
 func ReadGenBank(r io.Reader) (Genbank, error) {
@@ -251,6 +268,7 @@ func ReadGenBank(r io.Reader) (Genbank, error) {
 		r, _ := utf8.DecodeRune([]byte{line[0]})
 
 		if unicode.IsUpper(r) {
+			gb.parseHeaderLine(line)
 			if first {
 				header = strings.Fields(line)[0]
 				first = false
@@ -286,3 +304,47 @@ func ReadGenBank(r io.Reader) (Genbank, error) {
 
 	return gb, nil
 }
+
+// ReadGenBankRecords reads a genbank file that may have more than one record in it (each ending with a "//" line),
+// such as the annotation of a segmented genome, and returns each record in the order they are in the file
+func ReadGenBankRecords(r io.Reader) ([]Genbank, error) {
+
+	gbs := make([]Genbank, 0)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var record strings.Builder
+	empty := true
+
+	for s.Scan() {
+		line := s.Text()
+		record.WriteString(line + "\n")
+		if len(strings.TrimSpace(line)) > 0 {
+			empty = false
+		}
+		if strings.HasPrefix(line, "//") {
+			gb, err := ReadGenBank(strings.NewReader(record.String()))
+			if err != nil {
+				return gbs, err
+			}
+			gbs = append(gbs, gb)
+			record.Reset()
+			empty = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		return gbs, err
+	}
+
+	// the last record might not have a "//" line
+	if !empty {
+		gb, err := ReadGenBank(strings.NewReader(record.String()))
+		if err != nil {
+			return gbs, err
+		}
+		gbs = append(gbs, gb)
+	}
+
+	return gbs, nil
+}
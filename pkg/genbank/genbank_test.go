@@ -160,3 +160,52 @@ ORIGIN
 		t.Errorf("Problem in TestReadGenbank()")
 	}
 }
+
+func TestReadGenBankRecords(t *testing.T) {
+	data := []byte(`LOCUS       CY121680                2341 bp    RNA     linear   VRL 25-JUL-2013
+ACCESSION   CY121680
+VERSION     CY121680.1
+FEATURES             Location/Qualifiers
+     CDS             1..6
+                     /gene="PB2"
+ORIGIN
+        1 atgaaa
+//
+LOCUS       CY121681                2341 bp    RNA     linear   VRL 25-JUL-2013
+ACCESSION   CY121681
+VERSION     CY121681.1
+FEATURES             Location/Qualifiers
+     CDS             1..3
+                     /gene="PB1"
+ORIGIN
+        1 atgccc
+//
+`)
+
+	gbs, err := ReadGenBankRecords(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gbs) != 2 {
+		t.Fatalf("problem in TestReadGenBankRecords: expected 2 records, got %d", len(gbs))
+	}
+
+	for i, desiredResult := range []struct {
+		name, accession, version, gene, origin string
+	}{
+		{"CY121680", "CY121680", "CY121680.1", "PB2", "atgaaa"},
+		{"CY121681", "CY121681", "CY121681.1", "PB1", "atgccc"},
+	} {
+		gb := gbs[i]
+		if gb.LOCUS.Name != desiredResult.name || gb.ACCESSION != desiredResult.accession || gb.VERSION != desiredResult.version {
+			t.Errorf("problem in TestReadGenBankRecords: record %d has LOCUS %s, ACCESSION %s, VERSION %s", i, gb.LOCUS.Name, gb.ACCESSION, gb.VERSION)
+		}
+		if len(gb.FEATURES) != 1 || gb.FEATURES[0].Info["gene"] != desiredResult.gene {
+			t.Errorf("problem in TestReadGenBankRecords: record %d features: %v", i, gb.FEATURES)
+		}
+		if string(gb.ORIGIN) != desiredResult.origin {
+			t.Errorf("problem in TestReadGenBankRecords: record %d ORIGIN: %s", i, gb.ORIGIN)
+		}
+	}
+}
@@ -1,16 +1,26 @@
 /*
 Package gfio provides io functionality, including to/from stdin/stderr,
-and helpful error messages when used in combination with bad filepaths
-from commandline options
+transparent (de)compression of gzip, bgzip, zstd and xz files, and helpful
+error messages when used in combination with bad filepaths from commandline options
 */
 package gfio
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"errors"
+	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
+	"github.com/biogo/hts/bgzf"
+	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/pflag"
+	"github.com/ulikunitz/xz"
 )
 
 // func (e *fs.PathError) Error() string { return e.Op + " " + e.Path + ": " + e.Err.Error() }
@@ -26,50 +36,270 @@ func parseInErr(err error, flagString string) error {
 	}
 }
 
-// OpenIn returns a pointer to a file object, which may be stdin, based on the argument provided
-// to a pflag flag on the command line.
-func OpenIn(flag pflag.Flag) (*os.File, error) {
-	var err error
-	var f *os.File
-
-	inFile := flag.Value.String()
-	var flagString string
-
+// flagString formats the name of a flag for error messages, e.g. "-r / --reference"
+func flagString(flag pflag.Flag) string {
 	switch len(flag.Shorthand) {
 	case 0:
-		flagString = "--" + flag.Name
+		return "--" + flag.Name
 	default:
-		flagString = "-" + flag.Shorthand + " / --" + flag.Name
+		return "-" + flag.Shorthand + " / --" + flag.Name
+	}
+}
+
+// readCloser bundles a (possibly decompressing) reader together with the things that need
+// closing when we are finished with it
+type readCloser struct {
+	io.Reader
+	closers []func() error
+	rewind  func() error // if not nil, this goes back to the start of the (decompressed) stream
+}
+
+// Seek implements io.Seeker, but only for going back to the start of a file (which is all gofasta needs),
+// so that files which are read twice can still be decompressed transparently
+func (r *readCloser) Seek(offset int64, whence int) (int64, error) {
+	if r.rewind == nil {
+		return 0, errors.New("can't seek in this input")
+	}
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errors.New("can only seek to the start of this input")
 	}
+	return 0, r.rewind()
+}
 
-	if inFile != "stdin" {
-		if f, err = os.Open(inFile); err != nil {
-			err = parseInErr(err, flagString)
-			return f, err
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c(); e != nil && err == nil {
+			err = e
 		}
-	} else {
-		f = os.Stdin
 	}
+	return err
+}
 
-	return f, nil
+// writeCloser bundles a (possibly compressing) writer together with the things that need
+// closing (in order) when we are finished with it
+type writeCloser struct {
+	io.Writer
+	closers []func() error
 }
 
-// OpenOut returns a pointer to a file object, which may be stdout, based on the argument provided
-// to a pflag flag on the command line. If the file is not stdout, it is created.
-func OpenOut(flag pflag.Flag) (*os.File, error) {
+func (w *writeCloser) Close() error {
 	var err error
-	var f *os.File
+	for _, c := range w.closers {
+		if e := c(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
 
-	outFile := flag.Value.String()
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+)
+
+// NewReader sniffs the first few bytes of r and, if they show that it is gzip (which includes bgzip),
+// zstd or xz compressed, returns a reader of the decompressed stream. Otherwise the returned reader
+// yields the contents of r unchanged. The returned ReadCloser does not close r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	return newReadCloser(r)
+}
+
+func newReadCloser(r io.Reader) (*readCloser, error) {
+
+	br := bufio.NewReader(r)
 
-	if outFile != "stdout" {
-		f, err = os.Create(outFile)
+	magic, err := br.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: gz, closers: []func() error{gz.Close}}, nil
+
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: zr, closers: []func() error{func() error { zr.Close(); return nil }}}, nil
+
+	case bytes.HasPrefix(magic, xzMagic):
+		xr, err := xz.NewReader(br)
 		if err != nil {
-			return f, err
+			return nil, err
 		}
-	} else {
-		f = os.Stdout
+		return &readCloser{Reader: xr}, nil
+
+	default:
+		return &readCloser{Reader: br}, nil
+	}
+}
+
+// compressionExts are the file extensions that NewWriter understands
+var compressionExts = []string{".gz", ".bgz", ".zst", ".xz"}
+
+// Ext is like filepath.Ext, but ignores any compression extension, so that e.g. the
+// Ext of "annotation.gb.gz" is ".gb"
+func Ext(path string) string {
+	ext := filepath.Ext(path)
+	for _, c := range compressionExts {
+		if strings.ToLower(ext) == c {
+			return filepath.Ext(strings.TrimSuffix(path, ext))
+		}
+	}
+	return ext
+}
+
+// AddToName inserts s into the name of a file before its extension (and any compression extension), so that
+// e.g. "aligned.fasta.gz" becomes "aligned.s.fasta.gz"
+func AddToName(path string, s string) string {
+	suffix := filepath.Ext(path)
+	isCompressed := false
+	for _, c := range compressionExts {
+		if strings.ToLower(suffix) == c {
+			isCompressed = true
+		}
+	}
+	if isCompressed {
+		suffix = Ext(path) + suffix
+	}
+	return strings.TrimSuffix(path, suffix) + "." + s + suffix
+}
+
+// NewWriter returns a writer that compresses its input to w according to the extension of filename:
+// ".gz" or ".bgz" for bgzip (which any gzip reader can read, and which can be indexed by samtools faidx),
+// ".zst" for zstd and ".xz" for xz. Any other extension means no compression. Closing the returned
+// WriteCloser flushes any compressed data but does not close w.
+func NewWriter(w io.Writer, filename string) (io.WriteCloser, error) {
+	return newWriteCloser(w, filename)
+}
+
+func newWriteCloser(w io.Writer, filename string) (*writeCloser, error) {
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gz", ".bgz":
+		bw := bgzf.NewWriter(w, runtime.GOMAXPROCS(0))
+		return &writeCloser{Writer: bw, closers: []func() error{bw.Close}}, nil
+
+	case ".zst":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &writeCloser{Writer: zw, closers: []func() error{zw.Close}}, nil
+
+	case ".xz":
+		xw, err := xz.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &writeCloser{Writer: xw, closers: []func() error{xw.Close}}, nil
+
+	default:
+		return &writeCloser{Writer: w}, nil
+	}
+}
+
+// openFile returns a pointer to a file object, which may be stdin, based on the argument provided
+// to a pflag flag on the command line.
+func openFile(flag pflag.Flag) (*os.File, error) {
+
+	inFile := flag.Value.String()
+
+	if inFile == "stdin" {
+		return os.Stdin, nil
+	}
+
+	f, err := os.Open(inFile)
+	if err != nil {
+		return f, parseInErr(err, flagString(flag))
 	}
 
 	return f, nil
 }
+
+// OpenIn returns a reader of a file, which may be stdin, based on the argument provided to a pflag flag
+// on the command line. If the file is gzip, bgzip, zstd or xz compressed (which is detected from its
+// contents, not its name), it is decompressed transparently. Closing the reader closes the file.
+func OpenIn(flag pflag.Flag) (io.ReadCloser, error) {
+
+	f, err := openFile(flag)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := newReadCloser(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.New("reading " + flagString(flag) + " " + flag.Value.String() + ": " + err.Error())
+	}
+	rc.closers = append(rc.closers, f.Close)
+
+	if f != os.Stdin {
+		rc.rewind = func() error {
+			_, err := f.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			for _, c := range rc.closers[:len(rc.closers)-1] {
+				c()
+			}
+			fresh, err := newReadCloser(f)
+			if err != nil {
+				return err
+			}
+			rc.Reader = fresh.Reader
+			rc.closers = append(fresh.closers, f.Close)
+			return nil
+		}
+	}
+
+	return rc, nil
+}
+
+// OpenInRaw is like OpenIn but never decompresses the file, for formats (like bam) which
+// deal with their own compression.
+func OpenInRaw(flag pflag.Flag) (io.ReadCloser, error) {
+	return openFile(flag)
+}
+
+// OpenOut returns a writer to a file, which may be stdout, based on the argument provided
+// to a pflag flag on the command line. If the file is not stdout, it is created, and if its name
+// ends in .gz, .bgz, .zst or .xz the output is compressed accordingly. The returned WriteCloser must
+// be closed to flush compressed output; closing it also closes the file.
+func OpenOut(flag pflag.Flag) (io.WriteCloser, error) {
+
+	outFile := flag.Value.String()
+
+	if outFile == "stdout" {
+		return os.Stdout, nil
+	}
+
+	return Create(outFile)
+}
+
+// Create creates a file to write to, compressing the output according to its name as OpenOut does. Closing
+// the returned WriteCloser also closes the file.
+func Create(path string) (io.WriteCloser, error) {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wc, err := newWriteCloser(f, path)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	wc.closers = append(wc.closers, f.Close)
+
+	return wc, nil
+}
@@ -1,7 +1,11 @@
 package gfio
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/cobra"
@@ -27,3 +31,140 @@ func TestOpenIn(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestOpenOutOpenInCompressed(t *testing.T) {
+
+	var (
+		Cmd = &cobra.Command{
+			Use:     "test",
+			Short:   "test",
+			Long:    `test`,
+			Version: "1.0",
+		}
+	)
+
+	var filename string
+	Cmd.PersistentFlags().StringVarP(&filename, "file", "f", "", "A file")
+
+	data := []byte(`>seq1
+ATGATGATGATG
+>seq2
+ATGATGATGATC
+`)
+
+	dir := t.TempDir()
+
+	for _, name := range []string{"test.fasta", "test.fasta.gz", "test.fasta.bgz", "test.fasta.zst", "test.fasta.xz"} {
+		Cmd.PersistentFlags().Set("file", filepath.Join(dir, name))
+
+		w, err := OpenOut(*Cmd.Flag("file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (name == "test.fasta") != bytes.Equal(raw, data) {
+			t.Errorf("problem in TestOpenOutOpenInCompressed: %s was compressed wrongly", name)
+		}
+
+		r, err := OpenIn(*Cmd.Flag("file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("problem in TestOpenOutOpenInCompressed: %s didn't round trip", name)
+		}
+	}
+}
+
+func TestExt(t *testing.T) {
+	for path, ext := range map[string]string{
+		"annotation.gb":     ".gb",
+		"annotation.gb.gz":  ".gb",
+		"annotation.gff.XZ": ".gff",
+		"alignment.fasta":   ".fasta",
+		"alignment":         "",
+	} {
+		if Ext(path) != ext {
+			t.Errorf("problem in TestExt: got %s for %s, expected %s", Ext(path), path, ext)
+		}
+	}
+}
+
+func TestAddToName(t *testing.T) {
+	for path, desiredResult := range map[string]string{
+		"aligned.fasta":        "aligned.PB2.fasta",
+		"aligned.fasta.gz":     "aligned.PB2.fasta.gz",
+		"out/aligned.fasta.XZ": "out/aligned.PB2.fasta.XZ",
+		"aligned":              "aligned.PB2",
+	} {
+		if AddToName(path, "PB2") != desiredResult {
+			t.Errorf("problem in TestAddToName: got %s for %s, expected %s", AddToName(path, "PB2"), path, desiredResult)
+		}
+	}
+}
+
+func TestOpenInRewind(t *testing.T) {
+
+	var (
+		Cmd = &cobra.Command{
+			Use:     "test",
+			Short:   "test",
+			Long:    `test`,
+			Version: "1.0",
+		}
+	)
+
+	var filename string
+	Cmd.PersistentFlags().StringVarP(&filename, "file", "f", "", "A file")
+
+	data := []byte(">seq1\nATGATGATGATG\n")
+	path := filepath.Join(t.TempDir(), "test.fasta.gz")
+	Cmd.PersistentFlags().Set("file", path)
+
+	w, err := OpenOut(*Cmd.Flag("file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+
+	r, err := OpenIn(*Cmd.Flag("file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 2; i++ {
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("problem in TestOpenInRewind (pass %d)", i)
+		}
+		_, err = r.(io.Seeker).Seek(0, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Package mask implements functions to mask sites in a fasta format alignment, for example
+problematic sites or primer binding regions, by replacing them with Ns or gaps.
+*/
+package mask
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// coordinates converts reference coordinates to alignment columns
+type coordinates struct {
+	refToMSA []int // the number of columns to add to each reference position, or nil if the alignment is in reference coordinates
+}
+
+// Columns converts a region in reference coordinates to the alignment columns it spans, including any insertions
+// relative to the reference within it. refToMSA is the number of columns to add to each reference position (see
+// variants.GetMSAOffsets), or nil if the alignment, which is width columns wide, is in reference coordinates. The
+// error if the region extends beyond the end of the reference doesn't name the region, so that callers can.
+func Columns(r Region, refToMSA []int, width int) (Region, error) {
+	refLen := width
+	if refToMSA != nil {
+		refLen = len(refToMSA)
+	}
+	if r.End > refLen {
+		return Region{}, errors.New("extends beyond the end of the reference (" + strconv.Itoa(refLen) + " bases)")
+	}
+	if refToMSA == nil {
+		return r, nil
+	}
+	return Region{Start: r.Start + refToMSA[r.Start], End: r.End + refToMSA[r.End-1]}, nil
+}
+
+// columns converts regions in reference coordinates to the alignment columns they span
+func (c coordinates) columns(regions []Region, width int) ([]Region, error) {
+	cols := make([]Region, len(regions))
+	for i, r := range regions {
+		col, err := Columns(r, c.refToMSA, width)
+		if err != nil {
+			return nil, errors.New("region to mask (" + strconv.Itoa(r.Start+1) + "-" + strconv.Itoa(r.End) + ") " + err.Error())
+		}
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+// maskRecord replaces the sites in a record which fall in cols, and in its own regions from table (if any), with char
+func maskRecord(FR fasta.Record, cols []Region, table map[string][]Region, coords coordinates, char byte) (fasta.Record, error) {
+	seq := []byte(FR.Seq)
+	for _, col := range cols {
+		for i := col.Start; i < col.End; i++ {
+			seq[i] = char
+		}
+	}
+	if regions, ok := table[FR.ID]; ok {
+		own, err := coords.columns(regions, len(seq))
+		if err != nil {
+			return fasta.Record{}, errors.New(FR.ID + ": " + err.Error())
+		}
+		for _, col := range own {
+			for i := col.Start; i < col.End; i++ {
+				seq[i] = char
+			}
+		}
+	}
+	FR.Seq = string(seq)
+	return FR, nil
+}
+
+// refOffsets returns the offset of each (1-based) reference position from its alignment column, given the
+// reference's aligned sequence, as variants.GetMSAOffsets does for encoded sequences
+func refOffsets(seq string) []int {
+	refToMSA := make([]int, 0, len(seq))
+	for i := range seq {
+		if seq[i] != '-' {
+			refToMSA = append(refToMSA, i-len(refToMSA))
+		}
+	}
+	return refToMSA
+}
+
+// Mask replaces the sites in regions with char (typically 'N' or '-') in every sequence in an alignment, and the
+// sites in table in the sequences they are listed for. Regions are in reference coordinates. If refID is "",
+// the alignment must be in reference coordinates, otherwise refID is the ID of the reference sequence in the
+// alignment, which is used to convert reference coordinates to alignment columns and is not itself masked. Records
+// that come before the reference in the alignment are held in memory until it is found.
+func Mask(msaIn io.Reader, refID string, regions []Region, table map[string][]Region, char byte, out io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	cErr := make(chan error)
+
+	cFR := make(chan fasta.Record, threads)
+	cReadDone := make(chan bool)
+
+	cMask := make(chan fasta.Record, threads)
+	cMasked := make(chan fasta.Record, threads)
+	cWriteDone := make(chan bool)
+	cWaitGroupDone := make(chan bool)
+
+	go fasta.StreamAlignment(msaIn, cFR, cErr, cReadDone)
+
+	held, ref, readDone, err := fasta.HoldToReference(cFR, cErr, cReadDone, refID, func(FR fasta.Record) string { return FR.ID })
+	if err != nil {
+		return err
+	}
+
+	var coords coordinates
+	if refID != "" {
+		coords.refToMSA = refOffsets(ref.Seq)
+	}
+
+	if len(held) == 0 {
+		return nil
+	}
+
+	cols, err := coords.columns(regions, len(held[0].Seq))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for _, FR := range held {
+			cMask <- FR
+		}
+		for FR := range cFR {
+			cMask <- FR
+		}
+		close(cMask)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			for FR := range cMask {
+				if FR.ID != refID || refID == "" {
+					var err error
+					FR, err = maskRecord(FR, cols, table, coords, char)
+					if err != nil {
+						cErr <- err
+						break
+					}
+				}
+				cMasked <- FR
+			}
+			wg.Done()
+		}()
+	}
+
+	go fasta.WriteAlignment(cMasked, out, cErr, cWriteDone)
+
+	go func() {
+		wg.Wait()
+		cWaitGroupDone <- true
+	}()
+
+	for n := 1; n > 0 && !readDone; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cFR)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWaitGroupDone:
+			close(cMasked)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
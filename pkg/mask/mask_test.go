@@ -0,0 +1,171 @@
+package mask
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	msaData := []byte(`>seq1
+ATGATGATGA
+>seq2
+ATGTTGATGA
+`)
+
+	regions, err := ParseRanges("1-2,6", ",")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	err = Mask(bytes.NewReader(msaData), "", regions, nil, 'N', out, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>seq1
+NNGATNATGA
+>seq2
+NNGTTNATGA
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestMask")
+		t.Error(out.String())
+	}
+
+	err = Mask(bytes.NewReader(msaData), "", []Region{{Start: 8, End: 11}}, nil, 'N', new(bytes.Buffer), 2)
+	if err == nil {
+		t.Errorf("expected an error for a region beyond the end of the alignment")
+	}
+}
+
+// regions are in reference coordinates, so they must be shifted past insertions relative to the reference
+// (and include any that are inside them), and the reference itself isn't masked
+func TestMaskReference(t *testing.T) {
+	msaData := []byte(`>seq1
+ATG--ATGATGA
+>ref
+ATG--ATGATGA
+>seq2
+ATGCCATGATGA
+`)
+
+	regions, err := ParseRanges("3-4|7", "|")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := map[string][]Region{"seq2": {{Start: 9, End: 10}}}
+
+	out := new(bytes.Buffer)
+	err = Mask(bytes.NewReader(msaData), "ref", regions, table, '-', out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>seq1
+AT----TG-TGA
+>ref
+ATG--ATGATGA
+>seq2
+AT----TG-TG-
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestMaskReference")
+		t.Error(out.String())
+	}
+
+	err = Mask(bytes.NewReader(msaData), "notthere", regions, nil, 'N', new(bytes.Buffer), 1)
+	if err == nil {
+		t.Errorf("expected an error for a missing reference")
+	}
+}
+
+// the reader can finish while the last records are still in the channel's buffer, which must not be mistaken for a
+// missing reference (or an empty alignment), so this is run more than once
+func TestMaskReferenceLast(t *testing.T) {
+	msaData := []byte(`>seq1
+ATGATGATGA
+>ref
+ATGATGATGA
+`)
+
+	regions, err := ParseRanges("1-2", ",")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		out := new(bytes.Buffer)
+		err = Mask(bytes.NewReader(msaData), "ref", regions, nil, 'N', out, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != ">seq1\nNNGATGATGA\n>ref\nATGATGATGA\n" {
+			t.Errorf("problem in TestMaskReferenceLast")
+			t.Fatal(out.String())
+		}
+
+		out = new(bytes.Buffer)
+		err = Mask(bytes.NewReader(msaData), "", regions, nil, 'N', out, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != ">seq1\nNNGATGATGA\n>ref\nNNGATGATGA\n" {
+			t.Errorf("problem in TestMaskReferenceLast (no reference)")
+			t.Fatal(out.String())
+		}
+	}
+}
+
+func TestReadRegions(t *testing.T) {
+	bed := []byte(`track name=primers
+MN908947.3	30	54	nCoV-2019_1_LEFT
+MN908947.3	385	410	nCoV-2019_1_RIGHT
+`)
+	regions, err := ReadBED(bytes.NewReader(bed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || regions[0] != (Region{Start: 30, End: 54}) || regions[1] != (Region{Start: 385, End: 410}) {
+		t.Errorf("problem in TestReadRegions (bed): %v", regions)
+	}
+
+	vcf := []byte(`##fileformat=VCFv4.2
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+MN908947.3	55	.	A	.	.	mask	EXC=ambiguous
+MN908947.3	11074	.	TT	.	.	caution	EXC=homoplasic
+`)
+	regions, err = ReadVCF(bytes.NewReader(vcf), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || regions[0] != (Region{Start: 54, End: 55}) || regions[1] != (Region{Start: 11073, End: 11075}) {
+		t.Errorf("problem in TestReadRegions (vcf): %v", regions)
+	}
+	regions, err = ReadVCF(bytes.NewReader(vcf), []string{"mask"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 1 || regions[0] != (Region{Start: 54, End: 55}) {
+		t.Errorf("problem in TestReadRegions (vcf with filters): %v", regions)
+	}
+
+	csv := []byte(`query,regions,other
+seq1,1-10|20,x
+seq2,,y
+seq1,30-31,z
+`)
+	table, err := ReadTable(bytes.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table["seq1"]) != 3 || table["seq1"][2] != (Region{Start: 29, End: 31}) || len(table["seq2"]) != 0 {
+		t.Errorf("problem in TestReadRegions (table): %v", table)
+	}
+
+	_, err = ParseRanges("10-5", ",")
+	if err == nil {
+		t.Errorf("expected an error for a backwards range")
+	}
+}
@@ -0,0 +1,182 @@
+package mask
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Region is a range of sites to mask, in 0-based, half-open reference coordinates (like BED)
+type Region struct {
+	Start int
+	End   int
+}
+
+// ReadBED reads the regions in a BED file. Only the first three columns are used, and header
+// (track, browser or #) lines are skipped. The chromosome name is ignored.
+func ReadBED(r io.Reader) ([]Region, error) {
+	regions := make([]Region, 0)
+	s := bufio.NewScanner(r)
+	counter := 0
+	for s.Scan() {
+		counter++
+		line := s.Text()
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("not enough columns on line %d of bed file", counter)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse start position on line %d of bed file", counter)
+		}
+		end, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse end position on line %d of bed file", counter)
+		}
+		if start < 0 || end <= start {
+			return nil, fmt.Errorf("bad region on line %d of bed file (%d-%d)", counter, start, end)
+		}
+		regions = append(regions, Region{Start: start, End: end})
+	}
+	err := s.Err()
+	if err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// ReadVCF reads the sites in a VCF file, such as the list of problematic sites in SARS-CoV-2. Each
+// record masks the reference allele (which is usually one base long). If filters is not empty, only
+// records whose FILTER column is one of filters are used (e.g. "mask" but not "caution").
+func ReadVCF(r io.Reader, filters []string) ([]Region, error) {
+	regions := make([]Region, 0)
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0), 1024*1024)
+	counter := 0
+	for s.Scan() {
+		counter++
+		line := s.Text()
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("not enough columns on line %d of vcf file", counter)
+		}
+		if len(filters) > 0 && (len(fields) < 7 || !contains(filters, fields[6])) {
+			continue
+		}
+		pos, err := strconv.Atoi(fields[1])
+		if err != nil || pos < 1 {
+			return nil, fmt.Errorf("couldn't parse position on line %d of vcf file", counter)
+		}
+		refLen := len(fields[3])
+		if refLen == 0 || fields[3] == "." {
+			refLen = 1
+		}
+		regions = append(regions, Region{Start: pos - 1, End: pos - 1 + refLen})
+	}
+	err := s.Err()
+	if err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// ParseRanges parses a list of 1-based, inclusive ranges or single positions, delimited by sep,
+// e.g. "1-55,29804-29903" or "21765-21770|28881"
+func ParseRanges(s string, sep string) ([]Region, error) {
+	regions := make([]Region, 0)
+	if len(strings.TrimSpace(s)) == 0 {
+		return regions, nil
+	}
+	for _, r := range strings.Split(s, sep) {
+		r = strings.TrimSpace(r)
+		bounds := strings.Split(r, "-")
+		if len(bounds) > 2 {
+			return nil, errors.New("couldn't parse range: " + r)
+		}
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, errors.New("couldn't parse range: " + r)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, errors.New("couldn't parse range: " + r)
+			}
+		}
+		if start < 1 || end < start {
+			return nil, errors.New("bad range: " + r)
+		}
+		regions = append(regions, Region{Start: start - 1, End: end})
+	}
+	return regions, nil
+}
+
+// ReadTable reads a csv file of sample-specific regions to mask. It must have a header with (at least)
+// the columns "query" and "regions", and the regions are a "|"-delimited list of 1-based, inclusive
+// ranges, e.g. "1-200|21765-21770". A query can be on more than one line.
+func ReadTable(r io.Reader) (map[string][]Region, error) {
+	table := make(map[string][]Region)
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return table, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	queryCol, regionsCol := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "query":
+			queryCol = i
+		case "regions":
+			regionsCol = i
+		}
+	}
+	if queryCol == -1 || regionsCol == -1 {
+		return nil, errors.New("the regions table must have a header with the columns \"query\" and \"regions\"")
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) <= queryCol || len(record) <= regionsCol {
+			return nil, errors.New("not enough columns in regions table")
+		}
+		regions, err := ParseRanges(record[regionsCol], "|")
+		if err != nil {
+			return nil, err
+		}
+		table[record[queryCol]] = append(table[record[queryCol]], regions...)
+	}
+
+	return table, nil
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package sam
+
+import (
+	"errors"
+	"io"
+	"runtime"
+)
+
+// iupacCodes maps a set of bases, as a bit mask with A=1, C=2, G=4 and T=8, to its IUPAC code
+var iupacCodes = [16]byte{'N', 'A', 'C', 'M', 'G', 'R', 'S', 'V', 'T', 'W', 'Y', 'H', 'K', 'D', 'B', 'N'}
+
+// call returns the consensus character for one position of a pileup. Positions with fewer than minDepth reads
+// are N. Otherwise every allele with a frequency of at least minFreq is in the call: one base is called as
+// itself, and more than one as its IUPAC code. A deletion is called (as a gap) if it passes minFreq and is at
+// least as common as every base.
+func (c pileupColumn) call(minDepth int, minFreq float64) byte {
+	d := c.depth()
+	if d == 0 || d < minDepth {
+		return 'N'
+	}
+
+	if float64(c[alleleDel])/float64(d) >= minFreq {
+		commonest := true
+		for a := alleleA; a <= alleleT; a++ {
+			if c[a] > c[alleleDel] {
+				commonest = false
+			}
+		}
+		if commonest {
+			return '-'
+		}
+	}
+
+	var mask int
+	for a := alleleA; a <= alleleT; a++ {
+		if c[a] > 0 && float64(c[a])/float64(d) >= minFreq {
+			mask |= 1 << a
+		}
+	}
+	return iupacCodes[mask]
+}
+
+// Consensus calls a consensus sequence from reads aligned to a reference in a sam (or bam) file, and writes it in
+// fasta format, called name, in reference coordinates (so it is the same length as the reference and insertions
+// are left out). Reads that are unmapped, secondary, duplicates, fail QC, or have a mapping quality below minMapQ
+// are ignored, as are bases with a base quality below minBaseQual. Each position is called as described for
+// pileupColumn.call, with sites covered by fewer than minDepth reads (counting deletions) called as N.
+func Consensus(samIn io.Reader, name string, minDepth int, minBaseQual int, minMapQ int, minFreq float64, out io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	if minFreq <= 0 || minFreq > 1 {
+		return errors.New("the minimum allele frequency must be greater than 0 and at most 1")
+	}
+
+	p, _, err := readPileup(samIn, pileupOptions{minMapQ: minMapQ, minBaseQual: minBaseQual}, threads)
+	if err != nil {
+		return err
+	}
+
+	seq := make([]byte, len(p.cols))
+	for i, c := range p.cols {
+		seq[i] = c.call(minDepth, minFreq)
+	}
+
+	_, err = out.Write([]byte(">" + name + "\n" + string(seq) + "\n"))
+
+	return err
+}
@@ -0,0 +1,53 @@
+package sam
+
+import (
+	"bytes"
+	"testing"
+)
+
+// reads against a 10 base reference. A base quality of ! is 0 and of I is 40
+var consensusSamData = []byte(`@SQ	SN:ref	LN:10
+r1	0	ref	1	60	10M	*	0	0	ACGTACGTAC	IIIIIIIIII
+r2	0	ref	1	60	10M	*	0	0	ACGTTCGTAC	IIIIIIIIII
+r3	16	ref	1	60	4M2D4M	*	0	0	ACGTGTAC	IIIIIIII
+r4	0	ref	1	60	10M	*	0	0	ACGTTCGTAA	IIIIIIIII!
+r5	0	ref	3	5	6M	*	0	0	GTTCGT	IIIIII
+r6	0	ref	1	10	4M2D4M	*	0	0	ACGTGTAC	IIIIIIII
+r7	256	ref	1	0	10M	*	0	0	TTTTTTTTTT	IIIIIIIIII
+r8	1024	ref	1	60	10M	*	0	0	TTTTTTTTTT	IIIIIIIIII
+r9	4	*	0	0	*	*	0	0	TTTT	*
+`)
+
+func TestConsensus(t *testing.T) {
+	tests := []struct {
+		minDepth      int
+		minBaseQual   int
+		minMapQ       int
+		minFreq       float64
+		desiredResult string
+	}{
+		{minDepth: 1, minBaseQual: 20, minMapQ: 20, minFreq: 0.25, desiredResult: ">sample\nACGTWCGTAC\n"},
+		{minDepth: 1, minBaseQual: 20, minMapQ: 20, minFreq: 0.5, desiredResult: ">sample\nACGTTCGTAC\n"},
+		{minDepth: 4, minBaseQual: 20, minMapQ: 20, minFreq: 0.25, desiredResult: ">sample\nACGTWCGTAN\n"},
+		{minDepth: 1, minBaseQual: 0, minMapQ: 20, minFreq: 0.25, desiredResult: ">sample\nACGTWCGTAM\n"},
+		{minDepth: 1, minBaseQual: 20, minMapQ: 10, minFreq: 0.25, desiredResult: ">sample\nACGT-CGTAC\n"},
+		{minDepth: 1, minBaseQual: 20, minMapQ: 0, minFreq: 0.25, desiredResult: ">sample\nACGTTCGTAC\n"},
+	}
+
+	for i, test := range tests {
+		out := new(bytes.Buffer)
+		err := Consensus(bytes.NewReader(consensusSamData), "sample", test.minDepth, test.minBaseQual, test.minMapQ, test.minFreq, out, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.desiredResult {
+			t.Errorf("problem in TestConsensus (test %d)", i)
+			t.Error(out.String())
+		}
+	}
+
+	err := Consensus(bytes.NewReader(consensusSamData), "sample", 1, 20, 20, 0, new(bytes.Buffer), 1)
+	if err == nil {
+		t.Error("expected an error for a minimum frequency of 0 in TestConsensus")
+	}
+}
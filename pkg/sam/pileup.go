@@ -0,0 +1,228 @@
+package sam
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	biogosam "github.com/biogo/hts/sam"
+)
+
+// the alleles that are counted at each position of a pileup
+const (
+	alleleA = iota
+	alleleC
+	alleleG
+	alleleT
+	alleleDel
+	nAlleles
+)
+
+var alleleChars = [nAlleles]byte{'A', 'C', 'G', 'T', '-'}
+
+var baseToAllele = func() [256]int {
+	var a [256]int
+	for i := range a {
+		a[i] = -1
+	}
+	a['A'], a['C'], a['G'], a['T'] = alleleA, alleleC, alleleG, alleleT
+	a['a'], a['c'], a['g'], a['t'] = alleleA, alleleC, alleleG, alleleT
+	return a
+}()
+
+// pileupColumn is the number of reads with each allele at one reference position
+type pileupColumn [nAlleles]int
+
+// depth is the number of reads with a base or a deletion at this position
+func (c pileupColumn) depth() int {
+	d := 0
+	for _, n := range c {
+		d += n
+	}
+	return d
+}
+
+// indel is an insertion or a deletion in a read. pos is the 0-based position of the first deleted reference base,
+// or of the reference base immediately before the insertion (-1 if the insertion is before the reference)
+type indel struct {
+	insertion bool
+	pos       int
+	length    int
+	seq       string // the inserted bases
+}
+
+// pileup is the allele counts at every position of one reference, and the number of reads with each indel
+type pileup struct {
+	cols   []pileupColumn
+	indels map[indel]int
+}
+
+func newPileup(refLen int) pileup {
+	return pileup{cols: make([]pileupColumn, refLen), indels: make(map[indel]int)}
+}
+
+// pileupOptions are the filters for which reads and bases are counted in a pileup
+type pileupOptions struct {
+	minMapQ     int
+	minBaseQual int
+}
+
+// keep is true if a read should be counted: it must be mapped, not secondary, not a duplicate or QC failure, and
+// have a high enough mapping quality. Supplementary records are counted, since they cover different sites.
+func (o pileupOptions) keep(rec *biogosam.Record) bool {
+	if rec.Flags&(biogosam.Unmapped|biogosam.Secondary|biogosam.QCFail|biogosam.Duplicate) != 0 {
+		return false
+	}
+	return int(rec.MapQ) >= o.minMapQ
+}
+
+// add counts the bases (with a high enough base quality), deletions and insertions in one read. An insertion is only
+// counted if all its bases have a high enough base quality
+func (p pileup) add(rec *biogosam.Record, o pileupOptions) {
+	seq := rec.Seq.Expand()
+	qual := rec.Qual
+	// 0xff means that there are no base qualities
+	lowQual := func(i int) bool {
+		return len(qual) > i && qual[i] != 0xff && int(qual[i]) < o.minBaseQual
+	}
+	qi, ri := 0, rec.Pos
+	for _, op := range rec.Cigar {
+		n := op.Len()
+		switch op.Type() {
+		case biogosam.CigarMatch, biogosam.CigarEqual, biogosam.CigarMismatch:
+			for x := 0; x < n; x++ {
+				r := ri + x
+				if r < 0 || r >= len(p.cols) || lowQual(qi+x) {
+					continue
+				}
+				if a := baseToAllele[seq[qi+x]]; a >= 0 {
+					p.cols[r][a]++
+				}
+			}
+			qi += n
+			ri += n
+		case biogosam.CigarInsertion:
+			keep := ri >= 0 && ri <= len(p.cols)
+			for x := 0; x < n && keep; x++ {
+				keep = !lowQual(qi + x)
+			}
+			if keep {
+				p.indels[indel{insertion: true, pos: ri - 1, length: n, seq: string(bytes.ToUpper(seq[qi : qi+n]))}]++
+			}
+			qi += n
+		case biogosam.CigarSoftClipped:
+			qi += n
+		case biogosam.CigarDeletion:
+			for r := ri; r < ri+n && r < len(p.cols); r++ {
+				if r >= 0 {
+					p.cols[r][alleleDel]++
+				}
+			}
+			if ri >= 0 && ri+n <= len(p.cols) {
+				p.indels[indel{pos: ri, length: n}]++
+			}
+			ri += n
+		case biogosam.CigarSkipped:
+			ri += n
+		}
+	}
+}
+
+// merge adds the counts in o to p
+func (p pileup) merge(o pileup) {
+	for i := range p.cols {
+		for a := range p.cols[i] {
+			p.cols[i][a] += o.cols[i][a]
+		}
+	}
+	for k, n := range o.indels {
+		p.indels[k] += n
+	}
+}
+
+// readPileup builds a pileup of all the reads in a sam (or bam) file against the first reference in its header,
+// in parallel over threads
+func readPileup(samIn io.Reader, o pileupOptions, threads int) (pileup, biogosam.Header, error) {
+
+	s, err := newRecordReader(samIn)
+	if err != nil {
+		return pileup{}, biogosam.Header{}, err
+	}
+	header := *s.Header()
+	if len(header.Refs()) == 0 {
+		return pileup{}, header, errors.New("no reference sequence in sam header")
+	}
+	refLen := header.Refs()[0].Len()
+	refName := header.Refs()[0].Name()
+
+	cRec := make(chan *biogosam.Record, threads*64)
+	cErr := make(chan error)
+	cReadDone := make(chan bool)
+	cWaitGroupDone := make(chan bool)
+
+	go func() {
+		for {
+			rec, err := s.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				cErr <- err
+				return
+			}
+			if !o.keep(rec) {
+				continue
+			}
+			if rec.Ref == nil || rec.Ref.Name() != refName {
+				cErr <- errors.New("read " + rec.Name + " is mapped to a reference other than " + refName + ": only one reference is supported")
+				return
+			}
+			cRec <- rec
+		}
+		cReadDone <- true
+	}()
+
+	pileups := make([]pileup, threads)
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		pileups[n] = newPileup(refLen)
+		go func(p pileup) {
+			for rec := range cRec {
+				p.add(rec, o)
+			}
+			wg.Done()
+		}(pileups[n])
+	}
+
+	go func() {
+		wg.Wait()
+		cWaitGroupDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return pileup{}, header, err
+		case <-cReadDone:
+			close(cRec)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return pileup{}, header, err
+		case <-cWaitGroupDone:
+			n--
+		}
+	}
+
+	for _, p := range pileups[1:] {
+		pileups[0].merge(p)
+	}
+
+	return pileups[0], header, nil
+}
@@ -0,0 +1,81 @@
+package sam
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/biogo/hts/bam"
+	biogosam "github.com/biogo/hts/sam"
+
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+)
+
+// recordReader is satisfied by both biogo's sam.Reader and bam.Reader, so that the functions
+// that read alignments don't need to know which format they came in
+type recordReader interface {
+	Header() *biogosam.Header
+	Read() (*biogosam.Record, error)
+}
+
+var (
+	bamMagic  = []byte("BAM\x01")
+	cramMagic = []byte("CRAM")
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// newRecordReader sniffs the first few bytes of in to decide whether it is BAM, CRAM or SAM (which
+// may be gzip, zstd or xz compressed), and returns a reader of the appropriate type
+func newRecordReader(in io.Reader) (recordReader, error) {
+
+	// bgzf blocks are at most 64 KiB, so this is big enough to hold the whole of the first block
+	br := bufio.NewReaderSize(in, 1<<16)
+
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, cramMagic):
+		return nil, errors.New("CRAM input is not supported, please convert it to BAM first (e.g. samtools view -b -T reference.fasta in.cram > in.bam)")
+
+	case bytes.HasPrefix(magic, gzipMagic):
+		isBAM, err := peekBAM(br)
+		if err != nil {
+			return nil, err
+		}
+		if isBAM {
+			// one read goroutine: decompression is not the bottleneck for anything we do downstream,
+			// and it means the reader doesn't need to be closed to release its workers
+			return bam.NewReader(br, 1)
+		}
+	}
+
+	// anything else is sam, possibly compressed
+	r, err := gfio.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return biogosam.NewReader(r)
+}
+
+// peekBAM decompresses the start of the buffered gzip stream (without consuming it) and
+// reports whether it begins with the BAM magic number
+func peekBAM(br *bufio.Reader) (bool, error) {
+	buf, err := br.Peek(br.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return false, err
+	}
+	magic := make([]byte, len(bamMagic))
+	if _, err := io.ReadFull(gz, magic); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(magic, bamMagic), nil
+}
@@ -0,0 +1,80 @@
+package sam
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/biogo/hts/bam"
+	biogosam "github.com/biogo/hts/sam"
+)
+
+var readerSamData = []byte(`@SQ	SN:ref	LN:20
+q1	0	ref	3	60	2S8M	*	0	0	NNATGCATGC	*
+q2	0	ref	1	60	6M2D6M	*	0	0	ATATGCTGCATG	*
+q3	4	*	0	0	*	*	0	0	ATATGC	*
+`)
+
+// samToBam converts some sam-format data to bam-format data using biogo
+func samToBam(t *testing.T, samData []byte) []byte {
+	s, err := biogosam.NewReader(bytes.NewReader(samData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bamOut := new(bytes.Buffer)
+	w, err := bam.NewWriter(bamOut, s.Header(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		rec, err := s.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Write(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bamOut.Bytes()
+}
+
+func TestToMultiAlignBAM(t *testing.T) {
+	desiredResult := `>q1
+--ATGCATGC----------
+>q2
+ATATGC--TGCATG------
+`
+
+	bamData := samToBam(t, readerSamData)
+
+	gzipped := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzipped)
+	gz.Write(readerSamData)
+	gz.Close()
+
+	for name, in := range map[string][]byte{"sam": readerSamData, "bam": bamData, "gzipped sam": gzipped.Bytes()} {
+		out := new(bytes.Buffer)
+		err := ToMultiAlign(bytes.NewReader(in), out, -1, -1, -1, false, false, 1)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if out.String() != desiredResult {
+			t.Errorf("problem in TestToMultiAlignBAM (%s input)", name)
+		}
+	}
+}
+
+func TestNewRecordReaderCRAM(t *testing.T) {
+	_, err := newRecordReader(bytes.NewReader([]byte("CRAM\x03\x00")))
+	if err == nil {
+		t.Errorf("expected an error reading CRAM input")
+	}
+}
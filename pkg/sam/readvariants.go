@@ -0,0 +1,142 @@
+package sam
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+// ReadVariants reports the alleles that differ from the reference in a set of reads aligned to it in sam (or bam)
+// format, with their frequencies, for studying within-host diversity. Each nucleotide change is annotated on its own
+// (as an amino acid change if it is non-synonymous in a protein-coding region of the annotation, otherwise as a
+// nucleotide change), because reads aren't phased. Insertions and deletions are counted as whole events in each
+// read. Reads and bases are filtered as in Consensus, and only alleles at sites covered by at least minDepth reads
+// (counting deletions), with a frequency of at least minFreq, are reported. The output is written in csv or vcf format,
+// as given by o (which can't aggregate). In vcf format the contig is named as the reference is in the sam header.
+func ReadVariants(samIn, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSuffix string, out io.Writer, minDepth int, minBaseQual int, minMapQ int, minFreq float64, o variants.Options, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	switch o.Format {
+	case "":
+		o.Format = "csv"
+	case "csv", "vcf":
+	default:
+		return errors.New("couldn't tell which output format to write (choose one of \"csv\" or \"vcf\")")
+	}
+	if o.Aggregate {
+		return errors.New("can't aggregate the mutations in reads")
+	}
+
+	p, header, err := readPileup(samIn, pileupOptions{minMapQ: minMapQ, minBaseQual: minBaseQual}, threads)
+	if err != nil {
+		return err
+	}
+
+	refName := header.Refs()[0].Name()
+
+	annos, err := loadAnnotations([]string{refName}, refIn, refFromFile, annoIn, annoSuffix)
+	if err != nil {
+		return err
+	}
+	ref, cdsregions, features := annos[0].ref, annos[0].cdsregions, annos[0].features
+	refSeq := strings.ToUpper(ref.Decode().Degap().Seq)
+	if len(p.cols) != len(refSeq) {
+		return errors.New("the reference in the sam header (" + strconv.Itoa(len(p.cols)) + " bases) is a different length to --reference (" + strconv.Itoa(len(refSeq)) + " bases)")
+	}
+
+	afs, err := alleleFrequencies(p, refSeq, cdsregions, features, minDepth, minFreq)
+	if err != nil {
+		return err
+	}
+
+	if o.Start > 0 && o.End > 0 {
+		temp := make([]variants.AlleleFrequency, 0, len(afs))
+		for _, a := range afs {
+			if a.V.Position < o.Start || a.V.Position > o.End {
+				continue
+			}
+			temp = append(temp, a)
+		}
+		afs = temp
+	}
+
+	switch o.Format {
+	case "csv":
+		err = variants.WriteAlleleFrequencies(out, afs, o)
+	case "vcf":
+		err = variants.WriteAlleleFrequencyVCF(out, refName, refSeq, afs)
+	}
+
+	return err
+}
+
+// alleleFrequencies returns the annotated non-reference alleles in a pileup that pass minDepth and minFreq, in order
+// of their position
+func alleleFrequencies(p pileup, refSeq string, cdsregions []variants.Region, features []variants.Region, minDepth int, minFreq float64) ([]variants.AlleleFrequency, error) {
+
+	passes := func(count, depth int) bool {
+		return count > 0 && depth > 0 && depth >= minDepth && float64(count)/float64(depth) >= minFreq
+	}
+
+	afs := make([]variants.AlleleFrequency, 0)
+
+	for i, c := range p.cols {
+		depth := c.depth()
+		for a := alleleA; a <= alleleT; a++ {
+			if alleleChars[a] == refSeq[i] || !passes(c[a], depth) {
+				continue
+			}
+			vs, err := variants.AnnotateSNV(refSeq, i+1, alleleChars[a], cdsregions)
+			if err != nil {
+				return nil, err
+			}
+			variants.NameFeatures(vs, features)
+			for _, v := range vs {
+				afs = append(afs, variants.AlleleFrequency{V: v, Depth: depth, Count: c[a]})
+			}
+		}
+	}
+
+	for id, count := range p.indels {
+		// the depth of an insertion is the depth at the base before it
+		site := id.pos
+		if site < 0 {
+			site = 0
+		}
+		if site >= len(p.cols) {
+			site = len(p.cols) - 1
+		}
+		depth := p.cols[site].depth()
+		if !passes(count, depth) {
+			continue
+		}
+		var v variants.Variant
+		if id.insertion {
+			v = variants.Variant{Changetype: "ins", Position: id.pos + 1, Length: id.length, QueAl: id.seq}
+		} else {
+			v = variants.Variant{Changetype: "del", Position: id.pos + 1, Length: id.length}
+		}
+		v.Consequence = variants.IndelConsequence(v, cdsregions)
+		vs := []variants.Variant{v}
+		variants.NameFeatures(vs, features)
+		v = vs[0]
+		afs = append(afs, variants.AlleleFrequency{V: v, Depth: depth, Count: count})
+	}
+
+	sort.SliceStable(afs, func(i, j int) bool {
+		vi, vj := afs[i].V, afs[j].V
+		return vi.Position < vj.Position || (vi.Position == vj.Position && vi.Changetype < vj.Changetype) || (vi.Position == vj.Position && vi.Changetype == vj.Changetype && vi.QueAl < vj.QueAl) || (vi.Position == vj.Position && vi.Changetype == vj.Changetype && vi.QueAl == vj.QueAl && vi.Length < vj.Length)
+	})
+
+	return afs, nil
+}
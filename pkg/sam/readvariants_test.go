@@ -0,0 +1,125 @@
+package sam
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+var readVariantsRefData = []byte(`>ref
+CCATGAAACCCGGGTAAC
+`)
+
+var readVariantsGFFData = []byte(`##gff-version 3
+ref	.	CDS	3	17	.	+	0	ID=cds-x;Name=x
+`)
+
+var readVariantsSamData = []byte(`@SQ	SN:ref	LN:18
+r1	0	ref	1	60	18M	*	0	0	CCATGAAACCCGGGTAAC	*
+r2	0	ref	1	60	18M	*	0	0	CCATGAAACCCGGGTAAC	*
+r3	16	ref	1	60	18M	*	0	0	CCATGAAACCCGGGTAAC	*
+r4	0	ref	1	60	18M	*	0	0	CCATGAAACCCGGGTAAC	*
+r5	0	ref	1	60	18M	*	0	0	CCATGAAACCCGGGTAAC	*
+r6	0	ref	1	60	18M	*	0	0	CCATGGAACCCGGGTAAC	*
+r7	16	ref	1	60	18M	*	0	0	CCATGGAACCCGGGTAAC	*
+r8	0	ref	1	60	18M	*	0	0	CCATGAAGCCCGGGTAAT	*
+r9	0	ref	1	60	9M2D7M	*	0	0	CCATGAAACGGGTAAC	*
+r10	0	ref	1	60	12M2I6M	*	0	0	CCATGAAACCCGTTGGTAAC	*
+r11	256	ref	1	0	18M	*	0	0	TTTTTTTTTTTTTTTTTT	*
+`)
+
+func TestReadVariants(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := ReadVariants(bytes.NewReader(readVariantsSamData), bytes.NewReader(readVariantsRefData), true, bytes.NewReader(readVariantsGFFData), "gff", out, 1, 20, 0, 0.05, variants.Options{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `mutation,depth,count,frequency
+aa:x:K2E,10,2,0.200000000
+nuc:A8G,10,1,0.100000000
+del:10:2,10,1,0.100000000
+ins:12:2,10,1,0.100000000
+nuc:C18T,10,1,0.100000000
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestReadVariants")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = ReadVariants(bytes.NewReader(readVariantsSamData), bytes.NewReader(readVariantsRefData), true, bytes.NewReader(readVariantsGFFData), "gff", out, 1, 20, 0, 0.15, variants.Options{AppendCodons: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `mutation,depth,count,frequency
+aa:x:K2E(ref:AAA-alt:GAA),10,2,0.200000000
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestReadVariants (min freq)")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = ReadVariants(bytes.NewReader(readVariantsSamData), bytes.NewReader(readVariantsRefData), true, bytes.NewReader(readVariantsGFFData), "gff", out, 11, 20, 0, 0.05, variants.Options{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "mutation,depth,count,frequency\n" {
+		t.Errorf("problem in TestReadVariants (min depth)")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = ReadVariants(bytes.NewReader(readVariantsSamData), bytes.NewReader(readVariantsRefData), true, bytes.NewReader(readVariantsGFFData), "gff", out, 1, 20, 0, 0.05, variants.Options{AppendConsequence: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `mutation,depth,count,frequency
+aa:x:K2E(missense_variant),10,2,0.200000000
+nuc:A8G(synonymous_variant),10,1,0.100000000
+del:10:2(frameshift_variant),10,1,0.100000000
+ins:12:2(frameshift_variant),10,1,0.100000000
+nuc:C18T(3_prime_UTR_variant),10,1,0.100000000
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestReadVariants (consequence)")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = ReadVariants(bytes.NewReader(readVariantsSamData), bytes.NewReader(readVariantsRefData), true, bytes.NewReader(readVariantsGFFData), "gff", out, 1, 20, 0, 0.05, variants.Options{Format: "vcf"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `##fileformat=VCFv4.3
+##source=gofasta
+##contig=<ID=ref,length=18>
+##INFO=<ID=TYPE,Number=A,Type=String,Description="Type of each alternate allele (snp, ins or del)">
+##INFO=<ID=AA,Number=A,Type=String,Description="Amino acid change(s) caused by each alternate allele, \"|\"-delimited, or . if none">
+##INFO=<ID=DP,Number=1,Type=Integer,Description="Number of reads covering the site">
+##INFO=<ID=AC,Number=A,Type=Integer,Description="Number of reads carrying each alternate allele">
+##INFO=<ID=AF,Number=A,Type=Float,Description="Frequency of each alternate allele in the reads">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+ref	6	.	A	G	.	.	TYPE=snp;AA=x:K2E;DP=10;AC=2;AF=0.200000000
+ref	8	.	A	G	.	.	TYPE=snp;DP=10;AC=1;AF=0.100000000
+ref	9	.	CCC	C	.	.	TYPE=del;DP=10;AC=1;AF=0.100000000
+ref	12	.	G	GTT	.	.	TYPE=ins;DP=10;AC=1;AF=0.100000000
+ref	18	.	C	T	.	.	TYPE=snp;DP=10;AC=1;AF=0.100000000
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestReadVariants (vcf)")
+		t.Error(out.String())
+	}
+
+	// the contig is named as in the sam header, whatever the reference record is called
+	out = new(bytes.Buffer)
+	err = ReadVariants(bytes.NewReader(readVariantsSamData), bytes.NewReader(bytes.Replace(readVariantsRefData, []byte(">ref"), []byte(">other"), 1)), true, bytes.NewReader(readVariantsGFFData), "gff", out, 1, 20, 0, 0.05, variants.Options{Format: "vcf"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestReadVariants (vcf, reference named differently)")
+		t.Error(out.String())
+	}
+}
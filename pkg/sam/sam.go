@@ -336,9 +336,10 @@ func groupSamRecords(sam io.Reader, cHeader chan biogosam.Header, chnl chan samR
 
 	var err error
 
-	s, err := biogosam.NewReader(sam)
+	s, err := newRecordReader(sam)
 	if err != nil {
 		cerr <- err
+		return
 	}
 
 	cHeader <- *s.Header()
@@ -0,0 +1,171 @@
+package sam
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	biogosam "github.com/biogo/hts/sam"
+	"github.com/virus-evolution/gofasta/pkg/encoding"
+	"github.com/virus-evolution/gofasta/pkg/search"
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+// Search finds the queries in pairwise alignments in sam format that match a search expression of mutations
+// relative to the reference sequence (see search.ParseQuery), and writes them with the status of each mutation.
+// Genome annotations are derived from an annotation file in genbank or gff version 3 format. If all is true, every
+// query is written, whether or not it matches. Parts of the reference that a query's records don't cover count as
+// missing data. There must be only one reference sequence in the sam header
+func Search(samIn, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSuffix string, expr string, out io.Writer, all bool, threads int) error {
+
+	cErr := make(chan error)
+
+	cSR := make(chan samRecords, threads)
+	cSH := make(chan biogosam.Header)
+
+	cReadDone := make(chan bool)
+
+	go groupSamRecords(samIn, cSH, cSR, cReadDone, cErr)
+
+	var header biogosam.Header
+	select {
+	case header = <-cSH:
+	case err := <-cErr:
+		return err
+	}
+
+	names, err := refNames(header)
+	if err != nil {
+		return err
+	}
+	if len(names) > 1 {
+		return errors.New("can't search a sam file with more than one reference sequence in its header")
+	}
+
+	annos, err := loadAnnotations(names, refIn, refFromFile, annoIn, annoSuffix)
+	if err != nil {
+		return err
+	}
+	anno := annos[0]
+
+	q, err := search.ParseQuery(expr, anno.cdsregions, len(anno.ref.Decode().Degap().Seq))
+	if err != nil {
+		return err
+	}
+
+	cPairAlign := make(chan alignPair)
+	cResults := make(chan search.Result)
+
+	cAlignWaitGroupDone := make(chan bool)
+	cResultsDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go search.WriteResults(out, q, all, false, anno.ref.ID, cResults, cWriteDone, cErr)
+
+	var wgAlign sync.WaitGroup
+	wgAlign.Add(threads)
+
+	var wgSearch sync.WaitGroup
+	wgSearch.Add(threads)
+
+	refSeq := []byte(anno.ref.Decode().Seq)
+
+	for n := 0; n < threads; n++ {
+		go func() {
+			blockToPairwiseAlignment(cSR, cPairAlign, cErr, refSeq, false)
+			wgAlign.Done()
+		}()
+	}
+
+	for n := 0; n < threads; n++ {
+		go func() {
+			searchSam(q, anno.cdsregions, anno.intregions, cPairAlign, cResults, cErr)
+			wgSearch.Done()
+		}()
+	}
+
+	go func() {
+		wgAlign.Wait()
+		cAlignWaitGroupDone <- true
+	}()
+
+	go func() {
+		wgSearch.Wait()
+		cResultsDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cSR)
+			close(cSH)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cAlignWaitGroupDone:
+			close(cPairAlign)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cResultsDone:
+			close(cResults)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
+
+// searchSam evaluates q for each pairwise alignment from a channel, until it is closed
+func searchSam(q search.Query, cdsregions []variants.Region, intregions []int, cAlignPair chan alignPair, cResults chan search.Result, cErr chan error) {
+
+	EA := encoding.MakeEncodingArray()
+
+	for pair := range cAlignPair {
+
+		for i, nuc := range pair.query {
+			pair.query[i] = EA[nuc]
+		}
+
+		for i, nuc := range pair.ref {
+			pair.ref[i] = EA[nuc]
+		}
+
+		offsetRefCoord, offsetMSACoord := variants.GetMSAOffsets(pair.ref)
+
+		AS, err := variants.GetVariantsPair(pair.ref, pair.query, pair.refname, pair.queryname, pair.idx, cdsregions, intregions, offsetRefCoord, offsetMSACoord)
+		if err != nil {
+			cErr <- err
+			break
+		}
+
+		r, err := q.Evaluate(AS)
+		if err != nil {
+			cErr <- err
+			break
+		}
+
+		cResults <- r
+	}
+}
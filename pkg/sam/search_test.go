@@ -0,0 +1,55 @@
+package sam
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	samData := []byte(`@SQ	SN:ref	LN:9
+q1	0	ref	1	60	9M	*	0	0	ATGAAGTAA	*
+q2	0	ref	1	60	9M	*	0	0	ATGGAATAA	*
+q3	0	ref	1	60	3M	*	0	0	ATG	*
+`)
+	refData := []byte(`>ref
+ATGAAATAA
+`)
+	gffData := []byte(`##gff-version 3
+ref	.	CDS	1	9	.	+	0	ID=cds-a;Name=a
+`)
+
+	out := new(bytes.Buffer)
+	err := Search(bytes.NewReader(samData), bytes.NewReader(refData), true, bytes.NewReader(gffData), "gff", "aa:a:K2E | nuc:A6G", out, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `query,match,aa:a:K2E,nuc:A6G
+q1,true,absent,present
+q2,true,present,absent
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSearch")
+		t.Error(out.String())
+	}
+
+	// the parts of the reference that q3 doesn't cover are missing data
+	out = new(bytes.Buffer)
+	err = Search(bytes.NewReader(samData), bytes.NewReader(refData), true, bytes.NewReader(gffData), "gff", "aa:a:K2E | nuc:A6G", out, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `query,match,aa:a:K2E,nuc:A6G
+q1,true,absent,present
+q2,true,present,absent
+q3,unknown,unknown,unknown
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSearch (--all)")
+		t.Error(out.String())
+	}
+
+	err = Search(bytes.NewReader(segmentsSamData), bytes.NewReader(segmentsRefData), true, bytes.NewReader(segmentsGFFData), "gff", "aa:a:K2E", new(bytes.Buffer), false, 1)
+	if err == nil {
+		t.Errorf("expected an error for more than one reference sequence in TestSearch")
+	}
+}
@@ -0,0 +1,148 @@
+package sam
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	biogosam "github.com/biogo/hts/sam"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// SegmentOutputs returns where to write the output for each of the reference sequences (e.g. the segments of a
+// segmented genome, or a chromosome and its plasmids) in a sam file's header, given their names in header order
+type SegmentOutputs func(refNames []string) ([]io.Writer, error)
+
+// loadReferences reads and encodes every record in a fasta file of reference sequences. Unlike an alignment, the
+// records can be different lengths (e.g. the segments of a segmented genome)
+func loadReferences(refIn io.Reader) ([]fasta.EncodedRecord, error) {
+	refs := make([]fasta.EncodedRecord, 0)
+	r := fasta.NewReader(refIn)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ER, err := record.Encode()
+		if err != nil {
+			return nil, err
+		}
+		ER.Idx = len(refs)
+		refs = append(refs, ER)
+	}
+	return refs, nil
+}
+
+// refNames returns the names of the reference sequences in a sam header, in order
+func refNames(header biogosam.Header) ([]string, error) {
+	refs := header.Refs()
+	if len(refs) == 0 {
+		return nil, errors.New("no reference sequence (@SQ line) in sam header")
+	}
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Name()
+	}
+	return names, nil
+}
+
+// segmentWriters returns somewhere to write the output for each reference sequence in names: from outs if it isn't
+// nil, otherwise out itself if there is only one reference, or one buffer per reference (which writeSections later
+// writes to out, one after another) if there are more
+func segmentWriters(names []string, out io.Writer, outs SegmentOutputs) ([]io.Writer, []*bytes.Buffer, error) {
+
+	if outs != nil {
+		ws, err := outs(names)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ws) != len(names) {
+			return nil, nil, errors.New("wrong number of outputs for the reference sequences in the sam header")
+		}
+		return ws, nil, nil
+	}
+
+	if len(names) == 1 {
+		return []io.Writer{out}, nil, nil
+	}
+
+	ws := make([]io.Writer, len(names))
+	bufs := make([]*bytes.Buffer, len(names))
+	for i := range names {
+		bufs[i] = new(bytes.Buffer)
+		ws[i] = bufs[i]
+	}
+
+	return ws, bufs, nil
+}
+
+// writeSections writes the buffered output for each reference sequence to out in header order, each one after a
+// line made by sectionHeader (if it isn't nil)
+func writeSections(out io.Writer, names []string, bufs []*bytes.Buffer, sectionHeader func(string) string) error {
+	for i, buf := range bufs {
+		if sectionHeader != nil {
+			_, err := out.Write([]byte(sectionHeader(names[i])))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := buf.WriteTo(out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSegments splits each block of records for one query from cSR by the reference sequence that each record is
+// mapped to, and passes the pieces to the channel in cSegs for that reference. The pieces for each reference are
+// re-indexed in input order from zero, so that each reference's output can be written in input order. When cSR
+// is closed, so are all the channels in cSegs.
+func splitSegments(names []string, cSR chan samRecords, cSegs []chan samRecords, cErr chan error) {
+
+	which := make(map[string]int)
+	for i, name := range names {
+		which[name] = i
+	}
+
+	counters := make([]int, len(names))
+
+	for group := range cSR {
+		pieces := make([][]biogosam.Record, len(names))
+		for _, rec := range group.records {
+			if rec.Ref == nil {
+				cErr <- errors.New("no reference sequence for record: " + rec.Name)
+				return
+			}
+			i, ok := which[rec.Ref.Name()]
+			if !ok {
+				cErr <- errors.New("record " + rec.Name + " is mapped to a reference sequence that isn't in the sam header: " + rec.Ref.Name())
+				return
+			}
+			pieces[i] = append(pieces[i], rec)
+		}
+		for i, records := range pieces {
+			if len(records) == 0 {
+				continue
+			}
+			cSegs[i] <- samRecords{records: records, idx: counters[i]}
+			counters[i]++
+		}
+	}
+
+	for _, c := range cSegs {
+		close(c)
+	}
+}
+
+// checkSegmentTrimming returns an error if trimming coordinates are given for a sam file with more than one reference
+// sequence, since they would mean different things for each one
+func checkSegmentTrimming(names []string, trimstart int, trimend int) error {
+	if len(names) > 1 && (trimstart != -1 || trimend != -1) {
+		return errors.New("can't trim to --start and --end when there is more than one reference sequence in the sam header")
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package sam
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+var segmentsSamData = []byte(`@SQ	SN:segA	LN:9
+@SQ	SN:segB	LN:9
+q1	0	segA	1	60	9M	*	0	0	ATGAAGTAA	*
+q1	0	segB	1	60	9M	*	0	0	ATGCCCTAA	*
+q2	0	segA	1	60	9M	*	0	0	ATGGAATAA	*
+q3	0	segB	1	60	9M	*	0	0	ATGCTCTAA	*
+`)
+
+var segmentsRefData = []byte(`>segA
+ATGAAATAA
+>segB
+ATGCCCTAA
+`)
+
+var segmentsGFFData = []byte(`##gff-version 3
+segA	.	CDS	1	9	.	+	0	ID=cds-a;Name=a
+segB	.	CDS	1	9	.	+	0	ID=cds-b;Name=b
+`)
+
+func TestToMultiAlignSegments(t *testing.T) {
+	bufs := []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+	outs := func(names []string) ([]io.Writer, error) {
+		if len(names) != 2 || names[0] != "segA" || names[1] != "segB" {
+			t.Errorf("problem in TestToMultiAlignSegments: wrong reference names: %v", names)
+		}
+		return []io.Writer{bufs[0], bufs[1]}, nil
+	}
+
+	err := ToMultiAlignSegments(bytes.NewReader(segmentsSamData), outs, -1, -1, -1, false, false, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bufs[0].String() != ">q1\nATGAAGTAA\n>q2\nATGGAATAA\n" {
+		t.Errorf("problem in TestToMultiAlignSegments (segA)")
+		t.Error(bufs[0].String())
+	}
+	if bufs[1].String() != ">q1\nATGCCCTAA\n>q3\nATGCTCTAA\n" {
+		t.Errorf("problem in TestToMultiAlignSegments (segB)")
+		t.Error(bufs[1].String())
+	}
+
+	// with one output, the alignments are written one after another
+	out := new(bytes.Buffer)
+	err = ToMultiAlign(bytes.NewReader(segmentsSamData), out, -1, -1, -1, false, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != ">q1\nATGAAGTAA\n>q2\nATGGAATAA\n>q1\nATGCCCTAA\n>q3\nATGCTCTAA\n" {
+		t.Errorf("problem in TestToMultiAlignSegments (one output)")
+		t.Error(out.String())
+	}
+
+	err = ToMultiAlign(bytes.NewReader(segmentsSamData), new(bytes.Buffer), -1, 2, 5, false, false, 1)
+	if err == nil {
+		t.Errorf("expected an error for trimming more than one reference in TestToMultiAlignSegments")
+	}
+}
+
+func TestVariantsSegments(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := Variants(bytes.NewReader(segmentsSamData), bytes.NewReader(segmentsRefData), true, bytes.NewReader(segmentsGFFData), "gff", out, variants.Options{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `# segA
+query,mutations
+q1,nuc:A6G
+q2,aa:a:K2E
+# segB
+query,mutations
+q1,
+q3,aa:b:P2L
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestVariantsSegments")
+		t.Error(out.String())
+	}
+
+	// in long format, the reference is named on every row instead
+	out = new(bytes.Buffer)
+	err = Variants(bytes.NewReader(segmentsSamData), bytes.NewReader(segmentsRefData), true, bytes.NewReader(segmentsGFFData), "gff", out, variants.Options{Format: "long"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `query,reference,type,feature,position,residue,ref_allele,alt_allele,length,ref_codon,alt_codon,snps,consequence
+q1,segA,nuc,,6,,A,G,,,,,synonymous_variant
+q2,segA,aa,a,4,2,K,E,,AAA,GAA,nuc:A4G,missense_variant
+q3,segB,aa,b,4,2,P,L,,CCC,CTC,nuc:C5T,missense_variant
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestVariantsSegments (long)")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = Variants(bytes.NewReader(segmentsSamData), bytes.NewReader(segmentsRefData), true, bytes.NewReader(segmentsGFFData), "gff", out, variants.Options{Format: "json"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `{"query":"q1","reference":"segA","variants":[{"ref":"A","alt":"G","position":6,"type":"nuc","consequence":"synonymous_variant"}]}
+{"query":"q2","reference":"segA","variants":[{"ref":"K","alt":"E","position":4,"residue":2,"type":"aa","feature":"a","snps":"nuc:A4G","ref_codon":"AAA","alt_codon":"GAA","consequence":"missense_variant"}]}
+{"query":"q1","reference":"segB","variants":[]}
+{"query":"q3","reference":"segB","variants":[{"ref":"P","alt":"L","position":4,"residue":2,"type":"aa","feature":"b","snps":"nuc:C5T","ref_codon":"CCC","alt_codon":"CTC","consequence":"missense_variant"}]}
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestVariantsSegments (json)")
+		t.Error(out.String())
+	}
+
+	// in vcf format, there is one header with a contig line per reference, and a query that isn't aligned to a
+	// reference has a missing genotype at its sites
+	out = new(bytes.Buffer)
+	err = Variants(bytes.NewReader(segmentsSamData), bytes.NewReader(segmentsRefData), true, bytes.NewReader(segmentsGFFData), "gff", out, variants.Options{Format: "vcf"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = "##fileformat=VCFv4.3\n" +
+		"##source=gofasta\n" +
+		"##contig=<ID=segA,length=9>\n" +
+		"##contig=<ID=segB,length=9>\n" +
+		"##INFO=<ID=TYPE,Number=A,Type=String,Description=\"Type of each alternate allele (snp, ins or del)\">\n" +
+		"##INFO=<ID=AA,Number=A,Type=String,Description=\"Amino acid change(s) caused by each alternate allele, \\\"|\\\"-delimited, or . if none\">\n" +
+		"##INFO=<ID=AC,Number=A,Type=Integer,Description=\"Number of sequences carrying each alternate allele\">\n" +
+		"##INFO=<ID=AN,Number=1,Type=Integer,Description=\"Number of sequences without missing data at the site\">\n" +
+		"##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tq1\tq2\tq3\n" +
+		"segA\t4\t.\tA\tG\t.\t.\tTYPE=snp;AA=a:K2E;AC=1;AN=2\tGT\t0\t1\t.\n" +
+		"segA\t6\t.\tA\tG\t.\t.\tTYPE=snp;AC=1;AN=2\tGT\t1\t0\t.\n" +
+		"segB\t5\t.\tC\tT\t.\t.\tTYPE=snp;AA=b:P2L;AC=1;AN=2\tGT\t0\t.\t1\n"
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestVariantsSegments (vcf)")
+		t.Error(out.String())
+	}
+
+	err = Variants(bytes.NewReader(segmentsSamData), bytes.NewReader(segmentsRefData[:bytes.Index(segmentsRefData, []byte(">segB"))]), true, bytes.NewReader(segmentsGFFData), "gff", new(bytes.Buffer), variants.Options{}, 1)
+	if err == nil {
+		t.Errorf("expected an error for a missing reference sequence in TestVariantsSegments")
+	}
+}
+
+// segments of different lengths, as in a real segmented genome
+var segmentsUnequalSamData = []byte(`@SQ	SN:segA	LN:12
+@SQ	SN:segB	LN:9
+q1	0	segA	1	60	12M	*	0	0	ATGAAGCCCTAA	*
+q1	0	segB	1	60	9M	*	0	0	ATGCTCTAA	*
+`)
+
+var segmentsUnequalRefData = []byte(`>segA
+ATGAAACCCTAA
+>segB
+ATGCCCTAA
+`)
+
+var segmentsUnequalGFFData = []byte(`##gff-version 3
+segA	.	CDS	1	12	.	+	0	ID=cds-a;Name=a
+segB	.	CDS	1	9	.	+	0	ID=cds-b;Name=b
+`)
+
+func TestSegmentsUnequalLengths(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := Variants(bytes.NewReader(segmentsUnequalSamData), bytes.NewReader(segmentsUnequalRefData), true, bytes.NewReader(segmentsUnequalGFFData), "gff", out, variants.Options{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `# segA
+query,mutations
+q1,nuc:A6G
+# segB
+query,mutations
+q1,aa:b:P2L
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSegmentsUnequalLengths (variants)")
+		t.Error(out.String())
+	}
+
+	dir := t.TempDir()
+	err = ToPairAlign(bytes.NewReader(segmentsUnequalSamData), bytes.NewReader(segmentsUnequalRefData), dir, -1, -1, -1, false, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct{ file, content string }{
+		{filepath.Join(dir, "segA", "q1.fasta"), ">segA\nATGAAACCCTAA\n>q1\nATGAAGCCCTAA\n"},
+		{filepath.Join(dir, "segB", "q1.fasta"), ">segB\nATGCCCTAA\n>q1\nATGCTCTAA\n"},
+	} {
+		got, err := os.ReadFile(want.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want.content {
+			t.Errorf("problem in TestSegmentsUnequalLengths (topa)")
+			t.Error(string(got))
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package sam
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	biogosam "github.com/biogo/hts/sam"
+)
+
+// mappingStats is the mapping summary for one query
+type mappingStats struct {
+	Query               string  `json:"query"`
+	Length              int     `json:"length"`
+	Mapped              bool    `json:"mapped"`
+	Primary             int     `json:"primary"`
+	Supplementary       int     `json:"supplementary"`
+	Secondary           int     `json:"secondary"`
+	Strand              string  `json:"strand"`
+	RefStart            int     `json:"ref_start"`
+	RefEnd              int     `json:"ref_end"`
+	ClippedStart        int     `json:"clipped_start"`
+	ClippedEnd          int     `json:"clipped_end"`
+	MAPQ                int     `json:"mapq"`
+	OverlappingSegments int     `json:"overlapping_segments"`
+	Insertions          int     `json:"insertions"`
+	InsertedBases       int     `json:"inserted_bases"`
+	Deletions           int     `json:"deletions"`
+	DeletedBases        int     `json:"deleted_bases"`
+	RefCoverage         float64 `json:"ref_coverage"`
+}
+
+var mappingStatsHeader = "query,length,mapped,primary,supplementary,secondary,strand,ref_start,ref_end,clipped_start,clipped_end,mapq,overlapping_segments,insertions,inserted_bases,deletions,deleted_bases,ref_coverage\n"
+
+func (s mappingStats) csvFields() string {
+	return s.Query + "," + strconv.Itoa(s.Length) + "," + strconv.FormatBool(s.Mapped) + "," + strconv.Itoa(s.Primary) +
+		"," + strconv.Itoa(s.Supplementary) + "," + strconv.Itoa(s.Secondary) + "," + s.Strand + "," + strconv.Itoa(s.RefStart) +
+		"," + strconv.Itoa(s.RefEnd) + "," + strconv.Itoa(s.ClippedStart) + "," + strconv.Itoa(s.ClippedEnd) + "," + strconv.Itoa(s.MAPQ) +
+		"," + strconv.Itoa(s.OverlappingSegments) + "," + strconv.Itoa(s.Insertions) + "," + strconv.Itoa(s.InsertedBases) +
+		"," + strconv.Itoa(s.Deletions) + "," + strconv.Itoa(s.DeletedBases) + "," + strconv.FormatFloat(s.RefCoverage, 'f', 4, 64) + "\n"
+}
+
+// queryLength is the length of the query in a record, including any hard-clipped bases
+func queryLength(rec biogosam.Record) int {
+	if len(rec.Cigar) == 0 {
+		return rec.Seq.Length
+	}
+	l := 0
+	for _, op := range rec.Cigar {
+		switch op.Type() {
+		case biogosam.CigarMatch, biogosam.CigarEqual, biogosam.CigarMismatch, biogosam.CigarInsertion, biogosam.CigarSoftClipped, biogosam.CigarHardClipped:
+			l += op.Len()
+		}
+	}
+	return l
+}
+
+// alignedQuery returns the part of the query (in its original orientation) that a record aligns, as a half-open interval
+func alignedQuery(rec biogosam.Record, qLen int) (int, int) {
+	clip, aligned := 0, 0
+	leading := true
+	for _, op := range rec.Cigar {
+		switch op.Type() {
+		case biogosam.CigarSoftClipped, biogosam.CigarHardClipped:
+			if leading {
+				clip += op.Len()
+			}
+		case biogosam.CigarMatch, biogosam.CigarEqual, biogosam.CigarMismatch, biogosam.CigarInsertion:
+			leading = false
+			aligned += op.Len()
+		default:
+			leading = false
+		}
+	}
+	if rec.Flags&biogosam.Reverse != 0 {
+		return qLen - clip - aligned, qLen - clip
+	}
+	return clip, clip + aligned
+}
+
+// getMappingStats summarises all the records for one query
+func getMappingStats(records []biogosam.Record) mappingStats {
+	s := mappingStats{Query: records[0].Name}
+
+	mapped := make([]biogosam.Record, 0, len(records))
+	for _, rec := range records {
+		switch {
+		case rec.Flags&biogosam.Unmapped != 0:
+		case rec.Flags&biogosam.Secondary != 0:
+			s.Secondary++
+		case rec.Flags&biogosam.Supplementary != 0:
+			s.Supplementary++
+			mapped = append(mapped, rec)
+		default:
+			s.Primary++
+			// the primary record goes first
+			mapped = append([]biogosam.Record{rec}, mapped...)
+		}
+	}
+
+	s.Length = queryLength(records[0])
+	if len(mapped) == 0 {
+		return s
+	}
+
+	s.Mapped = true
+	s.Length = queryLength(mapped[0])
+	s.MAPQ = int(mapped[0].MapQ)
+	s.Strand = "+"
+	if mapped[0].Flags&biogosam.Reverse != 0 {
+		s.Strand = "-"
+	}
+
+	refLen := 0
+	if mapped[0].Ref != nil {
+		refLen = mapped[0].Ref.Len()
+	}
+	covered := make([]bool, refLen)
+
+	qStart, qEnd := s.Length, 0
+	spans := make([][2]int, len(mapped))
+	for i, rec := range mapped {
+		start, end := alignedQuery(rec, s.Length)
+		if start < qStart {
+			qStart = start
+		}
+		if end > qEnd {
+			qEnd = end
+		}
+
+		rpos := rec.Pos
+		for _, op := range rec.Cigar {
+			switch op.Type() {
+			case biogosam.CigarMatch, biogosam.CigarEqual, biogosam.CigarMismatch:
+				for j := rpos; j < rpos+op.Len() && j < refLen; j++ {
+					covered[j] = true
+				}
+				rpos += op.Len()
+			case biogosam.CigarInsertion:
+				s.Insertions++
+				s.InsertedBases += op.Len()
+			case biogosam.CigarDeletion:
+				s.Deletions++
+				s.DeletedBases += op.Len()
+				rpos += op.Len()
+			case biogosam.CigarSkipped:
+				rpos += op.Len()
+			}
+		}
+		spans[i] = [2]int{rec.Pos, rpos}
+
+		if i == 0 || rec.Pos+1 < s.RefStart {
+			s.RefStart = rec.Pos + 1
+		}
+		if rpos > s.RefEnd {
+			s.RefEnd = rpos
+		}
+	}
+	s.ClippedStart = qStart
+	s.ClippedEnd = s.Length - qEnd
+
+	// supplementary records that overlap another record of the same query in the reference
+	for i := 1; i < len(spans); i++ {
+		for j := range spans {
+			if j != i && spans[i][0] < spans[j][1] && spans[j][0] < spans[i][1] {
+				s.OverlappingSegments++
+				break
+			}
+		}
+	}
+
+	if refLen > 0 {
+		n := 0
+		for _, c := range covered {
+			if c {
+				n++
+			}
+		}
+		s.RefCoverage = math.Round(float64(n)/float64(refLen)*10000) / 10000
+	}
+
+	return s
+}
+
+// Stats writes a summary of how each query in a sam (or bam) file is mapped, in csv format or as a json array
+// (format "csv" or "json"), in the same order as the input. Unlike the other sam commands, unmapped queries and
+// secondary records are counted, not skipped. The records for each query must be next to each other in the file.
+//
+// For each query it reports the number of primary, supplementary and secondary records; the strand and mapping
+// quality of the primary record; the span of the reference that the primary and supplementary records cover; how
+// many bases at the start and end of the query aren't in any of them; how many supplementary records overlap
+// another record in the reference; the number and total length of insertions and deletions; and the proportion of
+// the reference that has a base from the query aligned to it.
+func Stats(samIn io.Reader, format string, out io.Writer) error {
+
+	if format != "csv" && format != "json" {
+		return errors.New("unknown output format: " + format)
+	}
+
+	s, err := newRecordReader(samIn)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "csv":
+		_, err = out.Write([]byte(mappingStatsHeader))
+	case "json":
+		_, err = out.Write([]byte("["))
+	}
+	if err != nil {
+		return err
+	}
+
+	counter := 0
+	write := func(records []biogosam.Record) error {
+		ms := getMappingStats(records)
+		var b []byte
+		switch format {
+		case "csv":
+			b = []byte(ms.csvFields())
+		case "json":
+			b, err = json.Marshal(ms)
+			if err != nil {
+				return err
+			}
+			if counter > 0 {
+				b = append([]byte(",\n"), b...)
+			}
+		}
+		counter++
+		_, err := out.Write(b)
+		return err
+	}
+
+	group := make([]biogosam.Record, 0)
+	for {
+		rec, err := s.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(group) > 0 && rec.Name != group[0].Name {
+			err = write(group)
+			if err != nil {
+				return err
+			}
+			group = group[:0]
+		}
+		group = append(group, *rec)
+	}
+	if len(group) > 0 {
+		err = write(group)
+		if err != nil {
+			return err
+		}
+	}
+
+	if format == "json" {
+		_, err = out.Write([]byte("]\n"))
+	}
+
+	return err
+}
@@ -0,0 +1,50 @@
+package sam
+
+import (
+	"bytes"
+	"testing"
+)
+
+var statsSamData = []byte(`@SQ	SN:ref	LN:20
+q1	0	ref	1	60	20M	*	0	0	ACGTACGTACGTACGTACGT	*
+q2	16	ref	3	50	2S5M1I3M2D4M3S	*	0	0	ACGTACGTACGTACGTAC	*
+q3	0	ref	11	60	10S10M	*	0	0	ACGTACGTACGTACGTACGT	*
+q3	2048	ref	1	60	10M10S	*	0	0	ACGTACGTACGTACGTACGT	*
+q3	2064	ref	5	60	5M15S	*	0	0	ACGTACGTACGTACGTACGT	*
+q4	4	*	0	0	*	*	0	0	ACGT	*
+q5	0	ref	1	60	4M	*	0	0	ACGT	*
+q5	256	ref	9	0	4M	*	0	0	ACGT	*
+`)
+
+func TestStats(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := Stats(bytes.NewReader(statsSamData), "csv", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `query,length,mapped,primary,supplementary,secondary,strand,ref_start,ref_end,clipped_start,clipped_end,mapq,overlapping_segments,insertions,inserted_bases,deletions,deleted_bases,ref_coverage
+q1,20,true,1,0,0,+,1,20,0,0,60,0,0,0,0,0,1.0000
+q2,18,true,1,0,0,-,3,16,3,2,50,0,1,1,1,2,0.6000
+q3,20,true,1,2,0,+,1,20,0,0,60,2,0,0,0,0,1.0000
+q4,4,false,0,0,0,,0,0,0,0,0,0,0,0,0,0,0.0000
+q5,4,true,1,0,1,+,1,4,0,0,60,0,0,0,0,0,0.2000
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestStats")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = Stats(bytes.NewReader(statsSamData[:bytes.Index(statsSamData, []byte("q3"))]), "json", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `[{"query":"q1","length":20,"mapped":true,"primary":1,"supplementary":0,"secondary":0,"strand":"+","ref_start":1,"ref_end":20,"clipped_start":0,"clipped_end":0,"mapq":60,"overlapping_segments":0,"insertions":0,"inserted_bases":0,"deletions":0,"deleted_bases":0,"ref_coverage":1},
+{"query":"q2","length":18,"mapped":true,"primary":1,"supplementary":0,"secondary":0,"strand":"-","ref_start":3,"ref_end":16,"clipped_start":3,"clipped_end":2,"mapq":50,"overlapping_segments":0,"insertions":1,"inserted_bases":1,"deletions":1,"deleted_bases":2,"ref_coverage":0.6}]
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestStats (json)")
+		t.Error(out.String())
+	}
+}
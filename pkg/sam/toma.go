@@ -11,31 +11,117 @@ import (
 )
 
 // ToMultiAlign converts a SAM file containing pairwise alignments between assembled genomes to a fasta-format alignment.
-// Insertions relative to the reference are discarded, so all the sequences are the same (=reference) length
-func ToMultiAlign(samIn io.Reader, out io.Writer, wrap int, trimstart int, trimend int, pad bool, threads int) error {
+// If insertions is false, insertions relative to the reference are discarded, so all the sequences are the same
+// (=reference) length. Otherwise the insertions in every sequence are kept: the reference is widened by the longest
+// insertion at each position, and sequences without that insertion (or with a shorter one) are padded with gaps.
+// This needs every sequence to be held in memory until the whole file has been read. If there is more than one
+// reference sequence in the header, there is one alignment for each, written to out one after another in header order.
+func ToMultiAlign(samIn io.Reader, out io.Writer, wrap int, trimstart int, trimend int, pad bool, insertions bool, threads int) error {
+	return toMultiAlign(samIn, out, nil, wrap, trimstart, trimend, pad, insertions, threads)
+}
+
+// ToMultiAlignSegments is ToMultiAlign, but writes the alignment for each reference sequence in the header (e.g.
+// each segment of a segmented genome) to its own output from outs. Each query's records are split by the reference
+// they are mapped to, so a query appears in the alignment of every reference it has a record against.
+func ToMultiAlignSegments(samIn io.Reader, outs SegmentOutputs, wrap int, trimstart int, trimend int, pad bool, insertions bool, threads int) error {
+	return toMultiAlign(samIn, nil, outs, wrap, trimstart, trimend, pad, insertions, threads)
+}
+
+func toMultiAlign(samIn io.Reader, out io.Writer, outs SegmentOutputs, wrap int, trimstart int, trimend int, pad bool, insertions bool, threads int) error {
 
 	cSR := make(chan samRecords, threads)
 	cReadDone := make(chan bool)
 
 	cSH := make(chan biogosam.Header)
 
-	cFR := make(chan fasta.Record)
-	cWriteDone := make(chan bool)
-
 	cErr := make(chan error)
 
-	cWaitGroupDone := make(chan bool)
+	cSegmentDone := make(chan bool)
 
 	go groupSamRecords(samIn, cSH, cSR, cReadDone, cErr)
 
-	header := <-cSH
-	refLen := header.Refs()[0].Len()
+	var header biogosam.Header
+	select {
+	case header = <-cSH:
+	case err := <-cErr:
+		return err
+	}
+
+	names, err := refNames(header)
+	if err != nil {
+		return err
+	}
+	err = checkSegmentTrimming(names, trimstart, trimend)
+	if err != nil {
+		return err
+	}
 
-	trimstart, trimend, trim, err := checkArgs(refLen, trimstart, trimend)
+	ws, bufs, err := segmentWriters(names, out, outs)
 	if err != nil {
 		return err
 	}
 
+	cSegs := make([]chan samRecords, len(names))
+	for i := range cSegs {
+		cSegs[i] = make(chan samRecords, threads)
+	}
+
+	for i, ref := range header.Refs() {
+		refLen := ref.Len()
+		start, end, trim, err := checkArgs(refLen, trimstart, trimend)
+		if err != nil {
+			return err
+		}
+		go func(cSR chan samRecords, w io.Writer) {
+			var err error
+			if insertions {
+				err = toMultiAlignInsertions(cSR, w, wrap, refLen, trim, pad, start, end, threads)
+			} else {
+				err = toMultiAlignSegment(cSR, w, wrap, refLen, trim, pad, start, end, threads)
+			}
+			if err != nil {
+				cErr <- err
+				return
+			}
+			cSegmentDone <- true
+		}(cSegs[i], ws[i])
+	}
+
+	go splitSegments(names, cSR, cSegs, cErr)
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cReadDone:
+			close(cSR)
+			close(cSH)
+			n--
+		}
+	}
+
+	for n := len(names); n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cSegmentDone:
+			n--
+		}
+	}
+
+	return writeSections(out, names, bufs, nil)
+}
+
+// toMultiAlignSegment writes the alignment of the records against one reference sequence from cSR, until it is closed
+func toMultiAlignSegment(cSR chan samRecords, out io.Writer, wrap int, refLen int, trim bool, pad bool, trimstart int, trimend int, threads int) error {
+
+	cFR := make(chan fasta.Record)
+	cWriteDone := make(chan bool)
+
+	cErr := make(chan error)
+
+	cWaitGroupDone := make(chan bool)
+
 	if wrap > 0 {
 		go fasta.WriteWrapAlignment(cFR, out, wrap, cErr, cWriteDone)
 	} else {
@@ -57,17 +143,6 @@ func ToMultiAlign(samIn io.Reader, out io.Writer, wrap int, trimstart int, trime
 		cWaitGroupDone <- true
 	}()
 
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return err
-		case <-cReadDone:
-			close(cSR)
-			close(cSH)
-			n--
-		}
-	}
-
 	for n := 1; n > 0; {
 		select {
 		case err := <-cErr:
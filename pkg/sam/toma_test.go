@@ -34,7 +34,7 @@ England/PLYM-1FCEE8A/2021	0	MN908947.3	55	60	54S21974M6D6213M6D17M1D1563M69S	*	0
 
 	out := new(bytes.Buffer)
 
-	err := ToMultiAlign(sam, out, -1, -1, -1, false, 2)
+	err := ToMultiAlign(sam, out, -1, -1, -1, false, false, 2)
 	if err != nil {
 		t.Error(err)
 	}
@@ -94,7 +94,7 @@ England/PLYM-1FCEE8A/2021	0	MN908947.3	55	60	54S21974M6D6213M6D17M1D1563M69S	*	0
 
 	out := new(bytes.Buffer)
 
-	err := ToMultiAlign(sam, out, 80, -1, -1, false, 2)
+	err := ToMultiAlign(sam, out, 80, -1, -1, false, false, 2)
 	if err != nil {
 		t.Error(err)
 	}
@@ -3854,3 +3854,53 @@ ACAGTGAACAATGCTAGGGAGAGCTGCCTATATGGAAGAGCCCTAATGTGTAAAATTAATTTTAGTAGTGCTAT------
 	}
 
 }
+
+func TestToMultiAlignInsertions(t *testing.T) {
+	samData := []byte(`@SQ	SN:ref	LN:20
+q1	0	ref	1	60	10M3I10M	*	0	0	ACGTACGTACGGGGTACGTACGT	*
+q2	0	ref	1	60	5M2I15M	*	0	0	ACGTATTCGTACGTACGTACGT	*
+q3	0	ref	3	60	10M	*	0	0	GTACGTACGT	*
+q4	0	ref	1	60	10M1I10M	*	0	0	ACGTACGTACCGTACGTACGT	*
+`)
+
+	out := new(bytes.Buffer)
+	err := ToMultiAlign(bytes.NewReader(samData), out, -1, -1, -1, false, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>q1
+ACGTA--CGTACGGGGTACGTACGT
+>q2
+ACGTATTCGTAC---GTACGTACGT
+>q3
+--GTA--CGTAC---GT--------
+>q4
+ACGTA--CGTACC--GTACGTACGT
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestToMultiAlignInsertions")
+		t.Error(out.String())
+	}
+
+	// insertions that aren't between two kept positions are left out
+	out = new(bytes.Buffer)
+	err = ToMultiAlign(bytes.NewReader(samData), out, -1, 6, 15, false, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult = `>q1
+CGTACGGGGTACG
+>q2
+CGTAC---GTACG
+>q3
+CGTAC---GT---
+>q4
+CGTACC--GTACG
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestToMultiAlignInsertions (trimmed)")
+		t.Error(out.String())
+	}
+}
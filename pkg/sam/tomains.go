@@ -0,0 +1,186 @@
+package sam
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+
+	biogosam "github.com/biogo/hts/sam"
+)
+
+// insRecord is one query's aligned sequence in reference coordinates, plus its insertions relative to the reference
+type insRecord struct {
+	id  string
+	idx int
+	seq []byte
+	ins map[int]string // inserted sequence, keyed by the (0-based) reference position that it comes before
+}
+
+// getInsertions returns the insertions in one query's sam records. If more than one record has an insertion
+// at the same position, the longest is kept
+func getInsertions(records []biogosam.Record) map[int]string {
+	ins := make(map[int]string)
+	for _, rec := range records {
+		if rec.Pos < 0 {
+			continue
+		}
+		SEQ := rec.Seq.Expand()
+		qstart, rstart := 0, rec.Pos
+		for _, op := range rec.Cigar {
+			size := op.Len()
+			switch op.Type().String() {
+			case "M", "=", "X":
+				qstart += size
+				rstart += size
+			case "I":
+				if size > len(ins[rstart]) {
+					ins[rstart] = string(SEQ[qstart : qstart+size])
+				}
+				qstart += size
+			case "S":
+				qstart += size
+			case "D", "N":
+				rstart += size
+			}
+		}
+	}
+	return ins
+}
+
+// blockToInsRecord is a worker function that takes items from a channel of sam block structs (with indices)
+// and writes the corresponding sequences, untrimmed, and their insertions to a channel
+func blockToInsRecord(ch_in chan samRecords, ch_out chan insRecord, ch_err chan error, refLen int, pad bool) {
+	for group := range ch_in {
+		rawseq, err := getSeqFromBlock(group.records, refLen, false)
+		if err != nil {
+			ch_err <- err
+			return
+		}
+		if pad {
+			rawseq = swapInNs(rawseq)
+		} else {
+			rawseq = swapInGapsNs(rawseq)
+		}
+		ch_out <- insRecord{id: group.records[0].Name, idx: group.idx, seq: rawseq, ins: getInsertions(group.records)}
+	}
+}
+
+// expandRecord returns a record's sequence with the insertion columns in widths added, trimmed and padded in the
+// same way as by getRecord. widths is keyed in the same way as insRecord.ins
+func expandRecord(ir insRecord, widths map[int]int, trim bool, pad bool, trimstart int, trimend int) fasta.Record {
+	from, to := 0, len(ir.seq)
+	if trim && !pad {
+		from, to = trimstart-1, trimend
+	}
+
+	var sb strings.Builder
+	for r := from; r <= to; r++ {
+		if w, ok := widths[r]; ok {
+			s := ir.ins[r]
+			sb.WriteString(s)
+			sb.WriteString(strings.Repeat("-", w-len(s)))
+		}
+		if r == to {
+			break
+		}
+		if trim && pad && (r < trimstart-1 || r >= trimend) {
+			sb.WriteByte('N')
+		} else {
+			sb.WriteByte(ir.seq[r])
+		}
+	}
+
+	return fasta.Record{ID: ir.id, Description: ir.id, Seq: sb.String(), Idx: ir.idx}
+}
+
+// toMultiAlignInsertions does the work of ToMultiAlign when insertions are kept. Every sequence is collected before
+// any are written, because the width of the alignment isn't known until then
+func toMultiAlignInsertions(cSR chan samRecords, out io.Writer, wrap int, refLen int, trim bool, pad bool,
+	trimstart int, trimend int, threads int) error {
+
+	cErr := make(chan error)
+
+	cIR := make(chan insRecord, threads)
+	cCollectDone := make(chan bool)
+	cWaitGroupDone := make(chan bool)
+
+	records := make([]insRecord, 0)
+	go func() {
+		for ir := range cIR {
+			records = append(records, ir)
+		}
+		cCollectDone <- true
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			blockToInsRecord(cSR, cIR, cErr, refLen, pad)
+			wg.Done()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cWaitGroupDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWaitGroupDone:
+			close(cIR)
+			n--
+		}
+	}
+
+	<-cCollectDone
+
+	sort.Slice(records, func(i, j int) bool { return records[i].idx < records[j].idx })
+
+	// the width of each insertion column is the longest insertion there. If the alignment is trimmed, only
+	// insertions between two of the positions that are kept are kept
+	widths := make(map[int]int)
+	for _, ir := range records {
+		for r, s := range ir.ins {
+			if trim && (r < trimstart || r > trimend-1) {
+				continue
+			}
+			if len(s) > widths[r] {
+				widths[r] = len(s)
+			}
+		}
+	}
+
+	cFR := make(chan fasta.Record)
+	cWriteDone := make(chan bool)
+
+	if wrap > 0 {
+		go fasta.WriteWrapAlignment(cFR, out, wrap, cErr, cWriteDone)
+	} else {
+		go fasta.WriteAlignment(cFR, out, cErr, cWriteDone)
+	}
+
+	go func() {
+		for _, ir := range records {
+			cFR <- expandRecord(ir, widths, trim, pad, trimstart, trimend)
+		}
+		close(cFR)
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"sync"
 
 	"github.com/virus-evolution/gofasta/pkg/fasta"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
 
 	biogosam "github.com/biogo/hts/sam"
 )
@@ -344,8 +345,9 @@ func wrap(old string, wrap int) string {
 }
 
 // writePairwiseAlignment writes the pairwise alignments between reference and queries to a directory, p, one fasta
-// file per query
-func writePairwiseAlignment(p string, w int, cPair chan alignPair, cWriteDone chan bool, cErr chan error, omitRef bool) {
+// file per query. If bySegment is true, each reference sequence's alignments are written to a subdirectory of p
+// named after it
+func writePairwiseAlignment(p string, w int, cPair chan alignPair, cWriteDone chan bool, cErr chan error, omitRef bool, bySegment bool) {
 
 	_ = path.Join()
 
@@ -376,6 +378,11 @@ func writePairwiseAlignment(p string, w int, cPair chan alignPair, cWriteDone ch
 		os.MkdirAll(p, 0755)
 
 		for AP := range cPair {
+			dir := p
+			if bySegment {
+				dir = path.Join(p, strings.ReplaceAll(AP.refname, "/", "_"))
+				os.MkdirAll(dir, 0755)
+			}
 			// forward slashes are illegal in unix filenames (so is ascii NUL ?)
 			des := strings.ReplaceAll(AP.queryname, "/", "_")
 			// unix filenames must be <= 255 chars, (account for ".fasta")
@@ -383,61 +390,74 @@ func writePairwiseAlignment(p string, w int, cPair chan alignPair, cWriteDone ch
 				fmt.Fprintf(os.Stderr, "Filename too long, truncating \"%s\" to: \"%s\"\n", des, des[0:249])
 				des = des[0:249]
 			}
-			f, err := os.Create(path.Join(p, des+".fasta"))
+			f, err := gfio.Create(path.Join(dir, des+".fasta"))
 			if err != nil {
 				cErr <- err
+				return
 			}
 			if !omitRef {
-				_, err = f.WriteString(">" + AP.refname + "\n")
+				_, err = io.WriteString(f, ">"+AP.refname+"\n")
 				if err != nil {
 					cErr <- err
 				}
-				_, err = f.WriteString(wrap(string(AP.ref), w))
+				_, err = io.WriteString(f, wrap(string(AP.ref), w))
 				if err != nil {
 					cErr <- err
 				}
 			}
-			_, err = f.WriteString(">" + AP.queryname + "\n")
+			_, err = io.WriteString(f, ">"+AP.queryname+"\n")
 			if err != nil {
 				cErr <- err
 			}
-			_, err = f.WriteString(wrap(string(AP.query), w))
+			_, err = io.WriteString(f, wrap(string(AP.query), w))
+			if err != nil {
+				cErr <- err
+			}
+			err = f.Close()
 			if err != nil {
 				cErr <- err
 			}
-			f.Close()
 		}
 	}
 	cWriteDone <- true
 }
 
+// segmentSequences returns the sequence in refs for each reference sequence named in a sam header. If there is one
+// of each they are assumed to match, otherwise they are matched by name
+func segmentSequences(names []string, refs []fasta.EncodedRecord) ([][]byte, error) {
+	seqs := make([][]byte, len(names))
+	if len(names) == 1 && len(refs) == 1 {
+		seqs[0] = []byte(refs[0].Decode().Seq)
+		return seqs, nil
+	}
+	for i, name := range names {
+		for _, ref := range refs {
+			if ref.ID == name {
+				seqs[i] = []byte(ref.Decode().Seq)
+				break
+			}
+		}
+		if seqs[i] == nil {
+			return nil, errors.New("couldn't find reference sequence " + name + " (from the sam header) in --reference")
+		}
+	}
+	return seqs, nil
+}
+
 // ToPairAlign converts a SAM file containing pairwise alignments between assembled genomes into pairwise fasta-format alignments,
-// optionally including the reference sequence and insertions relative to it, optionally trimmed to coordinates in (degapped-)reference space
+// optionally including the reference sequence and insertions relative to it, optionally trimmed to coordinates in (degapped-)reference space.
+// If there is more than one reference sequence in the sam header, ref must have a record with the same name for each one,
+// and each one's alignments are written to their own subdirectory of outpath.
 func ToPairAlign(samIn, ref io.Reader, outpath string, wrap int, trimStart int, trimEnd int, omitRef bool, omitIns bool, threads int) error {
 
-	// NB probably uncomment the below and use it for checks (e.g. for
-	// reference length)
-	// samHeader, err := getSamHeader(samFile)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// refLen := samHeader.Refs()[0].Len()
-
 	cErr := make(chan error)
 
-	refs, err := fasta.LoadEncodeAlignment(ref, false, false, false)
+	refs, err := loadReferences(ref)
 	if err != nil {
 		return err
 	}
-	if len(refs) != 1 {
-		return errors.New("Need one record in --reference")
-	}
-	refSeq := refs[0].Decode().Seq
-
-	trimStart, trimEnd, trim, err := checkArgs(len(refSeq), trimStart, trimEnd)
-	if err != nil {
-		return err
+	if len(refs) == 0 {
+		return errors.New("Need at least one record in --reference")
 	}
 
 	cSR := make(chan samRecords, threads)
@@ -453,21 +473,52 @@ func ToPairAlign(samIn, ref io.Reader, outpath string, wrap int, trimStart int,
 
 	go groupSamRecords(samIn, cSH, cSR, cReadDone, cErr)
 
-	_ = <-cSH
+	var header biogosam.Header
+	select {
+	case header = <-cSH:
+	case err := <-cErr:
+		return err
+	}
 
-	go writePairwiseAlignment(outpath, wrap, cPairTrim, cWriteDone, cErr, omitRef)
+	names, err := refNames(header)
+	if err != nil {
+		return err
+	}
+	err = checkSegmentTrimming(names, trimStart, trimEnd)
+	if err != nil {
+		return err
+	}
+	refSeqs, err := segmentSequences(names, refs)
+	if err != nil {
+		return err
+	}
+
+	trimStart, trimEnd, trim, err := checkArgs(len(refSeqs[0]), trimStart, trimEnd)
+	if err != nil {
+		return err
+	}
+
+	cSegs := make([]chan samRecords, len(names))
+	for i := range cSegs {
+		cSegs[i] = make(chan samRecords, threads)
+	}
+	go splitSegments(names, cSR, cSegs, cErr)
+
+	go writePairwiseAlignment(outpath, wrap, cPairTrim, cWriteDone, cErr, omitRef, len(names) > 1)
 
 	var wgAlign sync.WaitGroup
-	wgAlign.Add(threads)
+	wgAlign.Add(threads * len(names))
 
 	var wgTrim sync.WaitGroup
 	wgTrim.Add(threads)
 
-	for n := 0; n < threads; n++ {
-		go func() {
-			blockToPairwiseAlignment(cSR, cPairAlign, cErr, []byte(refSeq), omitIns)
-			wgAlign.Done()
-		}()
+	for i := range names {
+		for n := 0; n < threads; n++ {
+			go func(cSR chan samRecords, refSeq []byte) {
+				blockToPairwiseAlignment(cSR, cPairAlign, cErr, refSeq, omitIns)
+				wgAlign.Done()
+			}(cSegs[i], refSeqs[i])
+		}
 	}
 
 	for n := 0; n < threads; n++ {
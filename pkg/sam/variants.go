@@ -17,114 +17,170 @@ import (
 // Variants annotates amino acid, insertion, deletion, and nucleotide (anything
 // outside of codons with an amino acid change) mutations relative to a reference
 // sequence from pairwise alignments in sam format. Genome annotations are
-// derived from a annotation file in genbank or gff version 3 format
-func Variants(samIn, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSuffix string, out io.Writer, start, end int, aggregate bool, threshold float64, appendSNP bool, appendCodons bool, threads int) error {
+// derived from a annotation file in genbank or gff version 3 format. What is written,
+// and in which format, is given by o (see variants.Options). If there is more than one reference sequence in the sam header
+// (e.g. the segments of a segmented genome), each one is matched by name to a record
+// in refIn and in the annotation, and its variants are written as their own section of
+// the output, after a "# name" line (or, in long and json format, which name the
+// reference on every row, one after another). In vcf format there is one header, with a
+// contig line for each reference sequence, followed by the records for all of them
+func Variants(samIn, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSuffix string, out io.Writer, o variants.Options, threads int) error {
 
-	var ref fasta.EncodedRecord
-	if refFromFile {
-		refs, err := fasta.LoadEncodeAlignment(refIn, false, false, false)
-		if err != nil {
-			return err
+	switch o.Format {
+	case "":
+		o.Format = "csv"
+	case "csv", "vcf":
+	case "long", "json":
+		if o.Aggregate {
+			return errors.New("can't aggregate mutations in " + o.Format + " format (choose one of \"csv\" or \"vcf\")")
 		}
-		if len(refs) > 1 {
-			return errors.New("more than one record in --reference")
-		}
-		ref = refs[0]
+	default:
+		return errors.New("couldn't tell which output format to write (choose one of \"csv\", \"vcf\", \"long\" or \"json\")")
 	}
 
-	var cdsregions []variants.Region
-	var intregions []int
-	switch annoSuffix {
-	case "gb":
-		gb, err := genbank.ReadGenBank(annoIn)
-		if err != nil {
-			return err
-		}
-		if !refFromFile {
-			temp := fasta.Record{Seq: string(gb.ORIGIN), ID: "annotation_fasta"}
-			ref, err = temp.Encode()
+	cErr := make(chan error)
+
+	cSR := make(chan samRecords, threads)
+	cSH := make(chan biogosam.Header)
+
+	cReadDone := make(chan bool)
+	cSegmentDone := make(chan bool)
+
+	go groupSamRecords(samIn, cSH, cSR, cReadDone, cErr)
+
+	var header biogosam.Header
+	select {
+	case header = <-cSH:
+	case err := <-cErr:
+		return err
+	}
+
+	names, err := refNames(header)
+	if err != nil {
+		return err
+	}
+
+	annos, err := loadAnnotations(names, refIn, refFromFile, annoIn, annoSuffix)
+	if err != nil {
+		return err
+	}
+
+	ws, bufs, err := segmentWriters(names, out, nil)
+	if err != nil {
+		return err
+	}
+
+	contigs := make([]variants.VCFContig, len(names))
+
+	cSegs := make([]chan samRecords, len(names))
+	for i := range cSegs {
+		cSegs[i] = make(chan samRecords, threads)
+	}
+
+	for i := range names {
+		go func(cSR chan samRecords, w io.Writer, anno segmentAnnotation, header bool, contig *variants.VCFContig) {
+			err := variantsSegment(cSR, w, anno, o, header, contig, threads)
 			if err != nil {
-				return err
+				cErr <- err
+				return
 			}
-			os.Stderr.WriteString("using --annotation fasta as reference\n")
-		}
-		refLenDegapped := len(ref.Decode().Degap().Seq)
-		cdsregions, intregions, err = variants.RegionsFromGenbank(gb, refLenDegapped)
-		if err != nil {
-			return err
-		}
-	case "gff":
-		gff, err := gff.ReadGFF(annoIn)
-		if err != nil {
+			cSegmentDone <- true
+		}(cSegs[i], ws[i], annos[i], i == 0, &contigs[i])
+	}
+
+	go splitSegments(names, cSR, cSegs, cErr)
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
 			return err
+		case <-cReadDone:
+			close(cSR)
+			close(cSH)
+			n--
 		}
-		if !refFromFile {
-			switch len(gff.FASTA) {
-			case 0:
-				return errors.New("couldn't find a reference sequence in the gff and none was provided to --reference")
-			case 1:
-				var encodedrefseq []byte
-				for _, v := range gff.FASTA {
-					encodedrefseq = make([]byte, len(v.Seq))
-					EA := encoding.MakeEncodingArray()
-					for i := range v.Seq {
-						encodedrefseq[i] = EA[v.Seq[i]]
-					}
-					ref = fasta.EncodedRecord{ID: "annotation_fasta", Seq: encodedrefseq}
-				}
-				os.Stderr.WriteString("using --annotation fasta as reference\n")
-			default:
-				return errors.New("more that one sequence in gff ##FASTA section")
-			}
-		}
-		refSeqDegapped := ref.Decode().Degap().Seq
-		cdsregions, intregions, err = variants.RegionsFromGFF(gff, refSeqDegapped)
-		if err != nil {
+	}
+
+	for n := len(names); n > 0; {
+		select {
+		case err := <-cErr:
 			return err
+		case <-cSegmentDone:
+			n--
 		}
 	}
 
+	switch o.Format {
+	case "vcf":
+		return variants.WriteVCFContigs(out, contigs, o.Aggregate, o.Threshold)
+	case "long", "json":
+		return writeSections(out, names, bufs, nil)
+	}
+
+	return writeSections(out, names, bufs, func(name string) string { return "# " + name + "\n" })
+}
+
+// variantsSegment writes the variants in the records against one reference sequence from cSR, until it is closed.
+// In long format, the header row is only written if header is true. In vcf format nothing is written: the variants
+// are collected into contig instead, so that every segment can be written under one header
+func variantsSegment(cSR chan samRecords, out io.Writer, anno segmentAnnotation, o variants.Options, header bool, contig *variants.VCFContig, threads int) error {
+
+	ref := anno.ref
+
 	cErr := make(chan error)
 
 	// do some things that are basically just sam topairalign:
-	cSR := make(chan samRecords, threads)
-	cSH := make(chan biogosam.Header)
 	cPairAlign := make(chan alignPair)
 
 	cVariants := make(chan variants.AnnoStructs)
 
-	cReadDone := make(chan bool)
 	cAlignWaitGroupDone := make(chan bool)
 	cVariantsDone := make(chan bool)
 	cWriteDone := make(chan bool)
 
-	switch aggregate {
-	case true:
-		go variants.AggregateWriteVariants(out, start, end, appendSNP, appendCodons, threshold, ref.ID, cVariants, cWriteDone, cErr)
-	case false:
-		go variants.WriteVariants(out, start, end, false, appendSNP, appendCodons, ref.ID, cVariants, cWriteDone, cErr)
+	switch o.Format {
+	case "csv":
+		switch o.Aggregate {
+		case true:
+			go variants.AggregateWriteVariants(out, o, ref.ID, cVariants, cWriteDone, cErr)
+		case false:
+			go variants.WriteVariants(out, o, false, ref.ID, cVariants, cWriteDone, cErr)
+		}
+	case "vcf":
+		refSeqDegapped := ref.Decode().Degap().Seq
+		go func() {
+			c, err := variants.CollectVCF(o.Start, o.End, ref.ID, refSeqDegapped, cVariants)
+			if err != nil {
+				cErr <- err
+				return
+			}
+			*contig = c
+			cWriteDone <- true
+		}()
+	case "long":
+		go variants.WriteLongVariants(out, o.Start, o.End, false, header, ref.ID, cVariants, cWriteDone, cErr)
+	case "json":
+		go variants.WriteJSONVariants(out, o.Start, o.End, false, ref.ID, cVariants, cWriteDone, cErr)
 	}
 
-	go groupSamRecords(samIn, cSH, cSR, cReadDone, cErr)
-
-	_ = <-cSH
-
 	var wgAlign sync.WaitGroup
 	wgAlign.Add(threads)
 
 	var wgVariants sync.WaitGroup
 	wgVariants.Add(threads)
 
+	refSeq := []byte(ref.Decode().Seq)
+
 	for n := 0; n < threads; n++ {
 		go func() {
-			blockToPairwiseAlignment(cSR, cPairAlign, cErr, []byte(ref.Decode().Seq), false)
+			blockToPairwiseAlignment(cSR, cPairAlign, cErr, refSeq, false)
 			wgAlign.Done()
 		}()
 	}
 
 	for n := 0; n < threads; n++ {
 		go func() {
-			getVariantsSam(cdsregions, intregions, cPairAlign, cVariants, cErr)
+			getVariantsSam(anno.cdsregions, anno.intregions, anno.features, cPairAlign, cVariants, cErr)
 			wgVariants.Done()
 		}()
 	}
@@ -139,17 +195,6 @@ func Variants(samIn, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSu
 		cVariantsDone <- true
 	}()
 
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return err
-		case <-cReadDone:
-			close(cSR)
-			close(cSH)
-			n--
-		}
-	}
-
 	for n := 1; n > 0; {
 		select {
 		case err := <-cErr:
@@ -182,10 +227,168 @@ func Variants(samIn, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSu
 	return nil
 }
 
+// segmentAnnotation is the reference sequence and the annotated regions for one reference sequence in a sam header
+type segmentAnnotation struct {
+	ref        fasta.EncodedRecord
+	cdsregions []variants.Region
+	intregions []int
+	features   []variants.Region
+}
+
+// loadAnnotations reads the reference sequence (from refIn if refFromFile, otherwise from the annotation) and the
+// protein-coding and intergenic regions and non-coding features in the annotation, for each of the reference sequences
+// named in a sam header. If there is only one reference sequence, and only one record in refIn or the annotation, they
+// are assumed to match.
+// Otherwise they are matched by name: refIn by record ID, genbank annotations by LOCUS name, ACCESSION or VERSION,
+// and gff annotations by seqid (and the records in the ##FASTA section by ID).
+func loadAnnotations(names []string, refIn io.Reader, refFromFile bool, annoIn io.Reader, annoSuffix string) ([]segmentAnnotation, error) {
+
+	var refs []fasta.EncodedRecord
+	if refFromFile {
+		var err error
+		refs, err = loadReferences(refIn)
+		if err != nil {
+			return nil, err
+		}
+		if len(refs) == 0 {
+			return nil, errors.New("no records in --reference")
+		}
+	} else {
+		os.Stderr.WriteString("using --annotation fasta as reference\n")
+	}
+
+	// the ID of a reference sequence that comes from the annotation
+	annoID := func(i int) string {
+		if len(names) == 1 {
+			return "annotation_fasta"
+		}
+		return names[i]
+	}
+
+	findRef := func(i int) (fasta.EncodedRecord, error) {
+		if len(names) == 1 && len(refs) == 1 {
+			return refs[0], nil
+		}
+		for _, ref := range refs {
+			if ref.ID == names[i] {
+				return ref, nil
+			}
+		}
+		return fasta.EncodedRecord{}, errors.New("couldn't find reference sequence " + names[i] + " (from the sam header) in --reference")
+	}
+
+	annos := make([]segmentAnnotation, len(names))
+
+	switch annoSuffix {
+	case "gb":
+		gbs, err := genbank.ReadGenBankRecords(annoIn)
+		if err != nil {
+			return nil, err
+		}
+		if len(gbs) == 0 {
+			return nil, errors.New("no records in genbank annotation")
+		}
+		for i, name := range names {
+			var gb genbank.Genbank
+			found := false
+			if len(names) == 1 && len(gbs) == 1 {
+				gb, found = gbs[0], true
+			} else {
+				for _, g := range gbs {
+					if g.LOCUS.Name == name || g.ACCESSION == name || g.VERSION == name {
+						gb, found = g, true
+						break
+					}
+				}
+			}
+			if !found {
+				return nil, errors.New("couldn't find an annotation for reference sequence " + name + " (from the sam header) in --annotation")
+			}
+			var ref fasta.EncodedRecord
+			if refFromFile {
+				ref, err = findRef(i)
+			} else {
+				temp := fasta.Record{Seq: string(gb.ORIGIN), ID: annoID(i)}
+				ref, err = temp.Encode()
+			}
+			if err != nil {
+				return nil, err
+			}
+			refLenDegapped := len(ref.Decode().Degap().Seq)
+			cdsregions, intregions, err := variants.RegionsFromGenbank(gb, refLenDegapped)
+			if err != nil {
+				return nil, err
+			}
+			annos[i] = segmentAnnotation{ref: ref, cdsregions: cdsregions, intregions: intregions, features: variants.FeaturesFromGenbank(gb)}
+		}
+	case "gff":
+		anno, err := gff.ReadGFF(annoIn)
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range names {
+			var ref fasta.EncodedRecord
+			if refFromFile {
+				ref, err = findRef(i)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				var seq string
+				switch {
+				case len(anno.FASTA) == 0:
+					return nil, errors.New("couldn't find a reference sequence in the gff and none was provided to --reference")
+				case len(names) == 1 && len(anno.FASTA) == 1:
+					for _, v := range anno.FASTA {
+						seq = v.Seq
+					}
+				case len(names) == 1:
+					if v, ok := anno.FASTA[name]; ok {
+						seq = v.Seq
+					} else {
+						return nil, errors.New("more that one sequence in gff ##FASTA section")
+					}
+				default:
+					v, ok := anno.FASTA[name]
+					if !ok {
+						return nil, errors.New("couldn't find reference sequence " + name + " (from the sam header) in the gff ##FASTA section")
+					}
+					seq = v.Seq
+				}
+				encodedrefseq := make([]byte, len(seq))
+				EA := encoding.MakeEncodingArray()
+				for j := range seq {
+					encodedrefseq[j] = EA[seq[j]]
+				}
+				ref = fasta.EncodedRecord{ID: annoID(i), Seq: encodedrefseq}
+			}
+			segment := anno
+			if len(names) > 1 {
+				segment.Features = make([]gff.Feature, 0)
+				for _, f := range anno.Features {
+					if f.Seqid == name {
+						segment.Features = append(segment.Features, f)
+					}
+				}
+			}
+			refSeqDegapped := ref.Decode().Degap().Seq
+			cdsregions, intregions, err := variants.RegionsFromGFF(segment, refSeqDegapped)
+			if err != nil {
+				return nil, err
+			}
+			annos[i] = segmentAnnotation{ref: ref, cdsregions: cdsregions, intregions: intregions, features: variants.FeaturesFromGFF(segment)}
+		}
+	default:
+		return nil, errors.New("couldn't tell if the annotation was a .gb or a .gff file")
+	}
+
+	return annos, nil
+}
+
 // getVariantsSam gets the mutations for each pairwise alignment from a channel
 // at a time, and passes them to a channel of annotated variants, given an array
 // of annotated genome regions
-func getVariantsSam(cdsregions []variants.Region, intregions []int, cAlignPair chan alignPair, cVariants chan variants.AnnoStructs, cErr chan error) {
+func getVariantsSam(cdsregions []variants.Region, intregions []int, features []variants.Region, cAlignPair chan alignPair, cVariants chan variants.AnnoStructs, cErr chan error) {
 
 	EA := encoding.MakeEncodingArray()
 
@@ -206,6 +409,7 @@ func getVariantsSam(cdsregions []variants.Region, intregions []int, cAlignPair c
 			cErr <- err
 			break
 		}
+		variants.NameFeatures(AS.Vs, features)
 
 		// and we're done
 		cVariants <- AS
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+
+	"github.com/virus-evolution/gofasta/pkg/variants"
 )
 
 func TestVariants(t *testing.T) {
@@ -28,7 +30,7 @@ aa:ORF7a:A8K	0	MN908947.3	1	60	29903M	*	0	0	ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAAC
 
 	out := new(bytes.Buffer)
 
-	err := Variants(sam, ref, true, genbank, "gb", out, -1, -1, false, 0.0, false, 1)
+	err := Variants(sam, ref, true, genbank, "gb", out, variants.Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -48,7 +50,7 @@ aa:ORF7a:A8K,aa:ORF7a:A8K
 
 	out = new(bytes.Buffer)
 
-	err = Variants(sam, ref, false, genbank, "gb", out, -1, -1, false, 0.0, false, 1)
+	err = Variants(sam, ref, false, genbank, "gb", out, variants.Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -69,7 +71,7 @@ aa:ORF7a:A8K,aa:ORF7a:A8K
 
 	out = new(bytes.Buffer)
 
-	err = Variants(sam, ref, true, gff, "gff", out, -1, -1, false, 0.0, false, 1)
+	err = Variants(sam, ref, true, gff, "gff", out, variants.Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -89,7 +91,7 @@ aa:ORF7a:A8K,aa:ORF7a:A8K
 
 	out = new(bytes.Buffer)
 
-	err = Variants(sam, ref, false, gff, "gff", out, -1, -1, false, 0.0, false, 1)
+	err = Variants(sam, ref, false, gff, "gff", out, variants.Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -127,7 +129,7 @@ aa:ORF7a:A8K	0	MN908947.3	1	60	29903M	*	0	0	ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAAC
 
 	out := new(bytes.Buffer)
 
-	err := Variants(sam, ref, true, genbank, "gb", out, -1, -1, false, 0.0, true, 1)
+	err := Variants(sam, ref, true, genbank, "gb", out, variants.Options{AppendSNP: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -167,7 +169,7 @@ aa:ORF7a:A8K3	0	MN908947.3	1	60	29903M	*	0	0	ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(sam, ref, true, genbank, "gb", out, -1, -1, true, 0.0, false, 1)
+	err := Variants(sam, ref, true, genbank, "gb", out, variants.Options{Aggregate: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -207,7 +209,7 @@ aa:ORF7a:A8K3	0	MN908947.3	1	60	29903M	*	0	0	ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(sam, ref, true, genbank, "gb", out, -1, -1, true, 0.0, true, 1)
+	err := Variants(sam, ref, true, genbank, "gb", out, variants.Options{Aggregate: true, AppendSNP: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -247,7 +249,7 @@ aa:ORF7a:A8K3	0	MN908947.3	1	60	29903M	*	0	0	ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(sam, ref, true, genbank, "gb", out, -1, -1, true, 0.5, false, 1)
+	err := Variants(sam, ref, true, genbank, "gb", out, variants.Options{Aggregate: true, Threshold: 0.5}, 1)
 	if err != nil {
 		t.Error(err)
 	}
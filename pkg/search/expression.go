@@ -0,0 +1,324 @@
+package search
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+// The status of a mutation in a query, or the result of an expression (present is true and absent is false)
+const (
+	Present = "present"
+	Absent  = "absent"
+	Unknown = "unknown" // the query has missing data (an ambiguous base or an N) where the mutation would be
+)
+
+// A node is part of a parsed expression, which evaluates to Present, Absent or Unknown given the status of each
+// of the mutations in it
+type node interface {
+	eval(statuses []string) string
+}
+
+// a mutation in an expression, by its index in Query.Mutations
+type mutationNode int
+
+func (n mutationNode) eval(statuses []string) string {
+	return statuses[n]
+}
+
+type notNode struct {
+	x node
+}
+
+func (n notNode) eval(statuses []string) string {
+	switch n.x.eval(statuses) {
+	case Present:
+		return Absent
+	case Absent:
+		return Present
+	default:
+		return Unknown
+	}
+}
+
+// andNode and orNode follow three-valued logic: an unknown operand only makes the result unknown if the other
+// operand doesn't decide it
+type andNode struct {
+	x, y node
+}
+
+func (n andNode) eval(statuses []string) string {
+	x, y := n.x.eval(statuses), n.y.eval(statuses)
+	switch {
+	case x == Absent || y == Absent:
+		return Absent
+	case x == Present && y == Present:
+		return Present
+	default:
+		return Unknown
+	}
+}
+
+type orNode struct {
+	x, y node
+}
+
+func (n orNode) eval(statuses []string) string {
+	x, y := n.x.eval(statuses), n.y.eval(statuses)
+	switch {
+	case x == Present || y == Present:
+		return Present
+	case x == Absent && y == Absent:
+		return Absent
+	default:
+		return Unknown
+	}
+}
+
+// A Query is a parsed search expression, and the mutations in it (in the order that they first appear), with the
+// reference positions that each one depends on
+type Query struct {
+	Mutations []string
+	positions [][]int // (1-based) reference positions at which missing data makes each mutation unknown
+	root      node
+}
+
+// tokenize splits a search expression into mutations, operators and parentheses
+func tokenize(expr string) []string {
+	tokens := make([]string, 0)
+	current := ""
+	flush := func() {
+		if current != "" {
+			tokens = append(tokens, current)
+			current = ""
+		}
+	}
+	for _, r := range expr {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case strings.ContainsRune("()&|!,", r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			current = current + string(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parser is a recursive descent parser for search expressions:
+//
+//	expr   = and { ("|" | "or") and }
+//	and    = unary { ("&" | "and" | ",") unary }
+//	unary  = ("!" | "not") unary | "(" expr ")" | mutation
+type parser struct {
+	tokens    []string
+	i         int
+	mutations map[string]int
+	order     []string
+}
+
+func (p *parser) peek() string {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.i++
+	return t
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t == "|" || strings.EqualFold(t, "or"); t = p.peek() {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = orNode{x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t == "&" || t == "," || strings.EqualFold(t, "and"); t = p.peek() {
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = andNode{x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of search expression")
+	case t == "!" || strings.EqualFold(t, "not"):
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x: x}, nil
+	case t == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing ) in search expression")
+		}
+		return x, nil
+	case t == ")" || t == "&" || t == "|" || t == "," || strings.EqualFold(t, "and") || strings.EqualFold(t, "or"):
+		return nil, errors.New("unexpected " + t + " in search expression")
+	default:
+		if _, ok := p.mutations[t]; !ok {
+			p.mutations[t] = len(p.order)
+			p.order = append(p.order, t)
+		}
+		return mutationNode(p.mutations[t]), nil
+	}
+}
+
+var (
+	nucRegex   = regexp.MustCompile(`^nuc:([A-Z])([0-9]+)([A-Z])$`)
+	indelRegex = regexp.MustCompile(`^(ins|del):([0-9]+):([0-9]+)$`)
+	aaDelRegex = regexp.MustCompile(`^aa:(.+):del([0-9]+)(?:-([0-9]+))?$`)
+	aaInsRegex = regexp.MustCompile(`^aa:(.+):ins([0-9]+)([A-Z*]+)$`)
+	aaRegex    = regexp.MustCompile(`^aa:(.+):([A-Z*])([0-9]+)([A-Z*])$`)
+)
+
+// codonPositions returns the reference positions of residues first to last (1-based, inclusive) of the region
+// called feature in cdsregions
+func codonPositions(feature string, first, last int, cdsregions []variants.Region) ([]int, error) {
+	for _, r := range cdsregions {
+		if r.Name != feature {
+			continue
+		}
+		if first < 1 || last*3 > len(r.Positions) {
+			return nil, errors.New("residue out of range for " + feature + ": " + strconv.Itoa(last))
+		}
+		return r.Positions[(first-1)*3 : last*3], nil
+	}
+	return nil, errors.New("couldn't find a coding region called " + feature + " in the annotation")
+}
+
+// mutationPositions checks that m is a mutation in the notation that variants.FormatVariant produces, and returns
+// the (1-based) reference positions that it depends on
+func mutationPositions(m string, cdsregions []variants.Region, refLen int) ([]int, error) {
+
+	inRange := func(ps []int) ([]int, error) {
+		for _, p := range ps {
+			if p < 1 || p > refLen {
+				return nil, errors.New("position out of range in " + m + ": " + strconv.Itoa(p))
+			}
+		}
+		return ps, nil
+	}
+
+	if s := nucRegex.FindStringSubmatch(m); s != nil {
+		pos, _ := strconv.Atoi(s[2])
+		return inRange([]int{pos})
+	}
+
+	if s := indelRegex.FindStringSubmatch(m); s != nil {
+		pos, _ := strconv.Atoi(s[2])
+		length, _ := strconv.Atoi(s[3])
+		if length < 1 {
+			return nil, errors.New("bad length in " + m)
+		}
+		// an insertion is between pos and the next base
+		if s[1] == "ins" {
+			if pos == refLen {
+				return inRange([]int{pos})
+			}
+			return inRange([]int{pos, pos + 1})
+		}
+		ps := make([]int, length)
+		for i := range ps {
+			ps[i] = pos + i
+		}
+		return inRange(ps)
+	}
+
+	if s := aaDelRegex.FindStringSubmatch(m); s != nil {
+		first, _ := strconv.Atoi(s[2])
+		last := first
+		if s[3] != "" {
+			last, _ = strconv.Atoi(s[3])
+		}
+		if last < first {
+			return nil, errors.New("bad residue range in " + m)
+		}
+		return codonPositions(s[1], first, last, cdsregions)
+	}
+
+	if s := aaInsRegex.FindStringSubmatch(m); s != nil {
+		after, _ := strconv.Atoi(s[2])
+		ps, err := codonPositions(s[1], after, after, cdsregions)
+		if err != nil {
+			return nil, err
+		}
+		// the residue after the insertion, if there is one
+		if next, err := codonPositions(s[1], after+1, after+1, cdsregions); err == nil {
+			ps = append(append([]int{}, ps...), next...)
+		}
+		return ps, nil
+	}
+
+	if s := aaRegex.FindStringSubmatch(m); s != nil {
+		residue, _ := strconv.Atoi(s[3])
+		return codonPositions(s[1], residue, residue, cdsregions)
+	}
+
+	return nil, errors.New("couldn't parse mutation: " + m + " (mutations are written as nuc:C241T, aa:S:E484K, aa:S:del69-70, aa:S:ins214EPE, ins:22204:9 or del:21765:6)")
+}
+
+// ParseQuery parses a search expression of mutations joined by "&" (or "and", or ","), "|" (or "or") and "!" (or
+// "not"), with parentheses for grouping. Each mutation is written as variants.FormatVariant writes it (without
+// anything appended), and is checked against the annotation's coding regions and the length of the reference
+func ParseQuery(expr string, cdsregions []variants.Region, refLen int) (Query, error) {
+
+	p := &parser{tokens: tokenize(expr), mutations: make(map[string]int), order: make([]string, 0)}
+	if len(p.tokens) == 0 {
+		return Query{}, errors.New("empty search expression")
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+	if p.i < len(p.tokens) {
+		return Query{}, errors.New("unexpected " + p.peek() + " in search expression")
+	}
+
+	positions := make([][]int, len(p.order))
+	for i, m := range p.order {
+		positions[i], err = mutationPositions(m, cdsregions, refLen)
+		if err != nil {
+			return Query{}, err
+		}
+	}
+
+	return Query{Mutations: p.order, positions: positions, root: root}, nil
+}
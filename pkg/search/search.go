@@ -0,0 +1,222 @@
+/*
+Package search implements functionality to find the sequences in an alignment that carry
+combinations of mutations relative to a reference sequence, using the annotation in
+package variants.
+*/
+package search
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+// A Result is the status of each of a Query's mutations in one query sequence, and the result of its expression,
+// with an index which is used to retain input order in the output
+type Result struct {
+	Queryname string
+	Statuses  []string
+	Match     string
+	Idx       int
+}
+
+// mutationSet returns the string representation of each mutation in vs, and of each nucleotide change or indel
+// that underlies an amino acid change
+func mutationSet(vs []variants.Variant) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for _, v := range vs {
+		s, err := variants.FormatVariant(v, variants.Options{})
+		if err != nil {
+			return nil, err
+		}
+		set[s] = true
+		if v.SNPs != "" {
+			for _, snp := range strings.Split(v.SNPs, ";") {
+				set[snp] = true
+			}
+		}
+	}
+	return set, nil
+}
+
+// Evaluate returns the status of each of q's mutations in a query sequence (given its variants, from
+// variants.GetVariantsPair) and the result of q's expression. A mutation that isn't one of the query's variants
+// is unknown if the query has missing data (see variants.AnnoStructs) at any of the positions that it depends
+// on, otherwise it is absent
+func (q Query) Evaluate(AS variants.AnnoStructs) (Result, error) {
+
+	set, err := mutationSet(AS.Vs)
+	if err != nil {
+		return Result{}, err
+	}
+
+	statuses := make([]string, len(q.Mutations))
+	for i, m := range q.Mutations {
+		if set[m] {
+			statuses[i] = Present
+			continue
+		}
+		statuses[i] = Absent
+		for _, pos := range q.positions[i] {
+			if variants.IsMissing(AS.Missing, pos, pos) {
+				statuses[i] = Unknown
+				break
+			}
+		}
+	}
+
+	return Result{Queryname: AS.Queryname, Statuses: statuses, Match: q.root.eval(statuses), Idx: AS.Idx}, nil
+}
+
+// Search finds the sequences in a multiple sequence alignment in fasta format that match a search expression of
+// mutations relative to a reference sequence (see ParseQuery), and writes them with the status of each mutation.
+// Genome annotations are derived from an annotation file in genbank or gff version 3 format. If all is true,
+// every sequence is written, whether or not it matches
+func Search(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoSuffix string, expr string, out io.Writer, all bool, threads int) error {
+
+	a, err := variants.StreamAnnotatedMSA(msaIn, stdin, refID, annoIn, annoSuffix, threads)
+	if err != nil {
+		return err
+	}
+
+	q, err := ParseQuery(expr, a.CDSRegions, len(a.RefToMSA))
+	if err != nil {
+		return err
+	}
+
+	cResults := make(chan Result, 50+threads)
+	cResultsDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go WriteResults(out, q, all, a.FirstMissing, a.Ref.ID, cResults, cWriteDone, a.Err)
+
+	var wgSearch sync.WaitGroup
+	wgSearch.Add(threads)
+
+	for n := 0; n < threads; n++ {
+		go func() {
+			searchMSA(q, a, cResults)
+			wgSearch.Done()
+		}()
+	}
+
+	go func() {
+		wgSearch.Wait()
+		cResultsDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-a.Err:
+			return err
+		case <-a.Done:
+			close(a.Records)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-a.Err:
+			return err
+		case <-cResultsDone:
+			close(cResults)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-a.Err:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
+
+// searchMSA evaluates q for each record in a's alignment, until it is closed
+func searchMSA(q Query, a variants.AnnotatedMSA, cResults chan Result) {
+
+	for record := range a.Records {
+
+		if len(record.Seq) != len(a.MSAToRef) {
+			a.Err <- errors.New("Gapped reference sequence and alignment are not the same width")
+			break
+		}
+
+		AS, err := variants.GetVariantsPair(a.Ref.Seq, record.Seq, a.Ref.ID, record.ID, record.Idx, a.CDSRegions, a.IntRegions, a.RefToMSA, a.MSAToRef)
+		if err != nil {
+			a.Err <- err
+			break
+		}
+
+		r, err := q.Evaluate(AS)
+		if err != nil {
+			a.Err <- err
+			break
+		}
+
+		cResults <- r
+	}
+}
+
+// WriteResults writes the query sequences that match q (or all of them, if all is true) to file or stdout in csv
+// format, in input order, with the result of q's expression and the status of each of its mutations
+func WriteResults(w io.Writer, q Query, all bool, firstmissing bool, refID string, cResults chan Result, cWriteDone chan bool, cErr chan error) {
+
+	outputMap := make(map[int]Result)
+
+	counter := 0
+	if firstmissing {
+		counter = 1
+	}
+
+	_, err := w.Write([]byte("query,match," + strings.Join(q.Mutations, ",") + "\n"))
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	for result := range cResults {
+		outputMap[result.Idx] = result
+
+		for {
+			r, ok := outputMap[counter]
+			if !ok {
+				break
+			}
+			delete(outputMap, counter)
+			counter++
+
+			if r.Queryname == refID || (!all && r.Match != Present) {
+				continue
+			}
+
+			_, err = w.Write([]byte(r.Queryname + "," + matchString(r.Match) + "," + strings.Join(r.Statuses, ",") + "\n"))
+			if err != nil {
+				cErr <- err
+				return
+			}
+		}
+	}
+
+	cWriteDone <- true
+}
+
+// matchString returns the result of an expression as true, false or unknown
+func matchString(match string) string {
+	switch match {
+	case Present:
+		return "true"
+	case Absent:
+		return "false"
+	default:
+		return Unknown
+	}
+}
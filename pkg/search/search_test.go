@@ -0,0 +1,164 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/virus-evolution/gofasta/pkg/gff"
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+var gffData = []byte(`##gff-version 3
+reference	.	CDS	6	17	.	+	0	ID=cds-gene1;Name=gene1
+##FASTA
+>reference
+ACGTAATGATGATGTAGAAAAAA
+`)
+
+var msaData = []byte(`>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq1
+ATGTATTGATGATGTAG-AAAATA
+>seq2
+ACGTA---ATGATGTAG-AAAAAA
+>seq3
+ACGTAATGATGATGTAGCAAAAAA
+>seq4
+NNGTANTGATGATGTAG-AAAAAA
+>seq5
+ACGTAATGAAGATGTAG-AAAAAA
+`)
+
+func TestSearch(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := Search(bytes.NewReader(msaData), false, "reference", bytes.NewReader(gffData), "gff", "aa:gene1:M1L | aa:gene1:del1", out, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `query,match,aa:gene1:M1L,aa:gene1:del1
+seq1,true,present,absent
+seq2,true,absent,present
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSearch")
+		t.Error(out.String())
+	}
+
+	// a nucleotide change is found when it underlies an amino acid change, and missing data makes a mutation unknown
+	out = new(bytes.Buffer)
+	err = Search(bytes.NewReader(msaData), false, "reference", bytes.NewReader(gffData), "gff", "nuc:A6T, not nuc:C2T", out, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `query,match,nuc:A6T,nuc:C2T
+seq1,false,present,present
+seq2,false,absent,absent
+seq3,false,absent,absent
+seq4,unknown,unknown,unknown
+seq5,false,absent,absent
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSearch (--all)")
+		t.Error(out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = Search(bytes.NewReader(msaData), false, "reference", bytes.NewReader(gffData), "gff", "ins:17:1 | (aa:gene1:M2K & !del:6:3)", out, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult = `query,match,ins:17:1,aa:gene1:M2K,del:6:3
+seq1,false,absent,absent,absent
+seq2,false,absent,absent,present
+seq3,true,present,absent,absent
+seq4,false,absent,absent,unknown
+seq5,true,absent,present,absent
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSearch (expression)")
+		t.Error(out.String())
+	}
+}
+
+// gaps at the ends of a sequence (as sam toma pads sequences to the length of the reference with) are missing data,
+// but a deletion inside it isn't
+func TestSearchEndGaps(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq1
+---TAATGATGATGTAG-AAA---
+>seq2
+A-GTAATGATGATGTAG-AAA-AA
+`)
+
+	out := new(bytes.Buffer)
+	err := Search(bytes.NewReader(msaData), false, "reference", bytes.NewReader(gffData), "gff", "nuc:C2T | nuc:A22T", out, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desiredResult := `query,match,nuc:C2T,nuc:A22T
+seq1,unknown,unknown,unknown
+seq2,false,absent,absent
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestSearchEndGaps")
+		t.Error(out.String())
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	GFF, err := gff.ReadGFF(bytes.NewReader(gffData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdsregions, _, err := variants.RegionsFromGFF(GFF, "ACGTAATGATGATGTAGAAAAAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := ParseQuery("aa:gene1:M1L & (nuc:C2T | !aa:gene1:ins1MM) , aa:gene1:M1L", cdsregions, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Mutations) != 3 || q.Mutations[0] != "aa:gene1:M1L" || q.Mutations[1] != "nuc:C2T" || q.Mutations[2] != "aa:gene1:ins1MM" {
+		t.Errorf("problem in TestParseQuery")
+		t.Error(q.Mutations)
+	}
+	if len(q.positions[2]) != 6 || q.positions[2][0] != 6 || q.positions[2][5] != 11 {
+		t.Errorf("problem in TestParseQuery (positions)")
+		t.Error(q.positions)
+	}
+
+	statuses := [][]string{
+		{Present, Absent, Absent},
+		{Present, Unknown, Absent},
+		{Present, Unknown, Present},
+		{Unknown, Present, Present},
+		{Absent, Unknown, Unknown},
+	}
+	desiredResults := []string{Present, Present, Unknown, Unknown, Absent}
+	for i := range statuses {
+		if r := q.root.eval(statuses[i]); r != desiredResults[i] {
+			t.Errorf("problem in TestParseQuery (eval %d): got %s, expected %s", i, r, desiredResults[i])
+		}
+	}
+
+	bad := []string{
+		"",
+		"aa:gene1:M1L &",
+		"(aa:gene1:M1L",
+		"aa:gene1:M1L)",
+		"aa:gene2:M1L",
+		"aa:gene1:M5L",
+		"nuc:C2",
+		"nuc:C30T",
+		"del:20:5",
+		"aa:gene1:del3-2",
+	}
+	for _, expr := range bad {
+		_, err := ParseQuery(expr, cdsregions, 23)
+		if err == nil {
+			t.Errorf("problem in TestParseQuery: expected an error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+/*
+Package stats implements functions to summarise the sequences and the columns of a fasta format
+alignment, for quality control.
+*/
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// seqStats is the summary of one sequence in the alignment. The counts relative to the reference
+// are only filled in if there is one
+type seqStats struct {
+	Query         string `json:"query"`
+	Length        int    `json:"length"`
+	A             int    `json:"A"`
+	C             int    `json:"C"`
+	G             int    `json:"G"`
+	T             int    `json:"T"`
+	N             int    `json:"N"`
+	Gaps          int    `json:"gaps"`
+	Ambiguous     int    `json:"ambiguous"`
+	Het           int    `json:"het"`
+	LargestNTract int    `json:"largest_N_tract"`
+	Score         int64  `json:"score"`
+	SNPs          *int   `json:"SNPs,omitempty"`
+	Insertions    *int   `json:"insertions,omitempty"`
+	Deletions     *int   `json:"deletions,omitempty"`
+	idx           int
+	hasRef        bool
+}
+
+// column is the count of each kind of character in one column of the alignment
+type column struct {
+	A, C, G, T, N, Gaps, Ambiguous int
+}
+
+// isHet is true for the IUPAC codes that represent exactly two bases (R, Y, S, W, K and M), i.e. the
+// codes that are used for heterozygous sites
+func isHet(nuc byte) bool {
+	switch nuc {
+	case 192, 160, 144, 96, 80, 48:
+		return true
+	}
+	return false
+}
+
+// count adds one encoded nucleotide to the counts for a column
+func (c *column) count(nuc byte) {
+	switch nuc {
+	case 136:
+		c.A++
+	case 40:
+		c.C++
+	case 72:
+		c.G++
+	case 24:
+		c.T++
+	case 240, 242:
+		c.N++
+	case 244:
+		c.Gaps++
+	default:
+		c.Ambiguous++
+	}
+}
+
+// getStats summarises one record, optionally relative to a reference sequence (which must be the same width)
+func getStats(EFR fasta.EncodedRecord, ref []byte) seqStats {
+	s := seqStats{Query: EFR.ID, idx: EFR.Idx, A: EFR.Count_A, C: EFR.Count_C, G: EFR.Count_G, T: EFR.Count_T, Score: EFR.Score}
+
+	tract := 0
+	for _, nuc := range EFR.Seq {
+		switch nuc {
+		case 136, 40, 72, 24:
+		case 240, 242:
+			s.N++
+		case 244:
+			s.Gaps++
+		default:
+			s.Ambiguous++
+			if isHet(nuc) {
+				s.Het++
+			}
+		}
+		if nuc == 240 || nuc == 242 {
+			tract++
+			if tract > s.LargestNTract {
+				s.LargestNTract = tract
+			}
+		} else {
+			tract = 0
+		}
+	}
+	s.Length = len(EFR.Seq) - s.Gaps
+
+	if ref != nil {
+		s.hasRef = true
+		snps, ins, del := compare(ref, EFR.Seq)
+		s.SNPs, s.Insertions, s.Deletions = &snps, &ins, &del
+	}
+
+	return s
+}
+
+// compare counts the SNPs between ref and query, in the same way as gofasta snps does, and the number
+// of insertions and deletions in query relative to ref, in the same way as gofasta variants does (i.e.
+// gaps at either end of the query are missing data, not deletions)
+func compare(ref, query []byte) (snps, insertions, deletions int) {
+	insOpen, delOpen := false, false
+	delStart := 0
+	for i := range ref {
+		if ref[i] == 244 {
+			if query[i] != 244 && !insOpen {
+				insertions++
+				insOpen = true
+			}
+			continue
+		}
+		insOpen = false
+		if query[i] == 244 {
+			if !delOpen {
+				delOpen = true
+				delStart = i
+			}
+			continue
+		}
+		if delOpen {
+			if delStart != 0 {
+				deletions++
+			}
+			delOpen = false
+		}
+		if ref[i]&query[i] < 16 {
+			snps++
+		}
+	}
+	return snps, insertions, deletions
+}
+
+// csvFields returns one row of csv output for a sequence
+func (s seqStats) csvFields() string {
+	line := s.Query + "," + strconv.Itoa(s.Length) + "," + strconv.Itoa(s.A) + "," + strconv.Itoa(s.C) + "," + strconv.Itoa(s.G) + "," + strconv.Itoa(s.T) +
+		"," + strconv.Itoa(s.N) + "," + strconv.Itoa(s.Gaps) + "," + strconv.Itoa(s.Ambiguous) + "," + strconv.Itoa(s.Het) + "," + strconv.Itoa(s.LargestNTract) +
+		"," + strconv.FormatInt(s.Score, 10)
+	if s.hasRef {
+		line += "," + strconv.Itoa(*s.SNPs) + "," + strconv.Itoa(*s.Insertions) + "," + strconv.Itoa(*s.Deletions)
+	}
+	return line + "\n"
+}
+
+// seqHeader returns the header of the csv output for the sequences
+func seqHeader(hasRef bool) string {
+	header := "query,length,A,C,G,T,N,gaps,ambiguous,het,largest_N_tract,score"
+	if hasRef {
+		header += ",SNPs,insertions,deletions"
+	}
+	return header + "\n"
+}
+
+// writeStats writes the summary of each sequence in the same order as the input, in csv format or as a json array
+func writeStats(w io.Writer, format string, hasRef bool, cStats chan seqStats, cErr chan error, cWriteDone chan bool) {
+
+	outputMap := make(map[int]seqStats)
+	counter := 0
+
+	var err error
+	switch format {
+	case "csv":
+		_, err = w.Write([]byte(seqHeader(hasRef)))
+	case "json":
+		_, err = w.Write([]byte("["))
+	}
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	for s := range cStats {
+		outputMap[s.idx] = s
+		for {
+			if s, ok := outputMap[counter]; ok {
+				var b []byte
+				switch format {
+				case "csv":
+					b = []byte(s.csvFields())
+				case "json":
+					b, err = json.Marshal(s)
+					if err != nil {
+						cErr <- err
+						return
+					}
+					if counter > 0 {
+						b = append([]byte(",\n"), b...)
+					}
+				}
+				_, err = w.Write(b)
+				if err != nil {
+					cErr <- err
+					return
+				}
+				delete(outputMap, counter)
+				counter++
+			} else {
+				break
+			}
+		}
+	}
+
+	if format == "json" {
+		_, err = w.Write([]byte("]\n"))
+		if err != nil {
+			cErr <- err
+			return
+		}
+	}
+
+	cWriteDone <- true
+}
+
+// writeColumns writes the summary of each column in the alignment
+func writeColumns(w io.Writer, format string, columns []column) error {
+	type jsonColumn struct {
+		Position  int `json:"position"`
+		A         int `json:"A"`
+		C         int `json:"C"`
+		G         int `json:"G"`
+		T         int `json:"T"`
+		N         int `json:"N"`
+		Gaps      int `json:"gaps"`
+		Ambiguous int `json:"ambiguous"`
+	}
+
+	switch format {
+	case "csv":
+		_, err := w.Write([]byte("position,A,C,G,T,N,gaps,ambiguous\n"))
+		if err != nil {
+			return err
+		}
+		for i, c := range columns {
+			_, err = w.Write([]byte(strconv.Itoa(i+1) + "," + strconv.Itoa(c.A) + "," + strconv.Itoa(c.C) + "," + strconv.Itoa(c.G) + "," + strconv.Itoa(c.T) +
+				"," + strconv.Itoa(c.N) + "," + strconv.Itoa(c.Gaps) + "," + strconv.Itoa(c.Ambiguous) + "\n"))
+			if err != nil {
+				return err
+			}
+		}
+	case "json":
+		jc := make([]jsonColumn, len(columns))
+		for i, c := range columns {
+			jc[i] = jsonColumn{Position: i + 1, A: c.A, C: c.C, G: c.G, T: c.T, N: c.N, Gaps: c.Gaps, Ambiguous: c.Ambiguous}
+		}
+		b, err := json.Marshal(jc)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stats writes a summary of each sequence in msaIn to out, in csv or json format: its ungapped length, base
+// composition, the number of Ns, gaps, ambiguity codes and (two-base) heterozygous sites, its longest run
+// of Ns, and its completeness score. If ref is not nil, it must be a single sequence of the same width as the
+// alignment, and the number of SNPs, insertions and deletions relative to it are written too. If columnsOut is
+// not nil, a summary of the contents of each column of the alignment is written to it in the same format.
+func Stats(msaIn io.Reader, ref io.Reader, format string, out io.Writer, columnsOut io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	var refSeq []byte
+	if ref != nil {
+		refs, err := fasta.LoadEncodeAlignment(ref, false, false, false)
+		if err != nil {
+			return err
+		}
+		if len(refs) > 1 {
+			return errors.New("more than one record in --reference")
+		}
+		refSeq = refs[0].Seq
+	}
+
+	cErr := make(chan error)
+
+	cEFR := make(chan fasta.EncodedRecord, threads)
+	cEFRDone := make(chan bool)
+
+	cStats := make(chan seqStats, threads)
+	cWriteDone := make(chan bool)
+	cWaitGroupDone := make(chan bool)
+
+	go fasta.StreamEncodeAlignment(msaIn, cEFR, cErr, cEFRDone, false, true, true)
+
+	go writeStats(out, format, refSeq != nil, cStats, cErr, cWriteDone)
+
+	// each thread counts the columns of the sequences it sees, and these are summed at the end
+	columns := make([][]column, threads)
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func(n int) {
+			for EFR := range cEFR {
+				if refSeq != nil && len(EFR.Seq) != len(refSeq) {
+					cErr <- errors.New("reference sequence (" + strconv.Itoa(len(refSeq)) + " bases) and " + EFR.ID + " (" + strconv.Itoa(len(EFR.Seq)) + " bases) are different lengths")
+					break
+				}
+				if columnsOut != nil {
+					if columns[n] == nil {
+						columns[n] = make([]column, len(EFR.Seq))
+					}
+					for i, nuc := range EFR.Seq {
+						columns[n][i].count(nuc)
+					}
+				}
+				cStats <- getStats(EFR, refSeq)
+			}
+			wg.Done()
+		}(n)
+	}
+
+	go func() {
+		wg.Wait()
+		cWaitGroupDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cEFRDone:
+			close(cEFR)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWaitGroupDone:
+			close(cStats)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	if columnsOut != nil {
+		var total []column
+		for _, cols := range columns {
+			if cols == nil {
+				continue
+			}
+			if total == nil {
+				total = make([]column, len(cols))
+			}
+			for i := range cols {
+				total[i].A += cols[i].A
+				total[i].C += cols[i].C
+				total[i].G += cols[i].G
+				total[i].T += cols[i].T
+				total[i].N += cols[i].N
+				total[i].Gaps += cols[i].Gaps
+				total[i].Ambiguous += cols[i].Ambiguous
+			}
+		}
+		return writeColumns(columnsOut, format, total)
+	}
+
+	return nil
+}
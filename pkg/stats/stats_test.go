@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"bytes"
+	"testing"
+)
+
+var msaData = []byte(`>seq1
+ATGATGATGA
+>seq2
+NNGA--ATRA
+>seq3
+ATGATCANNN
+`)
+
+func TestStats(t *testing.T) {
+	out := new(bytes.Buffer)
+	columns := new(bytes.Buffer)
+	err := Stats(bytes.NewReader(msaData), nil, "csv", out, columns, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `query,length,A,C,G,T,N,gaps,ambiguous,het,largest_N_tract,score
+seq1,10,4,0,3,3,0,0,0,0,0,120
+seq2,8,3,0,1,1,2,2,1,1,2,78
+seq3,10,3,1,1,2,3,0,0,0,3,93
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestStats")
+		t.Error(out.String())
+	}
+
+	desiredColumns := `position,A,C,G,T,N,gaps,ambiguous
+1,2,0,0,0,1,0,0
+2,0,0,0,2,1,0,0
+3,0,0,3,0,0,0,0
+4,3,0,0,0,0,0,0
+5,0,0,0,2,0,1,0
+6,0,1,1,0,0,1,0
+7,3,0,0,0,0,0,0
+8,0,0,0,2,1,0,0
+9,0,0,1,0,1,0,1
+10,2,0,0,0,1,0,0
+`
+	if columns.String() != desiredColumns {
+		t.Errorf("problem in TestStats (columns)")
+		t.Error(columns.String())
+	}
+}
+
+func TestStatsReference(t *testing.T) {
+	refData := []byte(`>ref
+ATGAT-GATGA
+`)
+	msaData := []byte(`>seq1
+--GATCGATGA
+>seq2
+ATG--CGAKGT
+>seq3
+ATGAT-G--GA
+`)
+
+	out := new(bytes.Buffer)
+	err := Stats(bytes.NewReader(msaData), bytes.NewReader(refData), "json", out, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `[{"query":"seq1","length":9,"A":3,"C":1,"G":3,"T":2,"N":0,"gaps":2,"ambiguous":0,"het":0,"largest_N_tract":0,"score":114,"SNPs":0,"insertions":1,"deletions":0},
+{"query":"seq2","length":9,"A":2,"C":1,"G":3,"T":2,"N":0,"gaps":2,"ambiguous":1,"het":1,"largest_N_tract":0,"score":108,"SNPs":1,"insertions":1,"deletions":1},
+{"query":"seq3","length":8,"A":3,"C":0,"G":3,"T":2,"N":0,"gaps":3,"ambiguous":0,"het":0,"largest_N_tract":0,"score":105,"SNPs":0,"insertions":0,"deletions":1}]
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestStatsReference")
+		t.Error(out.String())
+	}
+
+	err = Stats(bytes.NewReader(msaData), bytes.NewReader([]byte(">ref\nATG\n")), "csv", new(bytes.Buffer), nil, 1)
+	if err == nil {
+		t.Errorf("expected an error for a reference of a different width")
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Package translate implements functions to translate the protein-coding regions of every sequence in a
+multiple sequence alignment in fasta format, to make protein alignments.
+*/
+package translate
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/virus-evolution/gofasta/pkg/alphabet"
+	"github.com/virus-evolution/gofasta/pkg/encoding"
+	"github.com/virus-evolution/gofasta/pkg/extract"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+	"github.com/virus-evolution/gofasta/pkg/gfio"
+	"github.com/virus-evolution/gofasta/pkg/variants"
+)
+
+// translateRegion translates one protein-coding region of a record, in the same way as gofasta variants
+// calls amino acid changes: codons are read at the region's positions in reference coordinates (so insertions
+// relative to the reference are skipped, and the reading frame is the reference's), codons that are all gaps
+// are translated as "-", and codons that can't be resolved to one amino acid (including partly-gapped ones)
+// as "X"
+func translateRegion(seq []byte, region variants.Region, refToMSA []int, DA [256]string, CD map[string]string) string {
+	var sb strings.Builder
+	sb.Grow(len(region.Positions) / 3)
+	codon := ""
+	for _, refPos := range region.Positions {
+		codon = codon + DA[seq[(refPos-1)+refToMSA[refPos-1]]]
+		if len(codon) == 3 {
+			if region.Strand == -1 {
+				codon = alphabet.Complement(codon)
+			}
+			if codon == "---" {
+				sb.WriteString("-")
+			} else if aa, ok := CD[codon]; ok {
+				sb.WriteString(aa)
+			} else {
+				sb.WriteString("X")
+			}
+			codon = ""
+		}
+	}
+	return sb.String()
+}
+
+// getProteins translates all the regions for each record from a channel
+func getProteins(regions []variants.Region, refToMSA []int, cMSA chan fasta.EncodedRecord, cProteins chan extract.Pieces) {
+	DA := encoding.MakeDecodingArray()
+	CD := alphabet.MakeCodonDict()
+	for EFR := range cMSA {
+		p := extract.Pieces{ID: EFR.ID, Idx: EFR.Idx, Seqs: make([]string, len(regions))}
+		for i, region := range regions {
+			p.Seqs[i] = translateRegion(EFR.Seq, region, refToMSA, DA, CD)
+		}
+		cProteins <- p
+	}
+}
+
+// selectRegions returns the regions with the names in genes, in that order, or all of them if genes is empty
+func selectRegions(regions []variants.Region, genes []string) ([]variants.Region, error) {
+	if len(genes) == 0 {
+		return regions, nil
+	}
+	selected := make([]variants.Region, 0, len(genes))
+	for _, g := range genes {
+		found := false
+		for _, r := range regions {
+			if r.Name == g {
+				selected = append(selected, r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("couldn't find a protein-coding region called " + g + " in the annotation")
+		}
+	}
+	return selected, nil
+}
+
+// Translate translates the protein-coding regions (as gofasta variants finds them in the annotation) of every
+// sequence in an alignment. If genes is not empty, only the regions with those names are translated. If
+// concatenated is nil, one protein alignment per region is written to outDir, otherwise all the proteins for each
+// sequence are concatenated into one alignment, and the positions of each region in it are written to partitions
+// (if it isn't nil). The reference is found in the same way as by gofasta variants.
+func Translate(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoSuffix string, genes []string, outDir string, concatenated io.Writer, partitions io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+
+	a, err := variants.StreamAnnotatedMSA(msaIn, stdin, refID, annoIn, annoSuffix, threads)
+	if err != nil {
+		return err
+	}
+
+	regions, err := selectRegions(a.CDSRegions, genes)
+	if err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		return errors.New("no protein-coding regions in the annotation")
+	}
+
+	var outs []io.Writer
+	if concatenated != nil {
+		outs = []io.Writer{concatenated}
+		if partitions != nil {
+			ps := make([]extract.Partition, len(regions))
+			for i, r := range regions {
+				ps[i] = extract.Partition{Name: r.Name, Length: len(r.Positions) / 3}
+			}
+			err = extract.WritePartitions(partitions, ps)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		names := make([]string, len(regions))
+		for i, r := range regions {
+			names[i] = r.Name
+		}
+		for _, name := range extract.FileNames(names) {
+			f, err := gfio.Create(filepath.Join(outDir, name))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			outs = append(outs, f)
+		}
+	}
+
+	cProteins := make(chan extract.Pieces, threads)
+	cProteinsDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	go extract.WritePieces(outs, concatenated != nil, cProteins, a.Err, cWriteDone)
+
+	// if the reference was the first record in the alignment it has already been read, but it still belongs in the output
+	if a.FirstMissing {
+		cRef := make(chan fasta.EncodedRecord, 1)
+		cRef <- a.Ref
+		close(cRef)
+		getProteins(regions, a.RefToMSA, cRef, cProteins)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(threads)
+	for n := 0; n < threads; n++ {
+		go func() {
+			getProteins(regions, a.RefToMSA, a.Records, cProteins)
+			wg.Done()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cProteinsDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-a.Err:
+			return err
+		case <-a.Done:
+			close(a.Records)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-a.Err:
+			return err
+		case <-cProteinsDone:
+			close(cProteins)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-a.Err:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
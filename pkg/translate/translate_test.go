@@ -0,0 +1,108 @@
+package translate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var gffData = []byte(`##gff-version 3
+##sequence-region somefakething 1 28
+somefakething	RefSeq	region	1	28	.	+	.	ID=somefakething:1..28
+somefakething	RefSeq	CDS	6	17	.	+	0	ID=CDS-gene1;Name=gene1
+somefakething	RefSeq	CDS	21	26	.	-	0	ID=CDS-gene2;Name=gene2
+`)
+
+// an insertion relative to the reference in q1 (which isn't translated), a deletion and an ambiguity code in q2,
+// and a frameshift in q3
+var msaData = []byte(`>ref
+ACGTAATG---ATGATGTAGAAATTACATGG
+>q1
+ACGTAATGCCCATGATGTAGAAATTACATGG
+>q2
+ACGTAATG---ATG---TAGAAATTNCATGG
+>q3
+ACGTAATG---AT-ATGTAGAAATTACATGG
+`)
+
+func TestTranslate(t *testing.T) {
+	dir := t.TempDir()
+	err := Translate(bytes.NewReader(msaData), false, "ref", bytes.NewReader(gffData), "gff", []string{}, dir, nil, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResults := map[string]string{
+		"gene1.fasta": `>ref
+MMM*
+>q1
+MMM*
+>q2
+MM-*
+>q3
+MXM*
+`,
+		"gene2.fasta": `>ref
+M*
+>q1
+M*
+>q2
+MX
+>q3
+M*
+`,
+	}
+
+	for name, desiredResult := range desiredResults {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != desiredResult {
+			t.Errorf("problem in TestTranslate (%s)", name)
+			t.Error(string(b))
+		}
+	}
+}
+
+func TestTranslateConcatenated(t *testing.T) {
+	out := new(bytes.Buffer)
+	partitions := new(bytes.Buffer)
+
+	// stdin, so the reference has to be (and is) the first record
+	err := Translate(bytes.NewReader(msaData), true, "ref", bytes.NewReader(gffData), "gff", []string{"gene2", "gene1"}, "", out, partitions, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredResult := `>ref
+M*MMM*
+>q1
+M*MMM*
+>q2
+MXMM-*
+>q3
+M*MXM*
+`
+	if out.String() != desiredResult {
+		t.Errorf("problem in TestTranslateConcatenated")
+		t.Error(out.String())
+	}
+
+	desiredPartitions := `#nexus
+begin sets;
+	charset gene2 = 1-2;
+	charset gene1 = 3-6;
+end;
+`
+	if partitions.String() != desiredPartitions {
+		t.Errorf("problem in TestTranslateConcatenated (partitions)")
+		t.Error(partitions.String())
+	}
+
+	err = Translate(bytes.NewReader(msaData), true, "ref", bytes.NewReader(gffData), "gff", []string{"gene3"}, "", new(bytes.Buffer), nil, 1)
+	if err == nil {
+		t.Errorf("expected an error asking for a gene that isn't in the annotation")
+	}
+}
@@ -0,0 +1,69 @@
+package tree
+
+import (
+	"strconv"
+	"strings"
+)
+
+// newickName quotes a name if it contains any characters that mean something in Newick format
+func newickName(name string) string {
+	if strings.ContainsAny(name, " \t()[]':;,") {
+		return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+	}
+	return name
+}
+
+func newickLength(length float64) string {
+	return strconv.FormatFloat(length, 'f', -1, 64)
+}
+
+// writeSubtree writes the subtree below node (i.e. away from parent) in Newick format, without a branch length
+func (t *tree) writeSubtree(sb *strings.Builder, node int, parent int) {
+	if node < t.nTips {
+		sb.WriteString(newickName(t.names[node]))
+		return
+	}
+	sb.WriteString("(")
+	first := true
+	for _, e := range t.adj[node] {
+		if e.to == parent {
+			continue
+		}
+		if !first {
+			sb.WriteString(",")
+		}
+		first = false
+		t.writeSubtree(sb, e.to, node)
+		sb.WriteString(":" + newickLength(e.length))
+	}
+	sb.WriteString(")")
+}
+
+// newick returns the tree in Newick format. If root is a tip, the tree is rooted on the branch leading to
+// it, at the point where that branch joins the rest of the tree. Otherwise (root == -1) it is written unrooted,
+// with a trifurcation at the node that was added last.
+func (t *tree) newick(root int) string {
+	var sb strings.Builder
+
+	switch {
+	case t.nTips == 1:
+		sb.WriteString(newickName(t.names[0]))
+
+	case root >= 0:
+		e := t.adj[root][0]
+		sb.WriteString("(")
+		t.writeSubtree(&sb, e.to, root)
+		sb.WriteString(":0," + newickName(t.names[root]) + ":" + newickLength(e.length) + ")")
+
+	case t.nTips == 2:
+		l := t.adj[0][0].length / 2
+		sb.WriteString("(" + newickName(t.names[0]) + ":" + newickLength(l) + "," + newickName(t.names[1]) + ":" + newickLength(l) + ")")
+
+	default:
+		t.writeSubtree(&sb, len(t.adj)-1, -1)
+	}
+
+	sb.WriteString(";\n")
+
+	return sb.String()
+}
@@ -0,0 +1,171 @@
+package tree
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+// edge is one end of a branch in an unrooted tree
+type edge struct {
+	to     int
+	length float64
+}
+
+// tree is an unrooted tree, stored as an adjacency list. The first nTips nodes are the tips, in the same
+// order as the names, and all the other nodes are internal
+type tree struct {
+	names []string
+	nTips int
+	adj   [][]edge
+}
+
+func (t *tree) addNode() int {
+	t.adj = append(t.adj, make([]edge, 0, 3))
+	return len(t.adj) - 1
+}
+
+func (t *tree) join(a, b int, length float64) {
+	t.adj[a] = append(t.adj[a], edge{to: b, length: length})
+	t.adj[b] = append(t.adj[b], edge{to: a, length: length})
+}
+
+// pair is a candidate pair of nodes to join, and its Q value
+type pair struct {
+	i, j int
+	q    float64
+}
+
+// less breaks ties between candidate pairs deterministically
+func (p pair) less(o pair) bool {
+	return p.q < o.q || (p.q == o.q && (p.i < o.i || (p.i == o.i && p.j < o.j)))
+}
+
+// neighbourJoin builds an unrooted tree from a distance matrix using Saitou and Nei's (1987) neighbour-joining
+// algorithm. The matrix is modified in place. Negative branch lengths are set to zero.
+func neighbourJoin(names []string, d [][]float64, threads int) (*tree, error) {
+
+	n := len(names)
+	if n == 0 {
+		return nil, errors.New("no sequences to build a tree from")
+	}
+
+	for i := range d {
+		for j := range d[i] {
+			if math.IsNaN(d[i][j]) || math.IsInf(d[i][j], 0) {
+				return nil, errors.New("couldn't calculate the distance between " + names[i] + " and " + names[j] + " (do they have any known sites in common?)")
+			}
+		}
+	}
+
+	t := &tree{names: names, nTips: n, adj: make([][]edge, n)}
+
+	// node[i] is the node in the tree that row/column i of the matrix currently represents
+	node := make([]int, n)
+	for i := range node {
+		node[i] = i
+	}
+
+	active := make([]int, n)
+	for i := range active {
+		active[i] = i
+	}
+
+	r := make([]float64, n)
+	for _, i := range active {
+		for _, j := range active {
+			r[i] += d[i][j]
+		}
+	}
+
+	for len(active) > 3 {
+		m := len(active)
+
+		// find the pair which minimises Q(i, j) = (m-2)d(i, j) - r(i) - r(j), split over threads
+		results := make([]pair, threads)
+		found := make([]bool, threads)
+		var wg sync.WaitGroup
+		wg.Add(threads)
+		for w := 0; w < threads; w++ {
+			go func(w int) {
+				for a := w; a < m; a += threads {
+					i := active[a]
+					for _, j := range active[a+1:] {
+						p := pair{i: i, j: j, q: float64(m-2)*d[i][j] - r[i] - r[j]}
+						if i > j {
+							p.i, p.j = j, i
+						}
+						if !found[w] || p.less(results[w]) {
+							results[w] = p
+							found[w] = true
+						}
+					}
+				}
+				wg.Done()
+			}(w)
+		}
+		wg.Wait()
+
+		var best pair
+		first := true
+		for w := range results {
+			if found[w] && (first || results[w].less(best)) {
+				best = results[w]
+				first = false
+			}
+		}
+		i, j := best.i, best.j
+
+		// branch lengths from the new node to the two being joined
+		li := d[i][j]/2 + (r[i]-r[j])/(2*float64(m-2))
+		lj := d[i][j] - li
+		if li < 0 {
+			li, lj = 0, d[i][j]
+		}
+		if lj < 0 {
+			li, lj = d[i][j], 0
+		}
+
+		u := t.addNode()
+		t.join(u, node[i], li)
+		t.join(u, node[j], lj)
+
+		// the new node takes the place of i in the matrix, and j is removed
+		newActive := make([]int, 0, m-1)
+		for _, k := range active {
+			if k == j {
+				continue
+			}
+			newActive = append(newActive, k)
+			if k == i {
+				continue
+			}
+			dk := (d[i][k] + d[j][k] - d[i][j]) / 2
+			r[k] += dk - d[i][k] - d[j][k]
+			d[i][k] = dk
+			d[k][i] = dk
+		}
+		active = newActive
+		node[i] = u
+		r[i] = 0
+		for _, k := range active {
+			if k != i {
+				r[i] += d[i][k]
+			}
+		}
+	}
+
+	switch len(active) {
+	case 3:
+		a, b, c := active[0], active[1], active[2]
+		u := t.addNode()
+		t.join(u, node[a], math.Max(0, (d[a][b]+d[a][c]-d[b][c])/2))
+		t.join(u, node[b], math.Max(0, (d[a][b]+d[b][c]-d[a][c])/2))
+		t.join(u, node[c], math.Max(0, (d[a][c]+d[b][c]-d[a][b])/2))
+	case 2:
+		a, b := active[0], active[1]
+		t.join(node[a], node[b], d[a][b])
+	}
+
+	return t, nil
+}
@@ -0,0 +1,78 @@
+/*
+Package tree provides routines to build quick, distance-based phylogenetic
+trees from alignments
+*/
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/virus-evolution/gofasta/pkg/closest"
+	"github.com/virus-evolution/gofasta/pkg/fasta"
+)
+
+// Tree builds a neighbour-joining tree from the distances (raw, snp or tn93) between the sequences in an alignment,
+// and writes it in Newick format. If ref is not nil, its (first) sequence is added to the tree if it isn't in the
+// alignment already, the tree is rooted on it, and it is used to speed up the distance calculations (see closest.Closest).
+func Tree(msa io.Reader, ref io.Reader, measure string, out io.Writer, threads int) error {
+
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	} else if threads < runtime.NumCPU() {
+		runtime.GOMAXPROCS(threads)
+	}
+
+	records, err := fasta.LoadEncodeAlignment(msa, false, true, false)
+	if err != nil {
+		return err
+	}
+
+	root := -1
+	var refSeq []byte
+	if ref != nil {
+		refs, err := fasta.LoadEncodeAlignment(ref, false, true, false)
+		if err != nil {
+			return err
+		}
+		if len(refs[0].Seq) != len(records[0].Seq) {
+			return errors.New("reference and alignment are not the same width")
+		}
+		refSeq = refs[0].Seq
+		for i := range records {
+			if records[i].ID == refs[0].ID {
+				root = i
+				break
+			}
+		}
+		if root == -1 {
+			refs[0].Idx = len(records)
+			records = append(records, refs[0])
+			root = len(records) - 1
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "number of sequences in tree: %d\n", len(records))
+
+	matrix, err := closest.DistanceMatrix(records, refSeq, measure, threads)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(records))
+	for i := range records {
+		names[i] = records[i].ID
+	}
+
+	t, err := neighbourJoin(names, matrix, threads)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write([]byte(t.newick(root)))
+
+	return err
+}
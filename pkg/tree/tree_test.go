@@ -0,0 +1,71 @@
+package tree
+
+import (
+	"bytes"
+	"testing"
+)
+
+// this is the worked example from https://en.wikipedia.org/wiki/Neighbor_joining
+func TestNeighbourJoin(t *testing.T) {
+	d := [][]float64{
+		{0, 5, 9, 9, 8},
+		{5, 0, 10, 10, 9},
+		{9, 10, 0, 8, 7},
+		{9, 10, 8, 0, 3},
+		{8, 9, 7, 3, 0},
+	}
+
+	tr, err := neighbourJoin([]string{"a", "b", "c", "d", "e"}, d, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tr.newick(-1) != "(((a:2,b:3):3,c:4):2,d:2,e:1);\n" {
+		t.Errorf("problem in TestNeighbourJoin (unrooted): %s", tr.newick(-1))
+	}
+
+	if tr.newick(3) != "((((a:2,b:3):3,c:4):2,e:1):0,d:2);\n" {
+		t.Errorf("problem in TestNeighbourJoin (rooted): %s", tr.newick(3))
+	}
+}
+
+func TestTree(t *testing.T) {
+	msaData := []byte(`>seq1
+ATGATGATGC
+>seq2
+ATGATGATGA
+>seq(3)
+ATGATCATGA
+`)
+	refData := []byte(`>ref
+ATGATGATGC
+`)
+
+	out := new(bytes.Buffer)
+	err := Tree(bytes.NewReader(msaData), nil, "snp", out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "(seq1:1,seq2:0,'seq(3)':1);\n" {
+		t.Errorf("problem in TestTree (unrooted): %s", out.String())
+	}
+
+	out = new(bytes.Buffer)
+	err = Tree(bytes.NewReader(msaData), bytes.NewReader(refData), "snp", out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "((seq1:0,(seq2:0,'seq(3)':1):1):0,ref:0);\n" {
+		t.Errorf("problem in TestTree (rooted): %s", out.String())
+	}
+
+	// if the reference is in the alignment, it isn't added again
+	out = new(bytes.Buffer)
+	err = Tree(bytes.NewReader(msaData), bytes.NewReader([]byte(">seq1\nATGATGATGC\n")), "snp", out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "((seq2:0,'seq(3)':1):0,seq1:1);\n" {
+		t.Errorf("problem in TestTree (rooted on a sequence in the alignment): %s", out.String())
+	}
+}
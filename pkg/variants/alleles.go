@@ -0,0 +1,179 @@
+package variants
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/virus-evolution/gofasta/pkg/alphabet"
+)
+
+// AlleleFrequency is one allele that is present in some of a set of reads (for example, a within-host variant),
+// and how many of the reads covering its site have it
+type AlleleFrequency struct {
+	V     Variant
+	Depth int // the number of reads covering the site
+	Count int // the number of reads with the allele
+}
+
+// Frequency is the proportion of the reads covering the allele's site that have it
+func (a AlleleFrequency) Frequency() float64 {
+	if a.Depth == 0 {
+		return 0
+	}
+	return float64(a.Count) / float64(a.Depth)
+}
+
+// AnnotateSNV annotates a change to alt at (1-based) position pos of the (degapped) reference sequence refSeq on its
+// own, without any other changes in the same codon. It is an amino acid change in every region in cdsregions in
+// which it is non-synonymous, or a nucleotide change if there are none. Each Variant's Consequence is set.
+func AnnotateSNV(refSeq string, pos int, alt byte, cdsregions []Region) ([]Variant, error) {
+
+	if pos < 1 || pos > len(refSeq) {
+		return []Variant{}, errors.New("variant position is outside the reference sequence: " + strconv.Itoa(pos))
+	}
+
+	CD := alphabet.MakeCodonDict()
+
+	nuc := Variant{Changetype: "nuc", RefAl: refSeq[pos-1 : pos], QueAl: string(alt), Position: pos, Consequence: noncodingConsequence(pos, cdsregions)}
+
+	variants := make([]Variant, 0)
+	for _, region := range cdsregions {
+		if pos < region.Start || pos > region.Stop {
+			continue
+		}
+		for i, p := range region.Positions {
+			if p != pos {
+				continue
+			}
+			codonStart := i - i%3
+			if codonStart+3 > len(region.Positions) || codonStart/3 >= len(region.Translation) {
+				break
+			}
+			codonPositions := region.Positions[codonStart : codonStart+3]
+			refCodon, queCodon := "", ""
+			for _, cp := range codonPositions {
+				refCodon = refCodon + refSeq[cp-1:cp]
+				if cp == pos {
+					queCodon = queCodon + string(alt)
+				} else {
+					queCodon = queCodon + refSeq[cp-1:cp]
+				}
+			}
+			if region.Strand == -1 {
+				refCodon = alphabet.Complement(refCodon)
+				queCodon = alphabet.Complement(queCodon)
+			}
+			aa, ok := CD[queCodon]
+			if !ok {
+				aa = "X"
+			}
+			refaa := string(region.Translation[codonStart/3])
+			if aa != refaa && aa != "X" {
+				variants = append(variants, Variant{Changetype: "aa", Feature: region.Name, RefAl: refaa, QueAl: aa, Position: codonPositions[2] - (2 * region.Strand), Residue: codonStart/3 + 1, SNPs: "nuc:" + nuc.RefAl + strconv.Itoa(pos) + nuc.QueAl, RefCodon: refCodon, QueCodon: queCodon, Consequence: aaConsequence(region, refaa, aa, codonStart/3+1)})
+			} else if aa == "X" {
+				nuc.Consequence = CodingSequenceVariant
+			} else if nuc.Consequence != CodingSequenceVariant {
+				nuc.Consequence = SynonymousVariant
+			}
+		}
+	}
+
+	if len(variants) == 0 {
+		variants = append(variants, nuc)
+	}
+
+	return variants, nil
+}
+
+// WriteAlleleFrequencies writes allele frequencies in csv format, one line per allele (and per amino acid change, if
+// an allele changes more than one protein), in the order they are given. Each allele is formatted as by FormatVariant
+func WriteAlleleFrequencies(w io.Writer, afs []AlleleFrequency, o Options) error {
+
+	_, err := w.Write([]byte("mutation,depth,count,frequency\n"))
+	if err != nil {
+		return err
+	}
+
+	for _, a := range afs {
+		rep, err := FormatVariant(a.V, o)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(rep + "," + strconv.Itoa(a.Depth) + "," + strconv.Itoa(a.Count) + "," + strconv.FormatFloat(a.Frequency(), 'f', 9, 64) + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alleleFrequencyRecord is one line of an allele frequency vcf file
+type alleleFrequencyRecord struct {
+	vcfRecord
+	aas   []string
+	depth int
+	count int
+}
+
+// WriteAlleleFrequencyVCF writes allele frequencies to a sites-only vcf file, with one line per allele. Amino acid
+// changes are given in the AA INFO field, and the read depth, allele count and allele frequency in DP, AC and AF.
+func WriteAlleleFrequencyVCF(w io.Writer, refID string, refSeq string, afs []AlleleFrequency) error {
+
+	records := make([]*alleleFrequencyRecord, 0)
+	byKey := make(map[string]*alleleFrequencyRecord)
+	for _, a := range afs {
+		temp, err := vcfRecordsFromVariant(a.V, refSeq)
+		if err != nil {
+			return err
+		}
+		for _, r := range temp {
+			key := r.key() + ":" + r.alt
+			afr, ok := byKey[key]
+			if !ok {
+				afr = &alleleFrequencyRecord{vcfRecord: r, aas: []string{}, depth: a.Depth, count: a.Count}
+				byKey[key] = afr
+				records = append(records, afr)
+			}
+			if r.aa != "" && !contains(afr.aas, r.aa) {
+				afr.aas = append(afr.aas, r.aa)
+			}
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].pos < records[j].pos || (records[i].pos == records[j].pos && records[i].class < records[j].class) || (records[i].pos == records[j].pos && records[i].class == records[j].class && records[i].alt < records[j].alt)
+	})
+
+	header := "##fileformat=VCFv4.3\n" +
+		"##source=gofasta\n" +
+		"##contig=<ID=" + refID + ",length=" + strconv.Itoa(len(refSeq)) + ">\n" +
+		"##INFO=<ID=TYPE,Number=A,Type=String,Description=\"Type of each alternate allele (snp, ins or del)\">\n" +
+		"##INFO=<ID=AA,Number=A,Type=String,Description=\"Amino acid change(s) caused by each alternate allele, \\\"|\\\"-delimited, or . if none\">\n" +
+		"##INFO=<ID=DP,Number=1,Type=Integer,Description=\"Number of reads covering the site\">\n" +
+		"##INFO=<ID=AC,Number=A,Type=Integer,Description=\"Number of reads carrying each alternate allele\">\n" +
+		"##INFO=<ID=AF,Number=A,Type=Float,Description=\"Frequency of each alternate allele in the reads\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n"
+
+	_, err := w.Write([]byte(header))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		info := "TYPE=" + r.class
+		if len(r.aas) > 0 {
+			info = info + ";AA=" + strings.Join(r.aas, "|")
+		}
+		info = info + ";DP=" + strconv.Itoa(r.depth) + ";AC=" + strconv.Itoa(r.count) + ";AF=" + strconv.FormatFloat(AlleleFrequency{Depth: r.depth, Count: r.count}.Frequency(), 'f', 9, 64)
+		_, err = w.Write([]byte(refID + "\t" + strconv.Itoa(r.pos) + "\t.\t" + r.ref + "\t" + r.alt + "\t.\t.\t" + info + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package variants
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateSNV(t *testing.T) {
+	refSeq := "CCATGAAACCCGGGTAAC"
+	regions := []Region{
+		{Whichtype: "protein-coding", Name: "fwd", Start: 3, Stop: 8, Translation: "MK", Strand: 1, Positions: []int{3, 4, 5, 6, 7, 8}},
+		{Whichtype: "protein-coding", Name: "rev", Start: 6, Stop: 8, Translation: "F", Strand: -1, Positions: []int{8, 7, 6}},
+	}
+
+	tests := []struct {
+		pos           int
+		alt           byte
+		desiredResult []Variant
+	}{
+		// non-synonymous in fwd, synonymous in rev
+		{6, 'G', []Variant{{Changetype: "aa", Feature: "fwd", RefAl: "K", QueAl: "E", Position: 6, Residue: 2, SNPs: "nuc:A6G", RefCodon: "AAA", QueCodon: "GAA", Consequence: MissenseVariant}}},
+		// non-synonymous in both
+		{8, 'C', []Variant{
+			{Changetype: "aa", Feature: "fwd", RefAl: "K", QueAl: "N", Position: 6, Residue: 2, SNPs: "nuc:A8C", RefCodon: "AAA", QueCodon: "AAC", Consequence: MissenseVariant},
+			{Changetype: "aa", Feature: "rev", RefAl: "F", QueAl: "V", Position: 8, Residue: 1, SNPs: "nuc:A8C", RefCodon: "TTT", QueCodon: "GTT", Consequence: StartLost},
+		}},
+		// synonymous in fwd, non-synonymous in rev
+		{8, 'G', []Variant{{Changetype: "aa", Feature: "rev", RefAl: "F", QueAl: "L", Position: 8, Residue: 1, SNPs: "nuc:A8G", RefCodon: "TTT", QueCodon: "CTT", Consequence: StartLost}}},
+		// the start codon of fwd
+		{4, 'C', []Variant{{Changetype: "aa", Feature: "fwd", RefAl: "M", QueAl: "T", Position: 3, Residue: 1, SNPs: "nuc:T4C", RefCodon: "ATG", QueCodon: "ACG", Consequence: StartLost}}},
+		// after the last coding sequence
+		{18, 'T', []Variant{{Changetype: "nuc", RefAl: "C", QueAl: "T", Position: 18, Consequence: ThreePrimeUTRVariant}}},
+	}
+
+	for _, test := range tests {
+		vs, err := AnnotateSNV(refSeq, test.pos, test.alt, regions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(vs, test.desiredResult) {
+			t.Errorf("problem in TestAnnotateSNV at position %d", test.pos)
+			t.Error(vs)
+		}
+	}
+
+	// synonymous, without the overlapping reverse-strand region
+	vs, err := AnnotateSNV(refSeq, 8, 'G', regions[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vs, []Variant{{Changetype: "nuc", RefAl: "A", QueAl: "G", Position: 8, Consequence: SynonymousVariant}}) {
+		t.Errorf("problem in TestAnnotateSNV (synonymous)")
+		t.Error(vs)
+	}
+
+	_, err = AnnotateSNV(refSeq, 19, 'A', regions)
+	if err == nil {
+		t.Error("expected an error for a position outside the reference in TestAnnotateSNV")
+	}
+}
@@ -0,0 +1,139 @@
+package variants
+
+// The functional consequences of variants, as Sequence Ontology terms (http://www.sequenceontology.org)
+const (
+	SynonymousVariant     = "synonymous_variant"
+	MissenseVariant       = "missense_variant"
+	StopGained            = "stop_gained"
+	StopLost              = "stop_lost"
+	StartLost             = "start_lost"
+	InframeInsertion      = "inframe_insertion"
+	InframeDeletion       = "inframe_deletion"
+	FrameshiftVariant     = "frameshift_variant"
+	CodingSequenceVariant = "coding_sequence_variant" // a change in a codon that can't be translated (e.g. to an ambiguous base)
+	FivePrimeUTRVariant   = "5_prime_UTR_variant"
+	ThreePrimeUTRVariant  = "3_prime_UTR_variant"
+	IntergenicVariant     = "intergenic_variant"
+)
+
+// aaConsequence returns the consequence of a codon change that translates to aa instead of refaa at (1-based)
+// residue of a region (the first residue of a mature peptide isn't a start codon)
+func aaConsequence(region Region, refaa string, aa string, residue int) string {
+	switch {
+	case aa == refaa:
+		return SynonymousVariant
+	case residue == 1 && region.Whichtype != "mature-peptide":
+		return StartLost
+	case aa == "*":
+		return StopGained
+	case refaa == "*":
+		return StopLost
+	default:
+		return MissenseVariant
+	}
+}
+
+// codingExtent returns the regions of cdsregions that start first and stop last on the forward strand of the
+// reference, and false if there are none
+func codingExtent(cdsregions []Region) (Region, Region, bool) {
+
+	if len(cdsregions) == 0 {
+		return Region{}, Region{}, false
+	}
+
+	first, last := cdsregions[0], cdsregions[0]
+	for _, r := range cdsregions {
+		if r.Start < first.Start {
+			first = r
+		}
+		if r.Stop > last.Stop {
+			last = r
+		}
+	}
+
+	return first, last, true
+}
+
+// noncodingConsequence returns the consequence of a change at (1-based) position pos that isn't in any of
+// cdsregions: a UTR variant if it is before the first or after the last of them on the forward strand of the
+// reference (5' or 3' of that coding sequence, given its strand), otherwise an intergenic variant
+func noncodingConsequence(pos int, cdsregions []Region) string {
+
+	first, last, ok := codingExtent(cdsregions)
+
+	switch {
+	case !ok:
+		return IntergenicVariant
+	case pos < first.Start && first.Strand == -1:
+		return ThreePrimeUTRVariant
+	case pos < first.Start:
+		return FivePrimeUTRVariant
+	case pos > last.Stop && last.Strand == -1:
+		return FivePrimeUTRVariant
+	case pos > last.Stop:
+		return ThreePrimeUTRVariant
+	default:
+		return IntergenicVariant
+	}
+}
+
+// insideRegion returns true if the (1-based) positions pos and pos+1 are adjacent in region, so that an insertion
+// between them is inside it
+func insideRegion(region Region, pos int) bool {
+	for i := 0; i < len(region.Positions)-1; i++ {
+		a, b := region.Positions[i], region.Positions[i+1]
+		if (a == pos && b == pos+1) || (a == pos+1 && b == pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// IndelConsequence returns the consequence of an insertion or deletion, v: a frameshift if it changes the length of
+// any of cdsregions by something other than a multiple of three, an in-frame indel if it changes the length of any
+// of them by a multiple of three, otherwise the consequence of a change to the non-coding sequence that it is in
+func IndelConsequence(v Variant, cdsregions []Region) string {
+
+	consequence := ""
+
+	for _, r := range cdsregions {
+		n := 0
+		switch v.Changetype {
+		case "del":
+			for _, p := range r.Positions {
+				if p >= v.Position && p < v.Position+v.Length {
+					n++
+				}
+			}
+		case "ins":
+			if insideRegion(r, v.Position) {
+				n = v.Length
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if n%3 != 0 {
+			return FrameshiftVariant
+		}
+		if v.Changetype == "ins" {
+			consequence = InframeInsertion
+		} else {
+			consequence = InframeDeletion
+		}
+	}
+
+	if consequence != "" {
+		return consequence
+	}
+
+	// an insertion is between v.Position and the next base, so it is after the last coding sequence if
+	// v.Position is its last base
+	if v.Changetype == "ins" {
+		if _, last, ok := codingExtent(cdsregions); ok && v.Position == last.Stop {
+			return noncodingConsequence(v.Position+1, cdsregions)
+		}
+	}
+
+	return noncodingConsequence(v.Position, cdsregions)
+}
@@ -0,0 +1,95 @@
+package variants
+
+import (
+	"testing"
+)
+
+func TestIndelConsequence(t *testing.T) {
+	regions := []Region{
+		{Whichtype: "protein-coding", Name: "gene1", Start: 6, Stop: 17, Translation: "MMM*", Strand: 1, Positions: []int{6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}},
+		{Whichtype: "protein-coding", Name: "gene2", Start: 21, Stop: 26, Translation: "M*", Strand: -1, Positions: []int{26, 25, 24, 23, 22, 21}},
+	}
+
+	tests := []struct {
+		v             Variant
+		desiredResult string
+	}{
+		{Variant{Changetype: "del", Position: 2, Length: 2}, FivePrimeUTRVariant},
+		{Variant{Changetype: "del", Position: 4, Length: 3}, FrameshiftVariant},
+		{Variant{Changetype: "del", Position: 9, Length: 3}, InframeDeletion},
+		{Variant{Changetype: "del", Position: 9, Length: 4}, FrameshiftVariant},
+		{Variant{Changetype: "del", Position: 18, Length: 2}, IntergenicVariant},
+		{Variant{Changetype: "del", Position: 22, Length: 3}, InframeDeletion},
+		{Variant{Changetype: "del", Position: 28, Length: 1}, FivePrimeUTRVariant},
+		{Variant{Changetype: "ins", Position: 5, Length: 3, QueAl: "AAA"}, FivePrimeUTRVariant},
+		{Variant{Changetype: "ins", Position: 6, Length: 3, QueAl: "AAA"}, InframeInsertion},
+		{Variant{Changetype: "ins", Position: 10, Length: 1, QueAl: "A"}, FrameshiftVariant},
+		{Variant{Changetype: "ins", Position: 17, Length: 1, QueAl: "A"}, IntergenicVariant},
+		{Variant{Changetype: "ins", Position: 23, Length: 6, QueAl: "AAAAAA"}, InframeInsertion},
+		{Variant{Changetype: "ins", Position: 26, Length: 1, QueAl: "A"}, FivePrimeUTRVariant},
+	}
+
+	for _, test := range tests {
+		c := IndelConsequence(test.v, regions)
+		if c != test.desiredResult {
+			t.Errorf("problem in TestIndelConsequence (%s:%d:%d)", test.v.Changetype, test.v.Position, test.v.Length)
+			t.Error(c)
+		}
+	}
+}
+
+func TestNoncodingConsequence(t *testing.T) {
+	forward := []Region{
+		{Whichtype: "protein-coding", Name: "gene1", Start: 7, Stop: 18, Translation: "MMM*", Strand: 1, Positions: []int{7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18}},
+	}
+	reverse := []Region{
+		{Whichtype: "protein-coding", Name: "gene1", Start: 7, Stop: 18, Translation: "MMM*", Strand: -1, Positions: []int{18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7}},
+	}
+
+	tests := []struct {
+		pos           int
+		cdsregions    []Region
+		desiredResult string
+	}{
+		{2, forward, FivePrimeUTRVariant},
+		{20, forward, ThreePrimeUTRVariant},
+		{2, reverse, ThreePrimeUTRVariant},
+		{20, reverse, FivePrimeUTRVariant},
+		{2, []Region{}, IntergenicVariant},
+	}
+
+	for _, test := range tests {
+		c := noncodingConsequence(test.pos, test.cdsregions)
+		if c != test.desiredResult {
+			t.Errorf("problem in TestNoncodingConsequence (%d)", test.pos)
+			t.Error(c)
+		}
+	}
+}
+
+func TestAAConsequence(t *testing.T) {
+	cds := Region{Whichtype: "protein-coding"}
+	peptide := Region{Whichtype: "mature-peptide"}
+
+	tests := []struct {
+		region        Region
+		refaa, aa     string
+		residue       int
+		desiredResult string
+	}{
+		{cds, "M", "M", 1, SynonymousVariant},
+		{cds, "M", "I", 1, StartLost},
+		{peptide, "S", "I", 1, MissenseVariant},
+		{cds, "S", "*", 4, StopGained},
+		{cds, "*", "Q", 10, StopLost},
+		{cds, "D", "G", 614, MissenseVariant},
+	}
+
+	for _, test := range tests {
+		c := aaConsequence(test.region, test.refaa, test.aa, test.residue)
+		if c != test.desiredResult {
+			t.Errorf("problem in TestAAConsequence (%s%d%s)", test.refaa, test.residue, test.aa)
+			t.Error(c)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package variants
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// longHeader is the header row of the long format, which has one row per mutation per query
+var longHeader = []string{"query", "reference", "type", "feature", "position", "residue", "ref_allele", "alt_allele", "length", "ref_codon", "alt_codon", "snps", "consequence"}
+
+// inRange returns the mutations in vs whose position is between start and end (inclusive), or all of them
+// if start and end aren't both set
+func inRange(vs []Variant, start, end int) []Variant {
+	if start <= 0 || end <= 0 {
+		return vs
+	}
+	temp := make([]Variant, 0, len(vs))
+	for _, v := range vs {
+		if v.Position < start || v.Position > end {
+			continue
+		}
+		temp = append(temp, v)
+	}
+	return temp
+}
+
+// itoaNonZero returns i as a string, or "" if it is zero (such as the residue of a nucleotide change)
+func itoaNonZero(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+// longRecord returns the fields of the row for v in the long format, as in longHeader
+func longRecord(queryname, refname string, v Variant) []string {
+	return []string{queryname, refname, v.Changetype, v.Feature, strconv.Itoa(v.Position), itoaNonZero(v.Residue), v.RefAl, v.QueAl, itoaNonZero(v.Length), v.RefCodon, v.QueCodon, v.SNPs, v.Consequence}
+}
+
+// writeInOrder passes each query's mutations from cVariants to write, in input order, skipping the reference
+// sequence. It returns false if there was an error (which has already been passed to cErr)
+func writeInOrder(firstmissing bool, refID string, cVariants chan AnnoStructs, cErr chan error, write func(AnnoStructs) error) bool {
+
+	outputMap := make(map[int]AnnoStructs)
+
+	counter := 0
+	if firstmissing {
+		counter = 1
+	}
+
+	for AS := range cVariants {
+		outputMap[AS.Idx] = AS
+
+		for {
+			VL, ok := outputMap[counter]
+			if !ok {
+				break
+			}
+			delete(outputMap, counter)
+			counter++
+			if VL.Queryname == refID {
+				continue
+			}
+			err := write(VL)
+			if err != nil {
+				cErr <- err
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// WriteLongVariants writes each query's mutations to file or stdout in long format, with one row per
+// mutation per query and the parts of each mutation in their own columns. Queries with no mutations have
+// no rows. The header row is only written if header is true
+func WriteLongVariants(w io.Writer, start, end int, firstmissing bool, header bool, refID string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
+
+	cw := csv.NewWriter(w)
+
+	if header {
+		err := cw.Write(longHeader)
+		if err != nil {
+			cErr <- err
+			return
+		}
+	}
+
+	ok := writeInOrder(firstmissing, refID, cVariants, cErr, func(AS AnnoStructs) error {
+		for _, v := range inRange(AS.Vs, start, end) {
+			err := cw.Write(longRecord(AS.Queryname, AS.Refname, v))
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+	if !ok {
+		return
+	}
+
+	cWriteDone <- true
+}
+
+// WriteJSONVariants writes each query's mutations to file or stdout as newline-delimited json, with one
+// AnnoStructs object per line
+func WriteJSONVariants(w io.Writer, start, end int, firstmissing bool, refID string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
+
+	enc := json.NewEncoder(w)
+
+	ok := writeInOrder(firstmissing, refID, cVariants, cErr, func(AS AnnoStructs) error {
+		AS.Vs = inRange(AS.Vs, start, end)
+		if AS.Vs == nil {
+			AS.Vs = []Variant{}
+		}
+		return enc.Encode(AS)
+	})
+	if !ok {
+		return
+	}
+
+	cWriteDone <- true
+}
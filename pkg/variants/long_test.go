@@ -0,0 +1,106 @@
+package variants
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVariantsLong(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq1
+ATGTATTGATGATGTAG-AAAATA
+>seq2
+ACGTA---ATGATGTAG-AAAAAA
+>seq3
+ACGTAATGATGATGTAGCAAAAAA
+>seq4
+ACGTAATGATGATGTAG-AAAAAA
+`)
+
+	msa := bytes.NewReader(msaData)
+	genbankReader := bytes.NewReader(genbankDataShort)
+	out := new(bytes.Buffer)
+
+	err := Variants(msa, false, "reference", genbankReader, "gb", out, Options{Format: "long"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult := "query,reference,type,feature,position,residue,ref_allele,alt_allele,length,ref_codon,alt_codon,snps,consequence\n" +
+		"seq1,reference,nuc,5'UTR,2,,C,T,,,,,5_prime_UTR_variant\n" +
+		"seq1,reference,aa,gene1,6,1,M,L,,ATG,TTG,nuc:A6T,start_lost\n" +
+		"seq1,reference,nuc,3'UTR,22,,A,T,,,,,3_prime_UTR_variant\n" +
+		"seq2,reference,aadel,gene1,6,1,M,,1,,,del:6:3,inframe_deletion\n" +
+		"seq2,reference,del,,6,,,,3,,,,inframe_deletion\n" +
+		"seq3,reference,ins,,17,,,C,1,,,,3_prime_UTR_variant\n"
+
+	if out.String() != desiredResult {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsLong()")
+	}
+
+	msa = bytes.NewReader(msaData)
+	genbankReader = bytes.NewReader(genbankDataShort)
+	out = new(bytes.Buffer)
+
+	err = Variants(msa, false, "reference", genbankReader, "gb", out, Options{Start: 1, End: 10, Format: "long"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult = "query,reference,type,feature,position,residue,ref_allele,alt_allele,length,ref_codon,alt_codon,snps,consequence\n" +
+		"seq1,reference,nuc,5'UTR,2,,C,T,,,,,5_prime_UTR_variant\n" +
+		"seq1,reference,aa,gene1,6,1,M,L,,ATG,TTG,nuc:A6T,start_lost\n" +
+		"seq2,reference,aadel,gene1,6,1,M,,1,,,del:6:3,inframe_deletion\n" +
+		"seq2,reference,del,,6,,,,3,,,,inframe_deletion\n"
+
+	if out.String() != desiredResult {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsLong() (start/end)")
+	}
+
+	msa = bytes.NewReader(msaData)
+	genbankReader = bytes.NewReader(genbankDataShort)
+	out = new(bytes.Buffer)
+
+	err = Variants(msa, false, "reference", genbankReader, "gb", out, Options{Aggregate: true, Format: "long"}, 1)
+	if err == nil {
+		t.Errorf("problem in TestVariantsLong() (aggregate): expected an error")
+	}
+}
+
+func TestVariantsJSON(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq1
+ATGTATTGATGATGTAG-AAAATA
+>seq2
+ACGTA---ATGATGTAG-AAAAAA
+>seq3
+ACGTAATGATGATGTAGCAAAAAA
+>seq4
+ACGTAATGATGATGTAG-AAAAAA
+`)
+
+	msa := bytes.NewReader(msaData)
+	genbankReader := bytes.NewReader(genbankDataShort)
+	out := new(bytes.Buffer)
+
+	err := Variants(msa, false, "reference", genbankReader, "gb", out, Options{Format: "json"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult := `{"query":"seq1","reference":"reference","variants":[{"ref":"C","alt":"T","position":2,"type":"nuc","feature":"5'UTR","consequence":"5_prime_UTR_variant"},{"ref":"M","alt":"L","position":6,"residue":1,"type":"aa","feature":"gene1","snps":"nuc:A6T","ref_codon":"ATG","alt_codon":"TTG","consequence":"start_lost"},{"ref":"A","alt":"T","position":22,"type":"nuc","feature":"3'UTR","consequence":"3_prime_UTR_variant"}]}
+{"query":"seq2","reference":"reference","variants":[{"ref":"M","position":6,"residue":1,"type":"aadel","feature":"gene1","length":1,"snps":"del:6:3","consequence":"inframe_deletion"},{"position":6,"type":"del","length":3,"consequence":"inframe_deletion"}]}
+{"query":"seq3","reference":"reference","variants":[{"alt":"C","position":17,"type":"ins","length":1,"consequence":"3_prime_UTR_variant"}]}
+{"query":"seq4","reference":"reference","variants":[]}
+`
+
+	if out.String() != desiredResult {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsJSON()")
+	}
+}
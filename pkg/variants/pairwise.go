@@ -8,17 +8,66 @@ import (
 	"github.com/virus-evolution/gofasta/pkg/encoding"
 )
 
+// getMissingPair returns the ranges of (1-based, inclusive) reference positions at which the query has missing
+// data: anything but A, C, G, T or an internal gap (a deletion). Gaps at the start or the end of the alignment are
+// missing data too, because they mean that the query doesn't cover those positions (as in sam toma's output).
+func getMissingPair(query []byte, offsetRefCoord []int) [][2]int {
+
+	first, last := -1, -1
+	for pos := range query {
+		if query[pos] != 244 {
+			if first == -1 {
+				first = pos
+			}
+			last = pos
+		}
+	}
+
+	missing := make([][2]int, 0)
+	for i := range offsetRefCoord {
+		pos := i + offsetRefCoord[i]
+		if first != -1 && pos >= first && pos <= last && (query[pos]&8 == 8 || query[pos] == 244) {
+			continue
+		}
+		if len(missing) > 0 && missing[len(missing)-1][1] == i {
+			missing[len(missing)-1][1] = i + 1
+		} else {
+			missing = append(missing, [2]int{i + 1, i + 1})
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return missing
+}
+
+// IsMissing returns true if any of the (1-based, inclusive) reference positions start to end are in the ranges
+// of missing data in missing (see AnnoStructs)
+func IsMissing(missing [][2]int, start, end int) bool {
+	for _, r := range missing {
+		if r[0] <= end && r[1] >= start {
+			return true
+		}
+	}
+	return false
+}
+
 func getIndelsPair(ref, query []byte, offsetRefCoord []int, offsetMSACoord []int) []Variant {
 
 	var (
 		insOpen   bool
 		insStart  int
 		insLength int
+		insSeq    string
 		delOpen   bool
 		delStart  int
 		delLength int
 	)
 
+	DA := encoding.MakeDecodingArray()
+
 	variants := make([]Variant, 0)
 
 	for pos := range ref {
@@ -28,15 +77,17 @@ func getIndelsPair(ref, query []byte, offsetRefCoord []int, offsetMSACoord []int
 			} else { // insertion is in this seq
 				if insOpen { // not the first position of an insertion
 					insLength++ // we increment the length counter
+					insSeq = insSeq + DA[query[pos]]
 				} else { // the first position of an insertion
 					insStart = pos // we record the first position of the insertion 0-based in alignment coordinates
 					insLength = 1
+					insSeq = DA[query[pos]]
 					insOpen = true
 				}
 			}
 		} else { // not an insertion relative to the reference at this position
 			if insOpen { // first base after an insertion, so we need to log the insertion
-				variants = append(variants, Variant{Changetype: "ins", Position: (insStart - offsetMSACoord[insStart]), Length: insLength})
+				variants = append(variants, Variant{Changetype: "ins", Position: (insStart - offsetMSACoord[insStart]), Length: insLength, QueAl: insSeq})
 				insOpen = false
 			}
 			if query[pos] == 244 { // deletion in this seq
@@ -64,7 +115,7 @@ func getIndelsPair(ref, query []byte, offsetRefCoord []int, offsetMSACoord []int
 	// }
 	// catch insertions that abut the end of the alignment
 	if insOpen {
-		variants = append(variants, Variant{Changetype: "ins", Position: (insStart - offsetMSACoord[insStart]) + 1, Length: insLength})
+		variants = append(variants, Variant{Changetype: "ins", Position: (insStart - offsetMSACoord[insStart]) + 1, Length: insLength, QueAl: insSeq})
 	}
 
 	return variants
@@ -88,7 +139,8 @@ func getAAsPair(ref, query []byte, region Region, offsetRefCoord []int, offsetMS
 	DA := encoding.MakeDecodingArray()
 	CD := alphabet.MakeCodonDict()
 
-	variants := make([]Variant, 0)
+	// in-frame indels are resolved first, along with the other changes to the codons they are in
+	variants, indelCodons := getAAIndelsPair(ref, query, region, offsetRefCoord)
 	codonSNPs := make([]Variant, 0, 3)
 
 	var decodedCodon, refDecodedCodon, aa, refaa string // Add refDecodedCodon
@@ -100,8 +152,7 @@ func getAAsPair(ref, query []byte, region Region, offsetRefCoord []int, offsetMS
 		// here is the actual position in the msa:
 		alignmentPos := (refPos - 1) + offsetRefCoord[refPos-1]
 
-		// skip insertions relative to the reference
-		// TO DO = if they are in this record log/take them into account in terms of the protein sequence?
+		// skip insertions relative to the reference (getAAIndelsPair deals with them)
 		if ref[alignmentPos] == 244 {
 			continue
 		}
@@ -130,15 +181,22 @@ func getAAsPair(ref, query []byte, region Region, offsetRefCoord []int, offsetMS
 
 			refaa = string(region.Translation[aaCounter])
 
-			if aa != refaa && aa != "X" {
+			if indelCodons[aaCounter] {
+				// already annotated
+			} else if aa != refaa && aa != "X" {
 				temp := []string{}
 				for _, v := range codonSNPs {
 					temp = append(temp, "nuc:"+v.RefAl+strconv.Itoa(v.Position)+v.QueAl)
 				}
-				variants = append(variants, Variant{Changetype: "aa", Feature: region.Name, RefAl: refaa, QueAl: aa, Position: refPos - (2 * region.Strand), Residue: aaCounter + 1, SNPs: strings.Join(temp, ";"), RefCodon: refDecodedCodon, QueCodon: decodedCodon}) // Add codons to Variant
+				variants = append(variants, Variant{Changetype: "aa", Feature: region.Name, RefAl: refaa, QueAl: aa, Position: refPos - (2 * region.Strand), Residue: aaCounter + 1, SNPs: strings.Join(temp, ";"), RefCodon: refDecodedCodon, QueCodon: decodedCodon, Consequence: aaConsequence(region, refaa, aa, aaCounter+1)}) // Add codons to Variant
 
 			} else {
 				for _, v := range codonSNPs {
+					if aa == "X" {
+						v.Consequence = CodingSequenceVariant
+					} else {
+						v.Consequence = SynonymousVariant
+					}
 					variants = append(variants, v)
 				}
 			}
@@ -153,3 +211,215 @@ func getAAsPair(ref, query []byte, region Region, offsetRefCoord []int, offsetMS
 
 	return variants
 }
+
+// getAAIndelsPair resolves the in-frame insertions and deletions in a query relative to the reference inside
+// a protein-coding region into amino acid insertions ("aains") and deletions ("aadel"), with their nucleotide
+// changes in the SNPs field. When an indel isn't between two codons, the codon it splits is compared to the
+// reference residues on either side, so that, for example, a 6-base deletion that starts in the 2nd base of
+// codon 68 is reported as del69-70 if the codon that is left still codes for residue 68 (or as an amino acid
+// change at 68 and del69-70 if it doesn't). It also returns the (0-based) codons that it has annotated all the
+// changes in, which the caller should skip.
+func getAAIndelsPair(ref, query []byte, region Region, offsetRefCoord []int) ([]Variant, map[int]bool) {
+
+	DA := encoding.MakeDecodingArray()
+	CD := alphabet.MakeCodonDict()
+
+	variants := make([]Variant, 0)
+	done := make(map[int]bool)
+
+	// only whole codons
+	n := len(region.Positions) - len(region.Positions)%3
+	if n == 0 {
+		return variants, done
+	}
+
+	// the query's bases at each position of the region in its own orientation (uncomplemented), and any bases
+	// that are inserted between each position and the next
+	alignmentPos := make([]int, n)
+	queNucs := make([]string, n)
+	insertions := make([]string, n)
+	for i := 0; i < n; i++ {
+		p := region.Positions[i]
+		alignmentPos[i] = (p - 1) + offsetRefCoord[p-1]
+		queNucs[i] = DA[query[alignmentPos[i]]]
+	}
+	for i := 0; i < n-1; i++ {
+		p, next := region.Positions[i], region.Positions[i+1]
+		if next != p+region.Strand {
+			continue
+		}
+		if region.Strand == 1 {
+			for j := alignmentPos[i] + 1; j < alignmentPos[i+1]; j++ {
+				if ref[j] == 244 && query[j] != 244 {
+					insertions[i] = insertions[i] + DA[query[j]]
+				}
+			}
+		} else {
+			for j := alignmentPos[i] - 1; j > alignmentPos[i+1]; j-- {
+				if ref[j] == 244 && query[j] != 244 {
+					insertions[i] = insertions[i] + DA[query[j]]
+				}
+			}
+		}
+	}
+
+	translate := func(s string) string {
+		if region.Strand == -1 {
+			s = alphabet.Complement(s)
+		}
+		aas := ""
+		for j := 0; j+3 <= len(s); j += 3 {
+			aa, ok := CD[s[j:j+3]]
+			if !ok {
+				aa = "X"
+			}
+			aas = aas + aa
+		}
+		return aas
+	}
+
+	refResidue := func(c int) string {
+		if c < 0 || c >= len(region.Translation) {
+			return ""
+		}
+		return string(region.Translation[c])
+	}
+
+	// the nucleotide changes at positions from (inclusive) to to (exclusive) of the region
+	snpsIn := func(from, to int) []Variant {
+		snps := make([]Variant, 0)
+		for i := from; i < to; i++ {
+			a := alignmentPos[i]
+			if query[a] != 244 && (query[a]&ref[a]) < 16 {
+				snps = append(snps, Variant{Changetype: "nuc", RefAl: DA[ref[a]], QueAl: DA[query[a]], Position: region.Positions[i]})
+			}
+		}
+		return snps
+	}
+
+	// the amino acid change (if the codon that is left where an indel splits codon c doesn't code for the
+	// reference residue that it is compared to), or otherwise the nucleotide changes in it
+	splitCodon := func(c int, queCodon string, snps []Variant, indel string) {
+		aa := translate(queCodon)
+		refaa := refResidue(c)
+		if aa != refaa && aa != "X" {
+			temp := []string{}
+			for _, v := range snps {
+				temp = append(temp, "nuc:"+v.RefAl+strconv.Itoa(v.Position)+v.QueAl)
+			}
+			temp = append(temp, indel)
+			refCodon := ""
+			for i := 3 * c; i < 3*c+3; i++ {
+				refCodon = refCodon + DA[ref[alignmentPos[i]]]
+			}
+			if region.Strand == -1 {
+				refCodon = alphabet.Complement(refCodon)
+				queCodon = alphabet.Complement(queCodon)
+			}
+			variants = append(variants, Variant{Changetype: "aa", Feature: region.Name, RefAl: refaa, QueAl: aa, Position: region.Positions[3*c], Residue: c + 1, SNPs: strings.Join(temp, ";"), RefCodon: refCodon, QueCodon: queCodon, Consequence: aaConsequence(region, refaa, aa, c+1)})
+			return
+		}
+		for _, v := range snps {
+			if aa == "X" {
+				v.Consequence = CodingSequenceVariant
+			} else {
+				v.Consequence = SynonymousVariant
+			}
+			variants = append(variants, v)
+		}
+	}
+
+	// deletions
+	for a := 0; a < n; {
+		if queNucs[a] != "-" {
+			a++
+			continue
+		}
+		b := a
+		for b < n && queNucs[b] == "-" {
+			b++
+		}
+		if (b-a)%3 != 0 {
+			a = b
+			continue
+		}
+
+		// the deletion touches residues first to last (0-based)
+		first, last := a/3, (b-1)/3
+		indel := "del:" + strconv.Itoa(gmin(region.Positions[a:b])) + ":" + strconv.Itoa(b-a)
+
+		if a%3 != 0 {
+			kept := strings.Join(queNucs[3*first:a], "") + strings.Join(queNucs[b:3*last+3], "")
+			if strings.Contains(kept, "-") {
+				a = b
+				continue
+			}
+			snps := append(snpsIn(3*first, a), snpsIn(b, 3*last+3)...)
+			if translate(kept) == refResidue(last) && translate(kept) != refResidue(first) {
+				splitCodon(last, kept, snps, indel)
+				last--
+			} else {
+				splitCodon(first, kept, snps, indel)
+				first++
+			}
+		}
+
+		for c := a / 3; c <= (b-1)/3; c++ {
+			done[c] = true
+		}
+
+		variants = append(variants, Variant{Changetype: "aadel", Feature: region.Name, RefAl: region.Translation[first : last+1], Position: region.Positions[3*first], Residue: first + 1, Length: last - first + 1, SNPs: indel, Consequence: InframeDeletion})
+
+		a = b
+	}
+
+	// insertions
+	for i := 0; i < n-1; i++ {
+		ins := insertions[i]
+		if len(ins) == 0 || len(ins)%3 != 0 {
+			continue
+		}
+		c := i / 3
+		if done[c] {
+			continue
+		}
+
+		// the insertion is after residue after (1-based)
+		after := c + 1
+		nucPos := region.Positions[i]
+		if region.Strand == -1 {
+			nucPos = region.Positions[i+1]
+		}
+		indel := "ins:" + strconv.Itoa(nucPos) + ":" + strconv.Itoa(len(ins))
+
+		var aas string
+		if (i+1)%3 == 0 {
+			aas = translate(ins)
+		} else {
+			split := strings.Join(queNucs[3*c:i+1], "") + ins + strings.Join(queNucs[i+1:3*c+3], "")
+			if strings.Contains(split, "-") {
+				continue
+			}
+			aas = translate(split)
+			snps := snpsIn(3*c, 3*c+3)
+			if aas[len(aas)-1:] == refResidue(c) && aas[:1] != refResidue(c) {
+				splitCodon(c, split[len(split)-3:], snps, indel)
+				aas = aas[:len(aas)-1]
+				after = c
+			} else {
+				splitCodon(c, split[:3], snps, indel)
+				aas = aas[1:]
+			}
+			done[c] = true
+		}
+
+		position := region.Positions[0]
+		if after > 0 {
+			position = region.Positions[3*(after-1)]
+		}
+
+		variants = append(variants, Variant{Changetype: "aains", Feature: region.Name, QueAl: aas, Position: position, Residue: after, Length: len(ins) / 3, SNPs: indel, Consequence: InframeInsertion})
+	}
+
+	return variants, done
+}
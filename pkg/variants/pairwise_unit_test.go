@@ -26,7 +26,7 @@ func TestGetIndelsPair(t *testing.T) {
 	indels := getIndelsPair(refSeq, queSeq, offsetRefCoord, offsetMSACoord)
 
 	desiredResultV := []Variant{
-		Variant{Position: 3, Changetype: "ins", Length: 3},
+		Variant{Position: 3, Changetype: "ins", Length: 3, QueAl: "ATG"},
 		Variant{Position: 6, Changetype: "del", Length: 2},
 	}
 
@@ -38,7 +38,7 @@ func TestGetIndelsPair(t *testing.T) {
 	s := make([]string, 0)
 
 	for _, v := range indels {
-		temp, _ := FormatVariant(v, false)
+		temp, _ := FormatVariant(v, Options{})
 		s = append(s, temp)
 	}
 
@@ -81,7 +81,7 @@ func TestGetNucsPair(t *testing.T) {
 	s := make([]string, 0)
 
 	for _, v := range nucs {
-		temp, _ := FormatVariant(v, false)
+		temp, _ := FormatVariant(v, Options{})
 		s = append(s, temp)
 	}
 
@@ -114,8 +114,8 @@ func TestGetAAsPair(t *testing.T) {
 	AAs := getAAsPair(refSeq, queSeq, r, offsetRefCoord, offsetMSACoord)
 
 	desiredResultV := []Variant{
-		Variant{RefAl: "S", QueAl: "C", Position: 4, Changetype: "aa", SNPs: "nuc:C5G", Residue: 2, Feature: "nspX"},
-		Variant{RefAl: "P", QueAl: "K", Position: 10, Changetype: "aa", SNPs: "nuc:C10A;nuc:C11A;nuc:C12A", Residue: 4, Feature: "nspX"},
+		Variant{RefAl: "S", QueAl: "C", Position: 4, Changetype: "aa", SNPs: "nuc:C5G", Residue: 2, Feature: "nspX", RefCodon: "TCT", QueCodon: "TGT", Consequence: MissenseVariant},
+		Variant{RefAl: "P", QueAl: "K", Position: 10, Changetype: "aa", SNPs: "nuc:C10A;nuc:C11A;nuc:C12A", Residue: 4, Feature: "nspX", RefCodon: "CCC", QueCodon: "AAA", Consequence: MissenseVariant},
 	}
 
 	if !reflect.DeepEqual(desiredResultV, AAs) {
@@ -126,7 +126,7 @@ func TestGetAAsPair(t *testing.T) {
 	s := make([]string, 0)
 
 	for _, v := range AAs {
-		temp, _ := FormatVariant(v, false)
+		temp, _ := FormatVariant(v, Options{})
 		s = append(s, temp)
 	}
 
@@ -140,7 +140,7 @@ func TestGetAAsPair(t *testing.T) {
 	s = make([]string, 0)
 
 	for _, v := range AAs {
-		temp, _ := FormatVariant(v, true)
+		temp, _ := FormatVariant(v, Options{AppendSNP: true})
 		s = append(s, temp)
 	}
 
@@ -151,3 +151,65 @@ func TestGetAAsPair(t *testing.T) {
 		fmt.Println(s)
 	}
 }
+
+func TestGetAAIndelsPair(t *testing.T) {
+
+	// MIHVEPDK*
+	fwd := Region{Whichtype: "protein-coding", Name: "g", Start: 1, Stop: 27, Translation: "MIHVEPDK*", Strand: 1, Positions: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27}}
+	// MEP* on the reverse strand
+	rev := Region{Whichtype: "protein-coding", Name: "r", Start: 1, Stop: 12, Translation: "MEP*", Strand: -1, Positions: []int{12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}}
+
+	tests := []struct {
+		ref, que      string
+		region        Region
+		desiredResult []string
+	}{
+		// deletion of whole codons
+		{"ATGATTCATGTCGAACCCGATAAATAA", "ATGATT------GAACCCGATAAATAA", fwd, []string{"aa:g:del3-4(del:7:6)"}},
+		// the codon that is left still codes for the residue before the deletion
+		{"ATGATTCATGTCGAACCCGATAAATAA", "ATGAT------CGAACCCGATAAATAA", fwd, []string{"aa:g:del3-4(del:6:6)"}},
+		// the codon that is left codes for the residue at the end of the deletion
+		{"ATGATTCATGTCGAACCCGATAAATAA", "ATGATTCATGTCG------ATAAATAA", fwd, []string{"aa:g:del5-6(del:14:6)"}},
+		// the codon that is left codes for neither
+		{"ATGATTCATGTCGAACCCGATAAATAA", "ATGATTCATGTCG---CCGATAAATAA", fwd, []string{"aa:g:E5A(del:14:3)", "aa:g:del6(del:14:3)"}},
+		// a frameshift isn't resolved
+		{"ATGATTCATGTCGAACCCGATAAATAA", "ATGATTCATGTCG--CCCGATAAATAA", fwd, []string{}},
+		// insertion between codons
+		{"ATGATTCATGTC---------GAACCCGATAAATAA", "ATGATTCATGTCGAGCCTGAAGAACCCGATAAATAA", fwd, []string{"aa:g:ins4EPE(ins:12:9)"}},
+		// insertion in a codon that still codes for the residue before it
+		{"ATGATTCATGTCG---AACCCGATAAATAA", "ATGATTCATGTCGAAAAACCCGATAAATAA", fwd, []string{"aa:g:ins5K(ins:13:3)"}},
+		// insertion in a codon that codes for the residue after it
+		{"ATGATTCATGTCGA---ACCCGATAAATAA", "ATGATTCATGTCGATGAACCCGATAAATAA", fwd, []string{"aa:g:ins4D(ins:14:3)"}},
+		// downstream codons are still translated
+		{"ATGATTCATGTC---------GAACCCGATAAATAA", "ATGATTCATGTCGAGCCTGAAGAACCCGGTAAATAA", fwd, []string{"aa:g:ins4EPE(ins:12:9)", "aa:g:D7G(nuc:A20G)"}},
+		// reverse strand
+		{"TTAGGGTTCCAT", "TTAGGG---CAT", rev, []string{"aa:r:del2(del:7:3)"}},
+	}
+
+	for _, test := range tests {
+		ref, err := fasta.Record{Seq: test.ref}.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		que, err := fasta.Record{Seq: test.que}.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offsetRefCoord, offsetMSACoord := GetMSAOffsets(ref.Seq)
+
+		s := make([]string, 0)
+		for _, v := range getAAsPair(ref.Seq, que.Seq, test.region, offsetRefCoord, offsetMSACoord) {
+			temp, err := FormatVariant(v, Options{AppendSNP: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s = append(s, temp)
+		}
+
+		if !reflect.DeepEqual(test.desiredResult, s) {
+			t.Errorf("problem in TestGetAAIndelsPair (%s)", test.que)
+			t.Error(s)
+		}
+	}
+}
@@ -7,7 +7,6 @@ package variants
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -26,41 +25,171 @@ import (
 )
 
 type Region struct {
-	Whichtype   string // only "protein-coding" for now
+	Whichtype   string // "protein-coding" (a CDS), "mature-peptide" (part of a CDS), or the type of a non-coding feature
 	Name        string // name of feature, if it has one
 	Start       int    // 1-based 5'-most position of region on the forward strand, inclusive
 	Stop        int    // 1-based 3'-most position of region on the forward strand, inclusive
 	Translation string // amino acid sequence of this region if it is CDS
 	Strand      int    // values in the set {-1, +1} only (and "0" for a mixture?!)
-	Positions   []int  // all the (1-based, unadjusted) positions in order, on the reverse strand if needs be
+	Positions   []int  // all the (1-based, unadjusted) positions in order, on the reverse strand if needs be (not for non-coding features)
 }
 
 // A Variant is a struct that contains information about one mutation (nuc, amino acid, indel) between
 // reference and query
 type Variant struct {
-	Queryname      string
-	RefAl          string
-	QueAl          string
-	Position       int    // (1-based) genomic location (for an amino acid change, this is the first position of the codon)
-	Residue        int    // (1-based) amino acid location
-	Changetype     string // one of {nuc,aa,ins,del}
-	Feature        string // this should be, for example, the name of the CDS that the thing is in
-	Length         int    // for indels
-	SNPs           string // if this is an amino acid change, what are the snps
-	Representation string
-	RefCodon       string // Reference codon for aa change
-	QueCodon       string // Query codon for aa change
+	Queryname      string `json:"-"`
+	RefAl          string `json:"ref,omitempty"`
+	QueAl          string `json:"alt,omitempty"`     // for an insertion, this is the inserted sequence
+	Position       int    `json:"position"`          // (1-based) genomic location (for an amino acid change, this is the first position of the codon)
+	Residue        int    `json:"residue,omitempty"` // (1-based) amino acid location (for an amino acid insertion, the residue it is after)
+	Changetype     string `json:"type"`              // one of {nuc,aa,ins,del,aains,aadel}
+	Feature        string `json:"feature,omitempty"` // this should be, for example, the name of the CDS that the thing is in
+	Length         int    `json:"length,omitempty"`  // for indels (in residues for aains and aadel)
+	SNPs           string `json:"snps,omitempty"`    // if this is an amino acid change, what are the snps (or the nucleotide indel, for aains and aadel)
+	Representation string `json:"-"`
+	RefCodon       string `json:"ref_codon,omitempty"`   // Reference codon for aa change
+	QueCodon       string `json:"alt_codon,omitempty"`   // Query codon for aa change
+	Consequence    string `json:"consequence,omitempty"` // the functional consequence of the change, e.g. missense_variant (see consequence.go)
 }
 
 // AnnoStructs is for passing groups of Variant structs around with an index which is used to retain input
 // order in the output
 type AnnoStructs struct {
-	Queryname string
-	Vs        []Variant
-	Idx       int
+	Queryname string    `json:"query"`
+	Refname   string    `json:"reference"`
+	Vs        []Variant `json:"variants"`
+	Missing   [][2]int  `json:"-"` // (1-based, inclusive) ranges of reference positions where the query has missing data
+	Idx       int       `json:"-"`
 }
 
-func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoSuffix string, out io.Writer, start int, end int, aggregate bool, threshold float64, appendSNP bool, appendCodons bool, threads int) error {
+// Options are the choices of which mutations to report and how to write them, for Variants and the
+// functions that write its output. The zero value reports every mutation in each query, in csv format
+type Options struct {
+	Start             int     // if Start and End are both > 0, only report mutations between them (1-based, inclusive reference positions)
+	End               int     // see Start
+	Aggregate         bool    // report the proportion of queries with each mutation, instead of each query's mutations
+	Threshold         float64 // if Aggregate, only report mutations in at least this proportion of queries
+	AppendSNP         bool    // give the nucleotide changes that underlie each amino acid change in parenthesis after it
+	AppendCodons      bool    // give the reference and query codons of each amino acid change in parenthesis after it
+	AppendConsequence bool    // give the functional consequence of each mutation in parenthesis after it
+	Format            string  // csv (or ""), vcf, long (one row per mutation) or json (newline-delimited)
+}
+
+// Variants annotates amino acid, insertion, deletion, and nucleotide (anything
+// outside of codons with an amino acid change) mutations relative to a reference
+// sequence from a multiple sequence alignment in fasta format. Genome annotations are
+// derived from an annotation file in genbank or gff version 3 format. What is written,
+// and in which format, is given by o
+func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoSuffix string, out io.Writer, o Options, threads int) error {
+
+	a, err := StreamAnnotatedMSA(msaIn, stdin, refID, annoIn, annoSuffix, threads)
+	if err != nil {
+		return err
+	}
+
+	ref, cdsregions, intregions, features, refToMSA, MSAToRef := a.Ref, a.CDSRegions, a.IntRegions, a.Features, a.RefToMSA, a.MSAToRef
+	firstmissing := a.FirstMissing
+	cMSA, cErr, cMSADone := a.Records, a.Err, a.Done
+
+	cVariants := make(chan AnnoStructs, 50+threads)
+	cVariantsDone := make(chan bool)
+	cWriteDone := make(chan bool)
+
+	switch o.Format {
+	case "csv", "":
+		switch o.Aggregate {
+		case true:
+			go AggregateWriteVariants(out, o, ref.ID, cVariants, cWriteDone, cErr)
+		case false:
+			go WriteVariants(out, o, firstmissing, ref.ID, cVariants, cWriteDone, cErr)
+		}
+	case "vcf":
+		refSeqDegapped := ref.Decode().Degap().Seq
+		switch o.Aggregate {
+		case true:
+			go AggregateWriteVCF(out, o.Start, o.End, o.Threshold, ref.ID, refSeqDegapped, cVariants, cWriteDone, cErr)
+		case false:
+			go WriteVCF(out, o.Start, o.End, ref.ID, refSeqDegapped, cVariants, cWriteDone, cErr)
+		}
+	case "long", "json":
+		if o.Aggregate {
+			return errors.New("can't aggregate mutations in " + o.Format + " format (choose one of \"csv\" or \"vcf\")")
+		}
+		if o.Format == "long" {
+			go WriteLongVariants(out, o.Start, o.End, firstmissing, true, ref.ID, cVariants, cWriteDone, cErr)
+		} else {
+			go WriteJSONVariants(out, o.Start, o.End, firstmissing, ref.ID, cVariants, cWriteDone, cErr)
+		}
+	default:
+		return errors.New("couldn't tell which output format to write (choose one of \"csv\", \"vcf\", \"long\" or \"json\")")
+	}
+
+	var wgVariants sync.WaitGroup
+	wgVariants.Add(threads)
+
+	for n := 0; n < threads; n++ {
+		go func() {
+			getVariants(ref, cdsregions, intregions, features, refToMSA, MSAToRef, cMSA, cVariants, cErr)
+			wgVariants.Done()
+		}()
+	}
+
+	go func() {
+		wgVariants.Wait()
+		cVariantsDone <- true
+	}()
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cMSADone:
+			close(cMSA)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cVariantsDone:
+			close(cVariants)
+			n--
+		}
+	}
+
+	for n := 1; n > 0; {
+		select {
+		case err := <-cErr:
+			return err
+		case <-cWriteDone:
+			n--
+		}
+	}
+
+	return nil
+}
+
+// AnnotatedMSA is an alignment that is being streamed, with the reference sequence and the regions of
+// its annotation that are needed to annotate the records in it
+type AnnotatedMSA struct {
+	Ref          fasta.EncodedRecord
+	CDSRegions   []Region
+	IntRegions   []int
+	Features     []Region // named non-coding features, see NameFeatures
+	RefToMSA     []int    // see GetMSAOffsets
+	MSAToRef     []int
+	FirstMissing bool // the reference was the first record in the alignment, and it has already been taken off Records
+	Records      chan fasta.EncodedRecord
+	Err          chan error
+	Done         chan bool
+}
+
+// StreamAnnotatedMSA finds the reference sequence (in the alignment if refID isn't "", otherwise in the annotation),
+// parses the annotation, and starts streaming the records in the alignment. If stdin is true, the reference must be
+// the first record in the alignment. The caller must close Records when Done receives, and listen on Err.
+func StreamAnnotatedMSA(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoSuffix string, threads int) (AnnotatedMSA, error) {
 
 	var (
 		ref fasta.EncodedRecord
@@ -71,26 +200,17 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 	// (Have to move the reader back to the beginning of the alignment, because we are scanning through it twice)
 	if refID != "" {
 		switch x := msaIn.(type) {
-		case *os.File:
+		case io.Seeker:
 			if !stdin {
 				ref, err = findReference(msaIn, refID)
 				if err != nil {
-					return err
+					return AnnotatedMSA{}, err
 				}
 				_, err = x.Seek(0, io.SeekStart)
 				if err != nil {
-					return err
+					return AnnotatedMSA{}, err
 				}
 			}
-		case *bytes.Reader:
-			ref, err = findReference(msaIn, refID)
-			if err != nil {
-				return err
-			}
-			_, err = x.Seek(0, io.SeekStart)
-			if err != nil {
-				return err
-			}
 		}
 	}
 
@@ -106,19 +226,20 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 		select {
 		case ref = <-cMSA:
 			if ref.ID != refID {
-				return errors.New("--reference is not the first record in --msa")
+				return AnnotatedMSA{}, errors.New("--reference is not the first record in --msa")
 			}
 			firstmissing = true
 		case err := <-cErr:
-			return err
+			return AnnotatedMSA{}, err
 		case <-cMSADone:
-			return errors.New("is the pipe to --msa empty?") // TO DO - does this work/is this necessary?
+			return AnnotatedMSA{}, errors.New("is the pipe to --msa empty?") // TO DO - does this work/is this necessary?
 		}
 	}
 
 	var (
 		cdsregions         []Region
 		intregions         []int
+		features           []Region
 		refToMSA, MSAToRef []int
 	)
 
@@ -126,7 +247,7 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 	case "gb":
 		gb, err := genbank.ReadGenBank(annoIn)
 		if err != nil {
-			return err
+			return AnnotatedMSA{}, err
 		}
 
 		// get the reference from the genbank source if required
@@ -145,28 +266,29 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 		// get a list of CDS + intergenic regions from the genbank file
 		cdsregions, intregions, err = RegionsFromGenbank(gb, refLenDegapped)
 		if err != nil {
-			return err
+			return AnnotatedMSA{}, err
 		}
+		features = FeaturesFromGenbank(gb)
 
 		// get the offsets accounting for insertions relative to the reference
 		refToMSA, MSAToRef = GetMSAOffsets(ref.Seq)
 
 		// check that the reference sequence is in the same coordinates as the annotation
 		if len(refToMSA) != len(gb.ORIGIN) {
-			return errors.New("the degapped reference sequence (" + ref.ID + ") is not the same length as the genbank annotation")
+			return AnnotatedMSA{}, errors.New("the degapped reference sequence (" + ref.ID + ") is not the same length as the genbank annotation")
 		}
 
 	case "gff":
 		gff, err := gff.ReadGFF(annoIn)
 		if err != nil {
-			return err
+			return AnnotatedMSA{}, err
 		}
 
 		// get the reference from the gff FASTA if required
 		if len(ref.Seq) == 0 {
 			switch len(gff.FASTA) {
 			case 0:
-				return errors.New("couldn't find a reference sequence in the --msa or the gff")
+				return AnnotatedMSA{}, errors.New("couldn't find a reference sequence in the --msa or the gff")
 			case 1:
 				var encodedrefseq []byte
 				for _, v := range gff.FASTA {
@@ -179,7 +301,7 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 				}
 				os.Stderr.WriteString("using --annotation fasta as reference\n")
 			default:
-				return errors.New("more than one sequence in gff ##FASTA section")
+				return AnnotatedMSA{}, errors.New("more than one sequence in gff ##FASTA section")
 			}
 
 		}
@@ -192,12 +314,12 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 		// check that the reference sequence is in the same coordinates as the annotation, if the gff
 		// file has a ##sequence-region line
 		if len(gff.SequenceRegions) > 1 {
-			return errors.New("more than one sequence-region in gff header")
+			return AnnotatedMSA{}, errors.New("more than one sequence-region in gff header")
 		} else if len(gff.SequenceRegions) == 1 {
 			for key := range gff.SequenceRegions {
 				region := key
 				if len(refSeqDegapped) != gff.SequenceRegions[region].End {
-					return errors.New("the degapped reference sequence (" + ref.ID + ") is not the same length as the gff annotation")
+					return AnnotatedMSA{}, errors.New("the degapped reference sequence (" + ref.ID + ") is not the same length as the gff annotation")
 				}
 			}
 		}
@@ -205,81 +327,44 @@ func Variants(msaIn io.Reader, stdin bool, refID string, annoIn io.Reader, annoS
 		// get a list of CDS + intergenic regions from the gff file
 		cdsregions, intregions, err = RegionsFromGFF(gff, refSeqDegapped)
 		if err != nil {
-			return err
+			return AnnotatedMSA{}, err
 		}
+		features = FeaturesFromGFF(gff)
 
 	default:
-		return errors.New("couldn't tell if --annotation was a .gb or a .gff file")
+		return AnnotatedMSA{}, errors.New("couldn't tell if --annotation was a .gb or a .gff file")
 	}
 
-	cVariants := make(chan AnnoStructs, 50+threads)
-	cVariantsDone := make(chan bool)
-	cWriteDone := make(chan bool)
-
-	switch aggregate {
-	case true:
-		go AggregateWriteVariants(out, start, end, appendSNP, appendCodons, threshold, ref.ID, cVariants, cWriteDone, cErr)
-	case false:
-		go WriteVariants(out, start, end, firstmissing, appendSNP, appendCodons, ref.ID, cVariants, cWriteDone, cErr)
-	}
-
-	var wgVariants sync.WaitGroup
-	wgVariants.Add(threads)
-
-	for n := 0; n < threads; n++ {
-		go func() {
-			getVariants(ref, cdsregions, intregions, refToMSA, MSAToRef, cMSA, cVariants, cErr)
-			wgVariants.Done()
-		}()
-	}
-
-	go func() {
-		wgVariants.Wait()
-		cVariantsDone <- true
-	}()
-
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return err
-		case <-cMSADone:
-			close(cMSA)
-			n--
-		}
-	}
-
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return err
-		case <-cVariantsDone:
-			close(cVariants)
-			n--
-		}
-	}
-
-	for n := 1; n > 0; {
-		select {
-		case err := <-cErr:
-			return err
-		case <-cWriteDone:
-			n--
-		}
-	}
-
-	return nil
+	return AnnotatedMSA{
+		Ref:          ref,
+		CDSRegions:   cdsregions,
+		IntRegions:   intregions,
+		Features:     features,
+		RefToMSA:     refToMSA,
+		MSAToRef:     MSAToRef,
+		FirstMissing: firstmissing,
+		Records:      cMSA,
+		Err:          cErr,
+		Done:         cMSADone,
+	}, nil
 }
 
 // findReference gets the reference sequence from the msa if it is in there.
 // If it isn't, we will try get it from the annotation (in which case there can
-// be no insertions relative to the reference in the msa)
+// be no insertions relative to the reference in the msa). The msa can be in fasta
+// or pack format
 func findReference(msaIn io.Reader, referenceID string) (fasta.EncodedRecord, error) {
 
 	var err error
 
+	br := bufio.NewReader(msaIn)
+	if fasta.IsPack(br) {
+		return findReferencePack(br, referenceID)
+	}
+
 	coding := encoding.MakeEncodingArray()
 
-	s := bufio.NewScanner(msaIn)
+	s := bufio.NewScanner(br)
 	s.Buffer(make([]byte, 0), 1024*1024)
 
 	first := true
@@ -363,12 +448,42 @@ func findReference(msaIn io.Reader, referenceID string) (fasta.EncodedRecord, er
 	return refRec, nil
 }
 
+// findReferencePack is findReference for an msa in pack format
+func findReferencePack(msaIn io.Reader, referenceID string) (fasta.EncodedRecord, error) {
+
+	cEFR := make(chan fasta.EncodedRecord)
+	cErr := make(chan error)
+	cDone := make(chan bool)
+
+	go fasta.StreamEncodeAlignment(msaIn, cEFR, cErr, cDone, false, false, false)
+
+	var refRec fasta.EncodedRecord
+	refFound := false
+
+	for {
+		select {
+		case EFR := <-cEFR:
+			if EFR.ID == referenceID && !refFound {
+				refRec = EFR
+				refFound = true
+			}
+		case err := <-cErr:
+			return fasta.EncodedRecord{}, err
+		case <-cDone:
+			if !refFound {
+				return refRec, errors.New("Couldn't find reference (" + referenceID + ") in msa")
+			}
+			return refRec, nil
+		}
+	}
+}
+
 func RegionsFromGFF(anno gff.GFF, refSeqDegapped string) ([]Region, []int, error) {
 
 	IDed := make(map[string][]gff.Feature)
 	other := make([]gff.Feature, 0)
 	for _, f := range anno.Features {
-		if !(f.Type == "CDS" || f.Type == "mature_protein_region_of_CDS") {
+		if !isCodingGFFType(f.Type) {
 			continue
 		}
 		if f.HasAttribute("ID") {
@@ -419,10 +534,22 @@ func RegionsFromGFF(anno gff.GFF, refSeqDegapped string) ([]Region, []int, error
 	return cds, inter, nil
 }
 
+// isCodingGFFType returns true if a gff feature of type t is a CDS or a mature protein region of one
+func isCodingGFFType(t string) bool {
+	switch t {
+	case "CDS", "mature_protein_region", "mature_protein_region_of_CDS":
+		return true
+	}
+	return false
+}
+
 func CDSRegionfromGFF(fs []gff.Feature, refSeqDegapped string) (Region, error) {
 	r := Region{
 		Whichtype: "protein-coding",
 	}
+	if fs[0].Type != "CDS" {
+		r.Whichtype = "mature-peptide"
+	}
 	// TO DO - check that all CDS features in this group have the same "Name"
 	// attribute (or none at all). At the moment only the first CDS line's Name
 	// is used
@@ -486,7 +613,9 @@ func CDSRegionfromGFF(fs []gff.Feature, refSeqDegapped string) (Region, error) {
 }
 
 // Parses a genbank flat format file of genome annotations to extract information about the
-// the positions of CDS and intergenic regions, in order to annotate mutations within each
+// the positions of CDS and intergenic regions, in order to annotate mutations within each.
+// mat_peptide features are protein-coding regions too, after the CDSs, so that amino acid changes
+// in a polyprotein are also reported in the coordinates of its mature peptides
 func RegionsFromGenbank(gb genbank.Genbank, refLength int) ([]Region, []int, error) {
 
 	cds := make([]Region, 0)
@@ -499,6 +628,15 @@ func RegionsFromGenbank(gb genbank.Genbank, refLength int) ([]Region, []int, err
 			cds = append(cds, REGION)
 		}
 	}
+	for _, f := range gb.FEATURES {
+		if f.Feature == "mat_peptide" {
+			REGION, err := MatPeptideRegionfromGenbank(f, gb.ORIGIN)
+			if err != nil {
+				return []Region{}, []int{}, err
+			}
+			cds = append(cds, REGION)
+		}
+	}
 
 	// Get a slice of the intergenic regions
 	inter := codes(cds, refLength)
@@ -549,6 +687,152 @@ func CDSRegionfromGenbank(f genbank.GenbankFeature) (Region, error) {
 	return r, nil
 }
 
+// MatPeptideRegionfromGenbank makes a protein-coding region from a genbank mat_peptide feature, translating it
+// from the record's sequence, origin. It is named by its standard_name if it has one, or else by the first part of
+// its note if that is one word (which is where, for example, NC_045512.2 has the nsp numbers), or else by its product
+func MatPeptideRegionfromGenbank(f genbank.GenbankFeature, origin []byte) (Region, error) {
+
+	r := Region{
+		Whichtype: "mature-peptide",
+		Name:      matPeptideName(f),
+	}
+
+	positions, err := f.Location.GetPositions()
+	if err != nil {
+		return Region{}, err
+	}
+	if len(positions)%3 != 0 {
+		return Region{}, alphabet.ErrorCDSNotModThree
+	}
+	r.Positions = positions
+	r.Start = gmin(r.Positions)
+	r.Stop = gmax(r.Positions)
+	if r.Stop > len(origin) {
+		return Region{}, errors.New("mat_peptide " + r.Name + " is outside the genbank record's sequence")
+	}
+
+	reverse, err := f.Location.IsReverse()
+	if err != nil {
+		return Region{}, err
+	}
+	if reverse {
+		r.Strand = -1
+	} else {
+		r.Strand = 1
+	}
+
+	seq := make([]byte, len(r.Positions))
+	for i, p := range r.Positions {
+		seq[i] = origin[p-1]
+	}
+	nucs := strings.ToUpper(string(seq))
+	if reverse {
+		nucs = alphabet.Complement(nucs)
+	}
+	r.Translation, err = alphabet.Translate(nucs, false)
+	if err != nil {
+		return Region{}, err
+	}
+
+	return r, nil
+}
+
+func matPeptideName(f genbank.GenbankFeature) string {
+	if f.HasAttribute("standard_name") {
+		return f.Info["standard_name"]
+	}
+	if f.HasAttribute("note") {
+		first := strings.TrimSpace(strings.Split(f.Info["note"], ";")[0])
+		if first != "" && len(strings.Fields(first)) == 1 {
+			return first
+		}
+	}
+	if f.HasAttribute("product") {
+		return f.Info["product"]
+	}
+	return f.Info["gene"]
+}
+
+// FeaturesFromGenbank returns the named features in a genbank record that aren't protein-coding (genes, UTRs, stem
+// loops and so on), which NameFeatures uses to give some context to changes outside coding sequence. Each one is named
+// by its standard_name, gene or product, or otherwise by its type. Features whose location can't be parsed are left out.
+func FeaturesFromGenbank(gb genbank.Genbank) []Region {
+
+	features := make([]Region, 0)
+	for _, f := range gb.FEATURES {
+		switch f.Feature {
+		case "source", "CDS", "mat_peptide", "sig_peptide", "transit_peptide":
+			continue
+		}
+		positions, err := f.Location.GetPositions()
+		if err != nil || len(positions) == 0 {
+			continue
+		}
+		name := f.Feature
+		for _, tag := range []string{"standard_name", "gene", "product"} {
+			if f.HasAttribute(tag) {
+				name = f.Info[tag]
+				break
+			}
+		}
+		features = append(features, Region{Whichtype: f.Feature, Name: name, Start: gmin(positions), Stop: gmax(positions)})
+	}
+
+	return features
+}
+
+// FeaturesFromGFF returns the features in a gff annotation that aren't protein-coding (genes, UTRs, stem loops and
+// so on), which NameFeatures uses to give some context to changes outside coding sequence. Each one is named by its
+// Name or gene attribute, or otherwise by its type.
+func FeaturesFromGFF(anno gff.GFF) []Region {
+
+	features := make([]Region, 0)
+	for _, f := range anno.Features {
+		if isCodingGFFType(f.Type) || f.Type == "region" {
+			continue
+		}
+		name := f.Type
+		for _, tag := range []string{"Name", "gene"} {
+			if f.HasAttribute(tag) {
+				name = f.Attributes[tag][0]
+				break
+			}
+		}
+		features = append(features, Region{Whichtype: f.Type, Name: name, Start: f.Start, Stop: f.End})
+	}
+
+	return features
+}
+
+// NameFeatures sets the Feature of each change in vs that is outside coding sequence (a UTR or intergenic nucleotide
+// change or indel) to the name of the shortest of features that it is in, if it is in any
+func NameFeatures(vs []Variant, features []Region) {
+
+	for i, v := range vs {
+		switch v.Consequence {
+		case FivePrimeUTRVariant, ThreePrimeUTRVariant, IntergenicVariant:
+		default:
+			continue
+		}
+		best := -1
+		for j, f := range features {
+			if v.Position < f.Start || v.Position > f.Stop {
+				continue
+			}
+			// an insertion is between v.Position and the next base, so it isn't in a feature that ends at v.Position
+			if v.Changetype == "ins" && v.Position == f.Stop {
+				continue
+			}
+			if best == -1 || f.Stop-f.Start < features[best].Stop-features[best].Start {
+				best = j
+			}
+		}
+		if best != -1 {
+			vs[i].Feature = features[best].Name
+		}
+	}
+}
+
 // get a single slice of intergenic positions after parsing genbank or gff for protein-coding regions
 // TO DO - return it in MSA coordinates?
 // TO DO - just give it the length of the reference sequence?
@@ -634,7 +918,7 @@ func GetMSAOffsets(refseq []byte) ([]int, []int) {
 // getVariants annotates mutations between query and reference sequences, one
 // fasta record at a time. It reads each fasta record from a channel and passes
 // all its mutations grouped together in one struct to another channel.
-func getVariants(ref fasta.EncodedRecord, cdsregions []Region, intregions []int, offsetRefCoord []int, offsetMSACoord []int, cMSA chan fasta.EncodedRecord, cVariants chan AnnoStructs, cErr chan error) {
+func getVariants(ref fasta.EncodedRecord, cdsregions []Region, intregions []int, features []Region, offsetRefCoord []int, offsetMSACoord []int, cMSA chan fasta.EncodedRecord, cVariants chan AnnoStructs, cErr chan error) {
 
 	for record := range cMSA {
 
@@ -648,6 +932,7 @@ func getVariants(ref fasta.EncodedRecord, cdsregions []Region, intregions []int,
 			cErr <- err
 			break
 		}
+		NameFeatures(AS.Vs, features)
 
 		cVariants <- AS
 	}
@@ -658,7 +943,13 @@ func GetVariantsPair(ref, query []byte, refID, queryID string, idx int, cdsregio
 	AS := AnnoStructs{}
 
 	indels := getIndelsPair(ref, query, offsetRefCoord, offsetMSACoord)
+	for i := range indels {
+		indels[i].Consequence = IndelConsequence(indels[i], cdsregions)
+	}
 	nucs := getNucsPair(ref, query, intregions, offsetRefCoord, offsetMSACoord)
+	for i := range nucs {
+		nucs[i].Consequence = noncodingConsequence(nucs[i].Position, cdsregions)
+	}
 	AAs := make([]Variant, 0)
 	for _, r := range cdsregions {
 		AAs = append(AAs, getAAsPair(ref, query, r, offsetRefCoord, offsetMSACoord)...)
@@ -698,14 +989,17 @@ func GetVariantsPair(ref, query []byte, refID, queryID string, idx int, cdsregio
 	}
 
 	// and we're done
-	AS = AnnoStructs{Queryname: queryID, Vs: finalVariants, Idx: idx}
+	AS = AnnoStructs{Queryname: queryID, Refname: refID, Vs: finalVariants, Missing: getMissingPair(query, offsetRefCoord), Idx: idx}
 
 	return AS, nil
 }
 
 // FormatVariant returns a string representation of a single mutation, the format
-// of which varies given its type (aa/nuc/indel)
-func FormatVariant(v Variant, appendSNP bool, appendCodons bool) (string, error) {
+// of which varies given its type (aa/nuc/indel). Only the Append options in o are used.
+// If o.AppendConsequence is true, the mutation's functional consequence is given in
+// parenthesis after it (with the name of the feature it is in, for a change outside
+// coding sequence, see NameFeatures)
+func FormatVariant(v Variant, o Options) (string, error) {
 	var s string
 
 	switch v.Changetype {
@@ -715,25 +1009,45 @@ func FormatVariant(v Variant, appendSNP bool, appendCodons bool) (string, error)
 		s = "ins:" + strconv.Itoa(v.Position) + ":" + strconv.Itoa(v.Length)
 	case "nuc":
 		s = "nuc:" + v.RefAl + strconv.Itoa(v.Position) + v.QueAl
+	case "aadel":
+		s = "aa:" + v.Feature + ":del" + strconv.Itoa(v.Residue)
+		if v.Length > 1 {
+			s = s + "-" + strconv.Itoa(v.Residue+v.Length-1)
+		}
+		if o.AppendSNP {
+			s = s + "(" + v.SNPs + ")"
+		}
+	case "aains":
+		s = "aa:" + v.Feature + ":ins" + strconv.Itoa(v.Residue) + v.QueAl
+		if o.AppendSNP {
+			s = s + "(" + v.SNPs + ")"
+		}
 	case "aa":
-		if appendSNP && appendCodons {
-			s = "aa:" + v.Feature + ":" + v.RefAl + strconv.Itoa(v.Residue) + v.QueAl + "(" + v.SNPs + ")" + "(ref:" + v.RefCodon + "-alt:" + v.QueCodon + ")"
-		} else if appendSNP {
-			s = "aa:" + v.Feature + ":" + v.RefAl + strconv.Itoa(v.Residue) + v.QueAl + "(" + v.SNPs + ")"
-		} else if appendCodons {
-			s = "aa:" + v.Feature + ":" + v.RefAl + strconv.Itoa(v.Residue) + v.QueAl + "(ref:" + v.RefCodon + "-alt:" + v.QueCodon + ")"
-		} else {
-			s = "aa:" + v.Feature + ":" + v.RefAl + strconv.Itoa(v.Residue) + v.QueAl
+		s = "aa:" + v.Feature + ":" + v.RefAl + strconv.Itoa(v.Residue) + v.QueAl
+		if o.AppendSNP {
+			s = s + "(" + v.SNPs + ")"
+		}
+		if o.AppendCodons {
+			s = s + "(ref:" + v.RefCodon + "-alt:" + v.QueCodon + ")"
 		}
 	default:
 		return "", errors.New("couldn't parse variant type")
 	}
 
+	if o.AppendConsequence && v.Consequence != "" {
+		switch {
+		case (v.Changetype == "nuc" || v.Changetype == "ins" || v.Changetype == "del") && v.Feature != "":
+			s = s + "(" + v.Consequence + ":" + v.Feature + ")"
+		default:
+			s = s + "(" + v.Consequence + ")"
+		}
+	}
+
 	return s, nil
 }
 
-// WriteVariants writes each query's mutations to file or stdout
-func WriteVariants(w io.Writer, start, end int, firstmissing bool, appendSNP bool, appendCodons bool, refID string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
+// WriteVariants writes each query's mutations to file or stdout, as given by o
+func WriteVariants(w io.Writer, o Options, firstmissing bool, refID string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
 
 	outputMap := make(map[int]AnnoStructs)
 
@@ -773,12 +1087,12 @@ func WriteVariants(w io.Writer, start, end int, firstmissing bool, appendSNP boo
 				}
 				sa = make([]string, 0)
 				for _, v := range VL.Vs {
-					if start > 0 && end > 0 {
-						if v.Position < start || v.Position > end {
+					if o.Start > 0 && o.End > 0 {
+						if v.Position < o.Start || v.Position > o.End {
 							continue
 						}
 					}
-					newVar, err := FormatVariant(v, appendSNP, appendCodons)
+					newVar, err := FormatVariant(v, o)
 					if err != nil {
 						cErr <- err
 						return
@@ -804,8 +1118,8 @@ func WriteVariants(w io.Writer, start, end int, firstmissing bool, appendSNP boo
 }
 
 // AggregateWriteOutput aggregates the mutations that are present greater than
-// or equal to threshold, and writes their frequencies to file or stdout
-func AggregateWriteVariants(w io.Writer, start, end int, appendSNP bool, appendCodons bool, threshold float64, refID string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
+// or equal to o.Threshold, and writes their frequencies to file or stdout
+func AggregateWriteVariants(w io.Writer, o Options, refID string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
 
 	propMap := make(map[Variant]float64)
 
@@ -825,17 +1139,22 @@ func AggregateWriteVariants(w io.Writer, start, end int, appendSNP bool, appendC
 		}
 		counter++
 		for _, v := range AS.Vs {
-			if start > 0 && end > 0 {
-				if v.Position < start || v.Position > end {
+			if o.Start > 0 && o.End > 0 {
+				if v.Position < o.Start || v.Position > o.End {
 					continue
 				}
 			}
-			rep, err := FormatVariant(v, appendSNP, appendCodons)
+			rep, err := FormatVariant(v, o)
 			if err != nil {
 				cErr <- err
 				return
 			}
-			Vskinny := Variant{RefAl: v.RefAl, QueAl: v.QueAl, Position: v.Position, Residue: v.Residue, Changetype: v.Changetype, Feature: v.Feature, Length: v.Length, Representation: rep}
+			// insertions of the same length at the same position are aggregated regardless of their sequence
+			queAl := v.QueAl
+			if v.Changetype == "ins" {
+				queAl = ""
+			}
+			Vskinny := Variant{RefAl: v.RefAl, QueAl: queAl, Position: v.Position, Residue: v.Residue, Changetype: v.Changetype, Feature: v.Feature, Length: v.Length, Representation: rep}
 			propMap[Vskinny]++
 		}
 	}
@@ -850,7 +1169,7 @@ func AggregateWriteVariants(w io.Writer, start, end int, appendSNP bool, appendC
 	})
 
 	for _, V := range order {
-		if propMap[V]/counter < threshold {
+		if propMap[V]/counter < o.Threshold {
 			continue
 		}
 		_, err = w.Write([]byte(V.Representation + "," + strconv.FormatFloat(propMap[V]/counter, 'f', 9, 64) + "\n"))
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+
+	"github.com/virus-evolution/gofasta/pkg/fasta"
 )
 
 func TestVariants(t *testing.T) {
@@ -23,7 +25,7 @@ ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAACCAACTTTCGATCTCTTGTAGATCTGTTCTCTAAACGAACTTTAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(msa, false, "", genbankReader, "gb", out, -1, -1, false, 0.0, false, 1)
+	err := Variants(msa, false, "", genbankReader, "gb", out, Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -56,7 +58,7 @@ ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAACCAACTTTCGATCTCTTGTAGATCTGTTCTCTAAACGAACTTTAA
 
 	out = new(bytes.Buffer)
 
-	err = Variants(msaRef, false, "MN908947.3", genbankReader, "gb", out, -1, -1, false, 0.0, false, 1)
+	err = Variants(msaRef, false, "MN908947.3", genbankReader, "gb", out, Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -76,7 +78,7 @@ aa:ORF7a:A8K,aa:ORF7a:A8K
 
 	out = new(bytes.Buffer)
 
-	err = Variants(msa, false, "", gffReader, "gff", out, -1, -1, false, 0.0, false, 1)
+	err = Variants(msa, false, "", gffReader, "gff", out, Options{}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -109,7 +111,7 @@ ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAACCAACTTTCGATCTCTTGTAGATCTGTTCTCTAAACGAACTTTAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(msa, false, "", genbankReader, "gb", out, -1, -1, false, 0.0, true, 1)
+	err := Variants(msa, false, "", genbankReader, "gb", out, Options{AppendSNP: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -129,7 +131,7 @@ aa:ORF7a:A8K,aa:ORF7a:A8K(nuc:G27415A;nuc:C27416A;nuc:A27417G)
 
 	out = new(bytes.Buffer)
 
-	err = Variants(msa, false, "", gffReader, "gff", out, -1, -1, false, 0.0, true, 1)
+	err = Variants(msa, false, "", gffReader, "gff", out, Options{AppendSNP: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -166,7 +168,7 @@ ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAACCAACTTTCGATCTCTTGTAGATCTGTTCTCTAAACGAACTTTAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(msa, false, "", genbankReader, "gb", out, -1, -1, true, 0.0, false, 1)
+	err := Variants(msa, false, "", genbankReader, "gb", out, Options{Aggregate: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -185,7 +187,7 @@ aa:ORF7a:A8K,0.500000000
 
 	out = new(bytes.Buffer)
 
-	err = Variants(msa, false, "", gffReader, "gff", out, -1, -1, true, 0.0, false, 1)
+	err = Variants(msa, false, "", gffReader, "gff", out, Options{Aggregate: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -221,7 +223,7 @@ ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAACCAACTTTCGATCTCTTGTAGATCTGTTCTCTAAACGAACTTTAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(msa, false, "", genbankReader, "gb", out, -1, -1, true, 0.0, true, 1)
+	err := Variants(msa, false, "", genbankReader, "gb", out, Options{Aggregate: true, AppendSNP: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -240,7 +242,7 @@ aa:ORF7a:A8K(nuc:G27415A;nuc:C27416A;nuc:A27417G),0.500000000
 
 	out = new(bytes.Buffer)
 
-	err = Variants(msa, false, "", gffReader, "gff", out, -1, -1, true, 0.0, true, 1)
+	err = Variants(msa, false, "", gffReader, "gff", out, Options{Aggregate: true, AppendSNP: true}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -276,7 +278,7 @@ ATTAAAGGTTTATACCTTCCCAGGTAACAAACCAACCAACTTTCGATCTCTTGTAGATCTGTTCTCTAAACGAACTTTAA
 
 	out := new(bytes.Buffer)
 
-	err := Variants(msa, false, "", genbankReader, "gb", out, -1, -1, true, 0.5, false, 1)
+	err := Variants(msa, false, "", genbankReader, "gb", out, Options{Aggregate: true, Threshold: 0.5}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -293,7 +295,7 @@ aa:ORF7a:A8K,0.500000000
 
 	out = new(bytes.Buffer)
 
-	err = Variants(msa, false, "", gffReader, "gff", out, -1, -1, true, 0.5, false, 1)
+	err = Variants(msa, false, "", gffReader, "gff", out, Options{Aggregate: true, Threshold: 0.5}, 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -1502,3 +1504,42 @@ ACAGTGAACAATGCTAGGGAGAGCTGCCTATATGGAAGAGCCCTAATGTGTAAAATTAATTTTAGTAGTGCTATCCCCAT
 GTGATTTTAATAGCTTCTTAGGAGAATGACAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA
 `)
 }
+
+// a pack file gives the same variants as the fasta alignment it was made from, with the reference found in it
+func TestVariantsPack(t *testing.T) {
+	msaData := []byte(`>seq1
+ATGTAATGATGATGTAG-AAAATA
+>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq2
+ACGTA---ATGATGTAGCAAAAAA
+`)
+
+	pack := new(bytes.Buffer)
+	err := fasta.PackAlignment(bytes.NewReader(msaData), pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := new(bytes.Buffer)
+	err = Variants(bytes.NewReader(msaData), false, "reference", bytes.NewReader(genbankDataShort), "gb", want, Options{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	err = Variants(bytes.NewReader(pack.Bytes()), false, "reference", bytes.NewReader(genbankDataShort), "gb", out, Options{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != want.String() || len(out.String()) == 0 {
+		t.Errorf("problem in TestVariantsPack")
+		t.Error(out.String())
+	}
+
+	err = Variants(bytes.NewReader(pack.Bytes()), false, "notthere", bytes.NewReader(genbankDataShort), "gb", new(bytes.Buffer), Options{}, 1)
+	if err == nil {
+		t.Errorf("expected an error for a missing reference in TestVariantsPack")
+	}
+}
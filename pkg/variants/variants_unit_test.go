@@ -50,6 +50,111 @@ func TestGetRegionsGenbank(t *testing.T) {
 	}
 }
 
+func TestGetRegionsGenbankMatPeptide(t *testing.T) {
+	gb, err := genbank.ReadGenBank(bytes.NewReader(genbankDataMatPeptide))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cdsregions, intregions, err := RegionsFromGenbank(gb, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredCDSResult := []Region{
+		{Whichtype: "protein-coding", Name: "gene1", Strand: 1, Start: 6, Stop: 17, Translation: "MMM*", Positions: []int{6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}},
+		{Whichtype: "mature-peptide", Name: "p1", Strand: 1, Start: 9, Stop: 14, Translation: "MM", Positions: []int{9, 10, 11, 12, 13, 14}},
+		{Whichtype: "mature-peptide", Name: "second peptide", Strand: 1, Start: 6, Stop: 8, Translation: "M", Positions: []int{6, 7, 8}},
+	}
+	if !reflect.DeepEqual(cdsregions, desiredCDSResult) {
+		t.Errorf("problem in TestGetRegionsGenbankMatPeptide")
+		t.Error(cdsregions)
+	}
+
+	desiredInterResult := []int{1, 2, 3, 4, 5, 18, 19, 20, 21, 22, 23}
+	if !reflect.DeepEqual(intregions, desiredInterResult) {
+		t.Errorf("problem in TestGetRegionsGenbankMatPeptide")
+		t.Error(intregions)
+	}
+
+	// an amino acid change is reported in both the CDS's and the mature peptide's coordinates
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAGAAAAAA
+>seq1
+ACGTAATGAAGATGTAGAAAAAA
+`)
+	alignment, err := fasta.LoadEncodeAlignment(bytes.NewReader(msaData), false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refToMSA, MSAToRef := GetMSAOffsets(alignment[0].Seq)
+	AS, err := GetVariantsPair(alignment[0].Seq, alignment[1].Seq, "reference", "seq1", 1, cdsregions, intregions, refToMSA, MSAToRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := make([]string, 0)
+	for _, v := range AS.Vs {
+		temp, _ := FormatVariant(v, Options{AppendConsequence: true})
+		s = append(s, temp)
+	}
+	desiredResult := []string{"aa:gene1:M2K(missense_variant)", "aa:p1:M1K(missense_variant)"}
+	if !reflect.DeepEqual(s, desiredResult) {
+		t.Errorf("problem in TestGetRegionsGenbankMatPeptide")
+		t.Error(s)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	gb, err := genbank.ReadGenBank(bytes.NewReader(genbankDataShort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := FeaturesFromGenbank(gb)
+	desiredResult := []Region{
+		{Whichtype: "5'UTR", Name: "5'UTR", Start: 1, Stop: 5},
+		{Whichtype: "gene", Name: "gene1", Start: 6, Stop: 17},
+		{Whichtype: "3'UTR", Name: "3'UTR", Start: 18, Stop: 23},
+	}
+	if !reflect.DeepEqual(features, desiredResult) {
+		t.Errorf("problem in TestFeatures (genbank)")
+		t.Error(features)
+	}
+
+	GFF, err := gff.ReadGFF(bytes.NewReader(gffDataShort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	features = FeaturesFromGFF(GFF)
+	desiredResult = []Region{
+		{Whichtype: "five_prime_UTR", Name: "five_prime_UTR", Start: 1, Stop: 5},
+		{Whichtype: "gene", Name: "gene", Start: 6, Stop: 17},
+		{Whichtype: "three_prime_UTR", Name: "three_prime_UTR", Start: 18, Stop: 23},
+	}
+	if !reflect.DeepEqual(features, desiredResult) {
+		t.Errorf("problem in TestFeatures (gff)")
+		t.Error(features)
+	}
+
+	vs := []Variant{
+		{Changetype: "nuc", RefAl: "C", QueAl: "T", Position: 2, Consequence: FivePrimeUTRVariant},
+		{Changetype: "aa", Feature: "gene1", RefAl: "M", QueAl: "L", Position: 6, Residue: 1, Consequence: StartLost},
+		{Changetype: "del", Position: 19, Length: 2, Consequence: ThreePrimeUTRVariant},
+		{Changetype: "nuc", RefAl: "A", QueAl: "T", Position: 30, Consequence: ThreePrimeUTRVariant},
+		{Changetype: "ins", QueAl: "C", Position: 17, Length: 1, Consequence: ThreePrimeUTRVariant},
+	}
+	NameFeatures(vs, FeaturesFromGenbank(gb))
+	s := make([]string, 0)
+	for _, v := range vs {
+		temp, _ := FormatVariant(v, Options{AppendConsequence: true})
+		s = append(s, temp)
+	}
+	desiredStrings := []string{"nuc:C2T(5_prime_UTR_variant:5'UTR)", "aa:gene1:M1L(start_lost)", "del:19:2(3_prime_UTR_variant:3'UTR)", "nuc:A30T(3_prime_UTR_variant)", "ins:17:1(3_prime_UTR_variant)"}
+	if !reflect.DeepEqual(s, desiredStrings) {
+		t.Errorf("problem in TestFeatures (NameFeatures)")
+		t.Error(s)
+	}
+}
+
 func TestGetRegionsGFF(t *testing.T) {
 	gffReader := bytes.NewReader(gffDataShort)
 	GFF, err := gff.ReadGFF(gffReader)
@@ -221,10 +326,10 @@ ACGTAATGATGAG-TAG-TAAA-T
 		t.Error(err)
 	}
 
-	desiredResult := AnnoStructs{Queryname: "seq1", Vs: []Variant{
-		{RefAl: "C", QueAl: "T", Position: 2, Changetype: "nuc"},
-		{RefAl: "M", QueAl: "L", Position: 6, Residue: 1, Changetype: "aa", Feature: "gene1", SNPs: "nuc:A6T"},
-		{RefAl: "A", QueAl: "T", Position: 22, Changetype: "nuc"},
+	desiredResult := AnnoStructs{Queryname: "seq1", Refname: "reference", Vs: []Variant{
+		{RefAl: "C", QueAl: "T", Position: 2, Changetype: "nuc", Consequence: FivePrimeUTRVariant},
+		{RefAl: "M", QueAl: "L", Position: 6, Residue: 1, Changetype: "aa", Feature: "gene1", SNPs: "nuc:A6T", RefCodon: "ATG", QueCodon: "TTG", Consequence: StartLost},
+		{RefAl: "A", QueAl: "T", Position: 22, Changetype: "nuc", Consequence: ThreePrimeUTRVariant},
 	}, Idx: 1}
 	if !reflect.DeepEqual(mutations, desiredResult) {
 		t.Errorf("problem in TestGetVariantsPair (seq1)")
@@ -236,8 +341,9 @@ ACGTAATGATGAG-TAG-TAAA-T
 		t.Error(err)
 	}
 
-	desiredResult = AnnoStructs{Queryname: "seq2", Vs: []Variant{
-		{Position: 6, Length: 3, Changetype: "del"},
+	desiredResult = AnnoStructs{Queryname: "seq2", Refname: "reference", Vs: []Variant{
+		{RefAl: "M", Position: 6, Residue: 1, Length: 1, Changetype: "aadel", Feature: "gene1", SNPs: "del:6:3", Consequence: InframeDeletion},
+		{Position: 6, Length: 3, Changetype: "del", Consequence: InframeDeletion},
 	}, Idx: 2}
 	if !reflect.DeepEqual(mutations, desiredResult) {
 		t.Errorf("problem in TestGetVariantsPair (seq2)")
@@ -248,8 +354,8 @@ ACGTAATGATGAG-TAG-TAAA-T
 		t.Error(err)
 	}
 
-	desiredResult = AnnoStructs{Queryname: "seq3", Vs: []Variant{
-		{Position: 17, Length: 1, Changetype: "ins"},
+	desiredResult = AnnoStructs{Queryname: "seq3", Refname: "reference", Vs: []Variant{
+		{Position: 17, Length: 1, Changetype: "ins", QueAl: "A", Consequence: ThreePrimeUTRVariant},
 	}, Idx: 3}
 	if !reflect.DeepEqual(mutations, desiredResult) {
 		t.Errorf("problem in TestGetVariantsPair (seq3)")
@@ -260,12 +366,12 @@ ACGTAATGATGAG-TAG-TAAA-T
 		t.Error(err)
 	}
 
-	desiredResult = AnnoStructs{Queryname: "seq4", Vs: []Variant{
-		{Position: 13, RefAl: "T", QueAl: "G", Changetype: "nuc"},
-		{Position: 14, Length: 1, Changetype: "del"},
-		{Position: 18, RefAl: "A", QueAl: "T", Changetype: "nuc"},
-		{Position: 22, Length: 1, Changetype: "del"},
-		{Position: 23, RefAl: "A", QueAl: "T", Changetype: "nuc"},
+	desiredResult = AnnoStructs{Queryname: "seq4", Refname: "reference", Vs: []Variant{
+		{Position: 13, RefAl: "T", QueAl: "G", Changetype: "nuc", Consequence: CodingSequenceVariant},
+		{Position: 14, Length: 1, Changetype: "del", Consequence: FrameshiftVariant},
+		{Position: 18, RefAl: "A", QueAl: "T", Changetype: "nuc", Consequence: ThreePrimeUTRVariant},
+		{Position: 22, Length: 1, Changetype: "del", Consequence: ThreePrimeUTRVariant},
+		{Position: 23, RefAl: "A", QueAl: "T", Changetype: "nuc", Consequence: ThreePrimeUTRVariant},
 	}, Idx: 4}
 	if !reflect.DeepEqual(mutations, desiredResult) {
 		t.Errorf("problem in TestGetVariantsPair (seq4)")
@@ -328,7 +434,7 @@ ACGTAATGATGAG-TAG-TAAA-T
 	*/
 	desiredResult := []string{"nuc:C2T", "aa:gene1:M1L", "nuc:A22T"}
 	for i, mutation := range mutations.Vs {
-		mut, err := FormatVariant(mutation, false)
+		mut, err := FormatVariant(mutation, Options{})
 		if err != nil {
 			t.Error(err)
 		}
@@ -339,7 +445,7 @@ ACGTAATGATGAG-TAG-TAAA-T
 
 	desiredResult = []string{"nuc:C2T", "aa:gene1:M1L(nuc:A6T)", "nuc:A22T"}
 	for i, mutation := range mutations.Vs {
-		mut, err := FormatVariant(mutation, true)
+		mut, err := FormatVariant(mutation, Options{AppendSNP: true})
 		if err != nil {
 			t.Error(err)
 		}
@@ -355,7 +461,7 @@ ACGTAATGATGAG-TAG-TAAA-T
 
 	desiredResult = []string{"nuc:T13G", "del:14:1", "nuc:A18T", "del:22:1", "nuc:A23T"}
 	for i, mutation := range mutations.Vs {
-		mut, err := FormatVariant(mutation, false)
+		mut, err := FormatVariant(mutation, Options{})
 		if err != nil {
 			t.Error(err)
 		}
@@ -363,9 +469,21 @@ ACGTAATGATGAG-TAG-TAAA-T
 			t.Errorf("problem in TestFormatVariant 3")
 		}
 	}
+
+	desiredResult = []string{"nuc:T13G(coding_sequence_variant)", "del:14:1(frameshift_variant)", "nuc:A18T(3_prime_UTR_variant)", "del:22:1(3_prime_UTR_variant)", "nuc:A23T(3_prime_UTR_variant)"}
+	for i, mutation := range mutations.Vs {
+		mut, err := FormatVariant(mutation, Options{AppendConsequence: true})
+		if err != nil {
+			t.Error(err)
+		}
+		if mut != desiredResult[i] {
+			t.Errorf("problem in TestFormatVariant 4")
+		}
+	}
 }
 
 var genbankDataShort []byte
+var genbankDataMatPeptide []byte
 var gffDataShort []byte
 var gffDataShortRev []byte
 
@@ -386,6 +504,26 @@ ORIGIN
 		1 acgtaatgat gatgtagaaa aaa 
 `)
 
+	genbankDataMatPeptide = []byte(`LOCUS       TEST               23 bp ss-RNA     linear   VRL 21-MAR-1987
+FEATURES             Location/Qualifiers
+		source          1..23
+						/organism="Not a real organism"
+		CDS             6..17
+						/gene="gene1"
+						/codon_start=1
+						/translation="MMM"
+		mat_peptide     9..14
+						/gene="gene1"
+						/product="first peptide"
+						/note="p1; a one-word note"
+		mat_peptide     6..8
+						/gene="gene1"
+						/product="second peptide"
+						/note="a longer note"
+ORIGIN      
+		1 acgtaatgat gatgtagaaa aaa 
+`)
+
 	gffDataShort = []byte(`##gff-version 3
 ##sequence-region somefakething 1 23
 somefakething	RefSeq	region	1	23	.	+	.	ID=somefakething:1..23
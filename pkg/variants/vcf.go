@@ -0,0 +1,539 @@
+package variants
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// vcfAllele is one alternate allele at a vcfSite
+type vcfAllele struct {
+	alt        string
+	changetype string
+	aas        []string // the amino acid consequence(s) of this allele, if any
+	count      int
+}
+
+// vcfSite is one line of a vcf file. Sites are keyed on position, reference allele and
+// the class of change (snp/ins/del) so that each sample contributes at most one allele per site
+type vcfSite struct {
+	pos     int
+	ref     string
+	class   string
+	alleles []vcfAllele
+}
+
+// vcfRecord is one reference-anchored allele derived from a Variant
+type vcfRecord struct {
+	pos   int
+	ref   string
+	alt   string
+	class string
+	aa    string
+}
+
+func (r vcfRecord) key() string {
+	return strconv.Itoa(r.pos) + ":" + r.ref + ":" + r.class
+}
+
+// parseSNPs parses the ";"-delimited nucleotide changes in an amino acid Variant's SNPs field
+// (as written by getAAsPair) back to nuc Variants. Indels (for amino acid changes at in-frame indels)
+// are skipped, because they are Variants of their own
+func parseSNPs(s string) ([]Variant, error) {
+	snps := make([]Variant, 0)
+	if len(s) == 0 {
+		return snps, nil
+	}
+	for _, snp := range strings.Split(s, ";") {
+		if strings.HasPrefix(snp, "ins:") || strings.HasPrefix(snp, "del:") {
+			continue
+		}
+		snp = strings.TrimPrefix(snp, "nuc:")
+		if len(snp) < 3 {
+			return []Variant{}, errors.New("couldn't parse snp from amino acid change: " + snp)
+		}
+		pos, err := strconv.Atoi(snp[1 : len(snp)-1])
+		if err != nil {
+			return []Variant{}, errors.New("couldn't parse snp from amino acid change: " + snp)
+		}
+		snps = append(snps, Variant{Changetype: "nuc", RefAl: snp[:1], QueAl: snp[len(snp)-1:], Position: pos})
+	}
+	return snps, nil
+}
+
+// isACGT returns true if every character in s is one of {A,C,G,T}
+func isACGT(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 'A', 'C', 'G', 'T':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// vcfRecordsFromVariant converts one Variant to zero or more reference-anchored vcf alleles, given the
+// (degapped) reference sequence. Indels are left-anchored on the preceding reference base (or right-anchored
+// if they abut the start of the reference). Nucleotide changes to ambiguous bases are not represented. Amino
+// acid insertions and deletions give records with an empty alt allele, which only carry their amino acid change
+// to the query's nucleotide indel at the same site.
+func vcfRecordsFromVariant(v Variant, refSeq string) ([]vcfRecord, error) {
+
+	records := make([]vcfRecord, 0)
+
+	switch v.Changetype {
+	case "nuc":
+		if v.Position < 1 || v.Position > len(refSeq) {
+			return records, errors.New("variant position is outside the reference sequence: " + strconv.Itoa(v.Position))
+		}
+		if !isACGT(v.QueAl) {
+			return records, nil
+		}
+		records = append(records, vcfRecord{pos: v.Position, ref: refSeq[v.Position-1 : v.Position], alt: v.QueAl, class: "snp"})
+
+	case "aa":
+		snps, err := parseSNPs(v.SNPs)
+		if err != nil {
+			return records, err
+		}
+		aa := v.Feature + ":" + v.RefAl + strconv.Itoa(v.Residue) + v.QueAl
+		for _, snp := range snps {
+			temp, err := vcfRecordsFromVariant(snp, refSeq)
+			if err != nil {
+				return records, err
+			}
+			for i := range temp {
+				temp[i].aa = aa
+			}
+			records = append(records, temp...)
+		}
+
+	case "del":
+		// v.Position is the first deleted base
+		if v.Position < 1 || v.Position+v.Length-1 > len(refSeq) {
+			return records, errors.New("deletion is outside the reference sequence: " + strconv.Itoa(v.Position))
+		}
+		if v.Position == 1 {
+			if v.Length >= len(refSeq) {
+				return records, nil
+			}
+			records = append(records, vcfRecord{pos: 1, ref: refSeq[0 : v.Length+1], alt: refSeq[v.Length : v.Length+1], class: "del"})
+		} else {
+			records = append(records, vcfRecord{pos: v.Position - 1, ref: refSeq[v.Position-2 : v.Position+v.Length-1], alt: refSeq[v.Position-2 : v.Position-1], class: "del"})
+		}
+
+	case "ins":
+		// v.Position is the reference base immediately 5' of the insertion
+		ins := []byte(v.QueAl)
+		for i := range ins {
+			switch ins[i] {
+			case 'A', 'C', 'G', 'T':
+			default:
+				ins[i] = 'N'
+			}
+		}
+		pos := v.Position
+		if pos > len(refSeq) {
+			pos = len(refSeq)
+		}
+		if pos < 1 {
+			records = append(records, vcfRecord{pos: 1, ref: refSeq[0:1], alt: string(ins) + refSeq[0:1], class: "ins"})
+		} else {
+			records = append(records, vcfRecord{pos: pos, ref: refSeq[pos-1 : pos], alt: refSeq[pos-1:pos] + string(ins), class: "ins"})
+		}
+
+	case "aadel", "aains":
+		// the nucleotide indel that these come from is its own Variant, so they only annotate its record. The
+		// inserted bases of an insertion aren't in the SNPs field, so the alt allele is left empty, to be filled
+		// in from the query's own allele at the site by CollectVCF
+		aa, err := FormatVariant(v, Options{})
+		if err != nil {
+			return records, err
+		}
+		aa = strings.TrimPrefix(aa, "aa:")
+		for _, indel := range strings.Split(v.SNPs, ";") {
+			if !strings.HasPrefix(indel, "ins:") && !strings.HasPrefix(indel, "del:") {
+				continue
+			}
+			fields := strings.Split(indel, ":")
+			if len(fields) != 3 {
+				return records, errors.New("couldn't parse indel from amino acid change: " + indel)
+			}
+			pos, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return records, errors.New("couldn't parse indel from amino acid change: " + indel)
+			}
+			length, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return records, errors.New("couldn't parse indel from amino acid change: " + indel)
+			}
+			temp, err := vcfRecordsFromVariant(Variant{Changetype: fields[0], Position: pos, Length: length}, refSeq)
+			if err != nil {
+				return records, err
+			}
+			for i := range temp {
+				temp[i].alt = ""
+				temp[i].aa = aa
+			}
+			records = append(records, temp...)
+		}
+
+	default:
+		return records, errors.New("couldn't parse variant type")
+	}
+
+	return records, nil
+}
+
+// addRecord adds one allele to a map of vcf sites, or increments its count if it is already present. If isNew is
+// false, the query has already been counted for this allele (such as for an amino acid change in another, overlapping,
+// feature), so only its amino acid consequence is added
+func addRecord(sites map[string]*vcfSite, r vcfRecord, isNew bool) {
+
+	site, ok := sites[r.key()]
+	if !ok {
+		site = &vcfSite{pos: r.pos, ref: r.ref, class: r.class}
+		sites[r.key()] = site
+	}
+
+	for i := range site.alleles {
+		if site.alleles[i].alt == r.alt {
+			if isNew {
+				site.alleles[i].count++
+			}
+			if r.aa != "" && !contains(site.alleles[i].aas, r.aa) {
+				site.alleles[i].aas = append(site.alleles[i].aas, r.aa)
+			}
+			return
+		}
+	}
+
+	allele := vcfAllele{alt: r.alt, changetype: r.class, count: 1}
+	if r.aa != "" {
+		allele.aas = []string{r.aa}
+	}
+	site.alleles = append(site.alleles, allele)
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedSites returns the values of a map of vcf sites in genomic order
+func sortedSites(sites map[string]*vcfSite) []*vcfSite {
+
+	order := make([]*vcfSite, 0, len(sites))
+	for _, site := range sites {
+		order = append(order, site)
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].pos < order[j].pos || (order[i].pos == order[j].pos && order[i].class < order[j].class) || (order[i].pos == order[j].pos && order[i].class == order[j].class && order[i].ref < order[j].ref)
+	})
+
+	for _, site := range order {
+		sort.SliceStable(site.alleles, func(i, j int) bool {
+			return site.alleles[i].alt < site.alleles[j].alt
+		})
+	}
+
+	return order
+}
+
+// vcfQuery is one query's alleles at the sites of a VCFContig, and where it has missing data
+type vcfQuery struct {
+	name    string
+	idx     int
+	alts    map[string]string // the alternate allele at each site that the query has one at, by site key
+	missing [][2]int          // see AnnoStructs
+}
+
+// A VCFContig is the variants in a set of queries relative to one reference sequence, collected by CollectVCF
+// for writing to a vcf file with WriteVCFContigs
+type VCFContig struct {
+	refID   string
+	refLen  int
+	sites   map[string]*vcfSite
+	queries []vcfQuery // in input order
+}
+
+// CollectVCF collects the queries' variants from cVariants (between start and end, if they are both set) into
+// vcf sites, until it is closed
+func CollectVCF(start, end int, refID string, refSeq string, cVariants chan AnnoStructs) (VCFContig, error) {
+
+	contig := VCFContig{refID: refID, refLen: len(refSeq), sites: make(map[string]*vcfSite), queries: make([]vcfQuery, 0)}
+
+	var err error
+
+	for AS := range cVariants {
+		if AS.Queryname == refID || err != nil {
+			continue
+		}
+		alts := make(map[string]string)
+		annotations := make([]vcfRecord, 0)
+		for _, v := range AS.Vs {
+			if start > 0 && end > 0 {
+				if v.Position < start || v.Position > end {
+					continue
+				}
+			}
+			var records []vcfRecord
+			records, err = vcfRecordsFromVariant(v, refSeq)
+			if err != nil {
+				break
+			}
+			for _, r := range records {
+				if r.alt == "" {
+					annotations = append(annotations, r)
+					continue
+				}
+				if alt, ok := alts[r.key()]; ok {
+					if alt == r.alt {
+						addRecord(contig.sites, r, false)
+					}
+					continue
+				}
+				addRecord(contig.sites, r, true)
+				alts[r.key()] = r.alt
+			}
+		}
+		// amino acid indels only annotate the query's allele at their nucleotide indel's site
+		for _, r := range annotations {
+			if alt, ok := alts[r.key()]; ok {
+				r.alt = alt
+				addRecord(contig.sites, r, false)
+			}
+		}
+		contig.queries = append(contig.queries, vcfQuery{name: AS.Queryname, idx: AS.Idx, alts: alts, missing: AS.Missing})
+	}
+
+	if err != nil {
+		return VCFContig{}, err
+	}
+
+	sort.SliceStable(contig.queries, func(i, j int) bool {
+		return contig.queries[i].idx < contig.queries[j].idx
+	})
+
+	return contig, nil
+}
+
+// genotype returns the (haploid) genotype of q at site: the index of its alternate allele there (numbered from 1,
+// given the indices in alleleIdx), 0 if it has the reference allele, or "." if it has missing data anywhere in the
+// site's reference allele
+func (q vcfQuery) genotype(site *vcfSite, alleleIdx map[string]int) string {
+	key := vcfRecord{pos: site.pos, ref: site.ref, class: site.class}.key()
+	if alt, ok := q.alts[key]; ok {
+		return strconv.Itoa(alleleIdx[alt])
+	}
+	if IsMissing(q.missing, site.pos, site.pos+len(site.ref)-1) {
+		return "."
+	}
+	return "0"
+}
+
+// writeVCFHeader writes the meta-information lines of a vcf file, with a contig line for each of contigs. If
+// aggregate is true the file is sites-only
+func writeVCFHeader(w io.Writer, contigs []VCFContig, aggregate bool, samples []string) error {
+
+	header := "##fileformat=VCFv4.3\n" +
+		"##source=gofasta\n"
+
+	for _, c := range contigs {
+		header = header + "##contig=<ID=" + c.refID + ",length=" + strconv.Itoa(c.refLen) + ">\n"
+	}
+
+	header = header + "##INFO=<ID=TYPE,Number=A,Type=String,Description=\"Type of each alternate allele (snp, ins or del)\">\n" +
+		"##INFO=<ID=AA,Number=A,Type=String,Description=\"Amino acid change(s) caused by each alternate allele, \\\"|\\\"-delimited, or . if none\">\n" +
+		"##INFO=<ID=AC,Number=A,Type=Integer,Description=\"Number of sequences carrying each alternate allele\">\n" +
+		"##INFO=<ID=AN,Number=1,Type=Integer,Description=\"Number of sequences without missing data at the site\">\n"
+
+	if aggregate {
+		header = header + "##INFO=<ID=AF,Number=A,Type=Float,Description=\"Frequency of each alternate allele\">\n"
+	} else {
+		header = header + "##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n"
+	}
+
+	header = header + "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO"
+	if !aggregate {
+		header = header + "\tFORMAT\t" + strings.Join(samples, "\t")
+	}
+	header = header + "\n"
+
+	_, err := w.Write([]byte(header))
+
+	return err
+}
+
+// vcfSiteFields returns the first eight (fixed) columns of a vcf line for one site, where n sequences don't have
+// missing data
+func vcfSiteFields(refID string, site *vcfSite, alleles []vcfAllele, n int, aggregate bool) string {
+
+	alts := make([]string, len(alleles))
+	types := make([]string, len(alleles))
+	aas := make([]string, len(alleles))
+	acs := make([]string, len(alleles))
+	afs := make([]string, len(alleles))
+	anyAA := false
+	for i, a := range alleles {
+		alts[i] = a.alt
+		types[i] = a.changetype
+		if len(a.aas) > 0 {
+			aas[i] = strings.Join(a.aas, "|")
+			anyAA = true
+		} else {
+			aas[i] = "."
+		}
+		acs[i] = strconv.Itoa(a.count)
+		afs[i] = strconv.FormatFloat(alleleFrequency(a, n), 'f', 9, 64)
+	}
+
+	info := "TYPE=" + strings.Join(types, ",")
+	if anyAA {
+		info = info + ";AA=" + strings.Join(aas, ",")
+	}
+	info = info + ";AC=" + strings.Join(acs, ",") + ";AN=" + strconv.Itoa(n)
+	if aggregate {
+		info = info + ";AF=" + strings.Join(afs, ",")
+	}
+
+	return refID + "\t" + strconv.Itoa(site.pos) + "\t.\t" + site.ref + "\t" + strings.Join(alts, ",") + "\t.\t.\t" + info
+}
+
+// alleleFrequency returns the frequency of an allele among the n sequences without missing data at its site
+func alleleFrequency(a vcfAllele, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return float64(a.count) / float64(n)
+}
+
+// WriteVCFContigs writes the sites in contigs to a vcf file, in order, after one header with a contig line for
+// each of them. If aggregate is true, the file is sites-only and
+// only alleles with a frequency of at least threshold are written, otherwise there is one (haploid) genotype
+// column per query (in order of their first appearance in contigs), which is "." in a contig that the query
+// isn't in
+func WriteVCFContigs(w io.Writer, contigs []VCFContig, aggregate bool, threshold float64) error {
+
+	samples := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, c := range contigs {
+		for _, q := range c.queries {
+			if !seen[q.name] {
+				samples = append(samples, q.name)
+				seen[q.name] = true
+			}
+		}
+	}
+
+	err := writeVCFHeader(w, contigs, aggregate, samples)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range contigs {
+
+		byName := make(map[string]vcfQuery, len(c.queries))
+		for _, q := range c.queries {
+			byName[q.name] = q
+		}
+
+		for _, site := range sortedSites(c.sites) {
+
+			alleleIdx := make(map[string]int)
+			for i, a := range site.alleles {
+				alleleIdx[a.alt] = i + 1
+			}
+
+			gts := make([]string, len(samples))
+			n := 0
+			for i, s := range samples {
+				q, ok := byName[s]
+				if !ok {
+					gts[i] = "."
+					continue
+				}
+				gts[i] = q.genotype(site, alleleIdx)
+				if gts[i] != "." {
+					n++
+				}
+			}
+
+			var line string
+			if aggregate {
+				alleles := make([]vcfAllele, 0)
+				for _, a := range site.alleles {
+					if alleleFrequency(a, n) < threshold {
+						continue
+					}
+					alleles = append(alleles, a)
+				}
+				if len(alleles) == 0 {
+					continue
+				}
+				line = vcfSiteFields(c.refID, site, alleles, n, true) + "\n"
+			} else {
+				line = vcfSiteFields(c.refID, site, site.alleles, n, false) + "\tGT\t" + strings.Join(gts, "\t") + "\n"
+			}
+
+			_, err = w.Write([]byte(line))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteVCF writes each query's mutations to file or stdout in vcf format, with one (haploid) genotype
+// column per query. A query's genotype is "." at a site where it has missing data (see AnnoStructs) and
+// no alternate allele. All the queries' variants are held in memory until the input channel is closed.
+func WriteVCF(w io.Writer, start, end int, refID string, refSeq string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
+
+	contig, err := CollectVCF(start, end, refID, refSeq, cVariants)
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	err = WriteVCFContigs(w, []VCFContig{contig}, false, 0.0)
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	cWriteDone <- true
+}
+
+// AggregateWriteVCF aggregates the mutations that are present greater than
+// or equal to threshold, and writes them to file or stdout as a sites-only vcf
+// whose INFO fields carry their counts and frequencies (among the sequences
+// without missing data at each site)
+func AggregateWriteVCF(w io.Writer, start, end int, threshold float64, refID string, refSeq string, cVariants chan AnnoStructs, cWriteDone chan bool, cErr chan error) {
+
+	contig, err := CollectVCF(start, end, refID, refSeq, cVariants)
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	err = WriteVCFContigs(w, []VCFContig{contig}, true, threshold)
+	if err != nil {
+		cErr <- err
+		return
+	}
+
+	cWriteDone <- true
+}
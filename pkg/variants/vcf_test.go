@@ -0,0 +1,219 @@
+package variants
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVariantsVCF(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq1
+ATGTATTGATGATGTAG-AAAATA
+>seq2
+ACGTA---ATGATGTAG-AAAAAA
+>seq3
+ACGTAATGATGATGTAGCAAAAAA
+>seq4
+ACGTAATGATGAG-TAG-TAAA-T
+`)
+
+	msa := bytes.NewReader(msaData)
+	genbankReader := bytes.NewReader(genbankDataShort)
+	out := new(bytes.Buffer)
+
+	err := Variants(msa, false, "reference", genbankReader, "gb", out, Options{Format: "vcf"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult := "##fileformat=VCFv4.3\n" +
+		"##source=gofasta\n" +
+		"##contig=<ID=reference,length=23>\n" +
+		"##INFO=<ID=TYPE,Number=A,Type=String,Description=\"Type of each alternate allele (snp, ins or del)\">\n" +
+		"##INFO=<ID=AA,Number=A,Type=String,Description=\"Amino acid change(s) caused by each alternate allele, \\\"|\\\"-delimited, or . if none\">\n" +
+		"##INFO=<ID=AC,Number=A,Type=Integer,Description=\"Number of sequences carrying each alternate allele\">\n" +
+		"##INFO=<ID=AN,Number=1,Type=Integer,Description=\"Number of sequences without missing data at the site\">\n" +
+		"##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tseq1\tseq2\tseq3\tseq4\n" +
+		"reference\t2\t.\tC\tT\t.\t.\tTYPE=snp;AC=1;AN=4\tGT\t1\t0\t0\t0\n" +
+		"reference\t5\t.\tAATG\tA\t.\t.\tTYPE=del;AA=gene1:del1;AC=1;AN=4\tGT\t0\t1\t0\t0\n" +
+		"reference\t6\t.\tA\tT\t.\t.\tTYPE=snp;AA=gene1:M1L;AC=1;AN=4\tGT\t1\t0\t0\t0\n" +
+		"reference\t13\t.\tTG\tT\t.\t.\tTYPE=del;AC=1;AN=4\tGT\t0\t0\t0\t1\n" +
+		"reference\t13\t.\tT\tG\t.\t.\tTYPE=snp;AC=1;AN=4\tGT\t0\t0\t0\t1\n" +
+		"reference\t17\t.\tG\tGC\t.\t.\tTYPE=ins;AC=1;AN=4\tGT\t0\t0\t1\t0\n" +
+		"reference\t18\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=4\tGT\t0\t0\t0\t1\n" +
+		"reference\t21\t.\tAA\tA\t.\t.\tTYPE=del;AC=1;AN=4\tGT\t0\t0\t0\t1\n" +
+		"reference\t22\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=4\tGT\t1\t0\t0\t0\n" +
+		"reference\t23\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=4\tGT\t0\t0\t0\t1\n"
+
+	if out.String() != desiredResult {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsVCF()")
+	}
+
+	msa = bytes.NewReader(msaData)
+	genbankReader = bytes.NewReader(genbankDataShort)
+	out = new(bytes.Buffer)
+
+	err = Variants(msa, false, "reference", genbankReader, "gb", out, Options{Aggregate: true, Threshold: 0.25, Format: "vcf"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult = "##fileformat=VCFv4.3\n" +
+		"##source=gofasta\n" +
+		"##contig=<ID=reference,length=23>\n" +
+		"##INFO=<ID=TYPE,Number=A,Type=String,Description=\"Type of each alternate allele (snp, ins or del)\">\n" +
+		"##INFO=<ID=AA,Number=A,Type=String,Description=\"Amino acid change(s) caused by each alternate allele, \\\"|\\\"-delimited, or . if none\">\n" +
+		"##INFO=<ID=AC,Number=A,Type=Integer,Description=\"Number of sequences carrying each alternate allele\">\n" +
+		"##INFO=<ID=AN,Number=1,Type=Integer,Description=\"Number of sequences without missing data at the site\">\n" +
+		"##INFO=<ID=AF,Number=A,Type=Float,Description=\"Frequency of each alternate allele\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n" +
+		"reference\t2\t.\tC\tT\t.\t.\tTYPE=snp;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t5\t.\tAATG\tA\t.\t.\tTYPE=del;AA=gene1:del1;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t6\t.\tA\tT\t.\t.\tTYPE=snp;AA=gene1:M1L;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t13\t.\tTG\tT\t.\t.\tTYPE=del;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t13\t.\tT\tG\t.\t.\tTYPE=snp;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t17\t.\tG\tGC\t.\t.\tTYPE=ins;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t18\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t21\t.\tAA\tA\t.\t.\tTYPE=del;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t22\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=4;AF=0.250000000\n" +
+		"reference\t23\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=4;AF=0.250000000\n"
+
+	if out.String() != desiredResult {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsVCF() (aggregate)")
+	}
+}
+
+func TestVariantsVCFMissing(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAG-AAAAAA
+>seq1
+ATGTAATGATGATGTAG-AAAATA
+>seq2
+ANGTAATGATGATGTAG-AAAANA
+>seq3
+ARGTAATGATGATGTAG-AAAAAA
+>seq4
+ACGTAATGATGATGTAG-AAA---
+`)
+
+	msa := bytes.NewReader(msaData)
+	genbankReader := bytes.NewReader(genbankDataShort)
+	out := new(bytes.Buffer)
+
+	err := Variants(msa, false, "reference", genbankReader, "gb", out, Options{Format: "vcf"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult := "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tseq1\tseq2\tseq3\tseq4\n" +
+		"reference\t2\t.\tC\tT\t.\t.\tTYPE=snp;AC=1;AN=2\tGT\t1\t.\t.\t0\n" +
+		"reference\t22\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=2\tGT\t1\t.\t0\t.\n"
+
+	if !strings.HasSuffix(out.String(), desiredResult) {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsVCFMissing()")
+	}
+
+	msa = bytes.NewReader(msaData)
+	genbankReader = bytes.NewReader(genbankDataShort)
+	out = new(bytes.Buffer)
+
+	err = Variants(msa, false, "reference", genbankReader, "gb", out, Options{Aggregate: true, Format: "vcf"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult = "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n" +
+		"reference\t2\t.\tC\tT\t.\t.\tTYPE=snp;AC=1;AN=2;AF=0.500000000\n" +
+		"reference\t22\t.\tA\tT\t.\t.\tTYPE=snp;AC=1;AN=2;AF=0.500000000\n"
+
+	if !strings.HasSuffix(out.String(), desiredResult) {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsVCFMissing() (aggregate)")
+	}
+}
+
+// a nucleotide change that causes amino acid changes in overlapping features (here a CDS and a mat_peptide in it)
+// carries all of them, but is only counted once
+func TestVariantsVCFOverlappingFeatures(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATGATGTAGAAAAAA
+>seq1
+ACGTAATGAAGATGTAGAAAAAA
+>seq2
+ACGTAATGATGATGTAGAAAAAA
+`)
+
+	out := new(bytes.Buffer)
+	err := Variants(bytes.NewReader(msaData), false, "reference", bytes.NewReader(genbankDataMatPeptide), "gb", out, Options{Format: "vcf"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult := "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tseq1\tseq2\n" +
+		"reference\t10\t.\tT\tA\t.\t.\tTYPE=snp;AA=gene1:M2K|p1:M1K;AC=1;AN=2\tGT\t1\t0\n"
+
+	if !strings.HasSuffix(out.String(), desiredResult) {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsVCFOverlappingFeatures()")
+	}
+}
+
+func TestVariantsVCFAAIndels(t *testing.T) {
+	msaData := []byte(`>reference
+ACGTAATGATG---ATGTAGAAAAAA
+>seq1
+ACGTAATG------ATGTAGAAAAAA
+>seq2
+ACGTAATGATGAAAATGTAGAAAAAA
+`)
+
+	out := new(bytes.Buffer)
+	err := Variants(bytes.NewReader(msaData), false, "reference", bytes.NewReader(genbankDataShort), "gb", out, Options{Format: "vcf"}, 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	desiredResult := "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tseq1\tseq2\n" +
+		"reference\t8\t.\tGATG\tG\t.\t.\tTYPE=del;AA=gene1:del2;AC=1;AN=2\tGT\t1\t0\n" +
+		"reference\t11\t.\tG\tGAAA\t.\t.\tTYPE=ins;AA=gene1:ins2K;AC=1;AN=2\tGT\t0\t1\n"
+
+	if !strings.HasSuffix(out.String(), desiredResult) {
+		fmt.Println(out.String())
+		t.Errorf("problem in TestVariantsVCFAAIndels()")
+	}
+}
+
+func TestVCFRecordsFromVariant(t *testing.T) {
+	refSeq := "ACGTAATGATGATGTAGAAAAAA"
+
+	tests := []struct {
+		v    Variant
+		want []vcfRecord
+	}{
+		{Variant{Changetype: "nuc", RefAl: "C", QueAl: "T", Position: 2}, []vcfRecord{{pos: 2, ref: "C", alt: "T", class: "snp"}}},
+		{Variant{Changetype: "nuc", RefAl: "C", QueAl: "Y", Position: 2}, []vcfRecord{}},
+		{Variant{Changetype: "aa", RefAl: "M", QueAl: "L", Position: 6, Residue: 1, Feature: "gene1", SNPs: "nuc:A6T"}, []vcfRecord{{pos: 6, ref: "A", alt: "T", class: "snp", aa: "gene1:M1L"}}},
+		{Variant{Changetype: "del", Position: 6, Length: 3}, []vcfRecord{{pos: 5, ref: "AATG", alt: "A", class: "del"}}},
+		{Variant{Changetype: "del", Position: 1, Length: 2}, []vcfRecord{{pos: 1, ref: "ACG", alt: "G", class: "del"}}},
+		{Variant{Changetype: "ins", Position: 17, Length: 2, QueAl: "CR"}, []vcfRecord{{pos: 17, ref: "G", alt: "GCN", class: "ins"}}},
+		{Variant{Changetype: "aadel", RefAl: "M", Position: 9, Residue: 2, Length: 1, Feature: "gene1", SNPs: "del:9:3"}, []vcfRecord{{pos: 8, ref: "GATG", class: "del", aa: "gene1:del2"}}},
+		{Variant{Changetype: "aains", QueAl: "K", Position: 9, Residue: 2, Length: 1, Feature: "gene1", SNPs: "ins:11:3"}, []vcfRecord{{pos: 11, ref: "G", class: "ins", aa: "gene1:ins2K"}}},
+	}
+
+	for _, test := range tests {
+		records, err := vcfRecordsFromVariant(test.v, refSeq)
+		if err != nil {
+			t.Error(err)
+		}
+		if fmt.Sprint(records) != fmt.Sprint(test.want) {
+			t.Errorf("problem in TestVCFRecordsFromVariant(): got %v, want %v", records, test.want)
+		}
+	}
+}